@@ -0,0 +1,76 @@
+// Package testutil holds the helpers shared by the unit tests
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+// NewFakeK8sClient returns the dummy kubernetes client object holding the objects for testing
+func NewFakeK8sClient(objects ...runtime.Object) (*config.K8sClient, error) {
+	return config.NewK8sClient(nil, func(r *rest.Config) (kubernetes.Interface, error) {
+		return testclient.NewSimpleClientset(objects...), nil
+	})
+}
+
+// StartNamespaceInformer starts the namespace informer of the client until the test ends, so that the namespaces are listed from its cache
+func StartNamespaceInformer(t *testing.T, k8sClient *config.K8sClient) {
+	t.Helper()
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	if err := k8sClient.StartNamespaceInformer(stopCh); err != nil {
+		t.Fatalf("Error occured in starting the namespace informer: %v", err)
+	}
+}
+
+// NewCert returns the PEM encoded self-signed certificate valid until notAfter & its key
+func NewCert(t *testing.T, notAfter time.Time) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error occured in generating the key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "lm-k8s-webhook"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Error occured in creating the certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Error occured in marshaling the key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// WriteCert writes the certificate & key into the dir as tls.crt & tls.key, and returns their paths
+func WriteCert(t *testing.T, dir string, certPEM []byte, keyPEM []byte) (string, string) {
+	t.Helper()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatalf("Error occured in writing the certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatalf("Error occured in writing the key: %v", err)
+	}
+	return certFile, keyFile
+}
@@ -3,13 +3,24 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/logicmonitor/lm-k8s-webhook/internal/version"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/certs"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/clusterinfo"
 	lmk8swebhookconfig "github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/debug"
 	"github.com/logicmonitor/lm-k8s-webhook/pkg/handler"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/mutation"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/readiness"
 	"github.com/logicmonitor/lm-k8s-webhook/pkg/reloader"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/rollout"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/secretsync"
 
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 
@@ -22,6 +33,7 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -50,6 +62,31 @@ func main() {
 	var webhookCertDir string
 	var probeAddr string
 	var lmconfigFilePath string
+	var clusterName string
+	var clusterNameDiscoveryOrder string
+	var clusterNameConfigMap string
+	var clusterNameConfigMapKey string
+	var enableWorkloadMutation bool
+	var enableCustomResourceMutation bool
+	var enableLeaderElection bool
+	var maxInflightRequests int
+	var admissionTimeout time.Duration
+	var workloadLookupTimeout time.Duration
+	var workloadLookupRetries int
+	var mutationCacheSize int
+	var mutationCacheTTL time.Duration
+	var certExpiryThreshold time.Duration
+	var selfTestInterval time.Duration
+	var webhookConfigName string
+	var certCheckInterval time.Duration
+	var observeOnly bool
+	var debugAPITokenFile string
+	var secretCopyNamespaces string
+	var secretCopyNames string
+	var secretSyncInterval time.Duration
+	var captureDir string
+	var maxCaptures int64
+	var maxCaptureBytes int64
 	var k8sRestConfig *rest.Config
 
 	flag.StringVar(&metricAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
@@ -57,10 +94,34 @@ func main() {
 	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/etc/lmk8swebhook/certs", "webhook certificate directory.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.StringVar(&lmconfigFilePath, "lmk8swebhookconfig-file-path", "/etc/lmk8swebhook/config/lmk8swebhookconfig.yaml", "File path of lmk8swebhookconfig")
+	flag.StringVar(&clusterName, "cluster-name", "", "Name of the cluster, CLUSTER_NAME env variable is used if not specified.")
+	flag.StringVar(&clusterNameDiscoveryOrder, "cluster-name-discovery-order", "flag,configMap,namespaceAnnotation,nodeLabel,namespaceUID", "Comma separated order of the strategies tried for discovering the cluster name.")
+	flag.StringVar(&clusterNameConfigMap, "cluster-name-configmap", "", "Config map holding the cluster name in namespace/name format.")
+	flag.StringVar(&clusterNameConfigMapKey, "cluster-name-configmap-key", clusterinfo.DefaultConfigMapKey, "Key of the config map holding the cluster name.")
+	flag.IntVar(&maxInflightRequests, "max-inflight-requests", 0, "Max number of the pod admission requests handled concurrently, 0 means no limit.")
+	flag.DurationVar(&admissionTimeout, "admission-timeout", 10*time.Second, "Timeout of the mutating webhook, time budget of a pod admission request is derived from it.")
+	flag.DurationVar(&workloadLookupTimeout, "workload-lookup-timeout", 2*time.Second, "Deadline of each API call looking up the workload resource managing the pod, 0 means the call is bounded by the admission request only.")
+	flag.IntVar(&workloadLookupRetries, "workload-lookup-retries", 2, "Number of the retries of an API call looking up the workload resource, which failed with a transient error.")
+	flag.IntVar(&mutationCacheSize, "mutation-cache-size", 1024, "Max number of the memoized mutation results of the identical pods & the workload names of the pod owners, 0 disables the memoization.")
+	flag.DurationVar(&mutationCacheTTL, "mutation-cache-ttl", 5*time.Minute, "Duration for which the memoized mutation results & workload names are used.")
+	flag.DurationVar(&certExpiryThreshold, "cert-expiry-threshold", 24*time.Hour, "Warning is logged if the serving certificate expires within the threshold, webhook is not ready only once it is expired.")
+	flag.DurationVar(&selfTestInterval, "self-test-interval", 30*time.Second, "Interval of the self-test mutating a canned pod, webhook is not ready if the self-test has not succeeded for three intervals.")
+	flag.StringVar(&webhookConfigName, "webhook-config-name", "", "Name of the MutatingWebhookConfiguration whose caBundle is checked against the serving certificate, caBundle is not checked if not specified.")
+	flag.DurationVar(&certCheckInterval, "cert-check-interval", time.Minute, "Interval of refreshing the serving certificate expiry metrics & checking the caBundle.")
+	flag.BoolVar(&observeOnly, "observe-only", false, "Compute & record the mutations in logs, metrics & audit annotations without applying them, namespaces can override it by the lm-k8s-webhook/observe-only annotation.")
+	flag.StringVar(&debugAPITokenFile, "debug-api-token-file", "", "File holding the bearer token of the admin debug API served on /debug/ paths of the webhook server, debug API is disabled if not specified.")
+	flag.StringVar(&secretCopyNamespaces, "secret-copy-namespaces", "", "Comma separated namespaces into which the secrets of the webhook namespace can be copied by copyFromWebhookNamespace.")
+	flag.StringVar(&secretCopyNames, "secret-copy-names", "", "Comma separated names of the secrets of the webhook namespace, which can be copied by copyFromWebhookNamespace, secrets are not copied if not specified.")
+	flag.DurationVar(&secretSyncInterval, "secret-sync-interval", 5*time.Minute, "Interval of syncing the copied secrets with their source in the webhook namespace.")
+	flag.StringVar(&captureDir, "capture-dir", "", "Directory to save the sanitized pod admission requests & the resulting patches to, to be replayed against the later versions, requests are not captured if not specified.")
+	flag.Int64Var(&maxCaptures, "max-captures", 1000, "Max number of the pod admission requests captured, it must be positive.")
+	flag.Int64Var(&maxCaptureBytes, "max-capture-bytes", 100<<20, "Max total size in bytes of the pod admission requests captured, it must be positive.")
+	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable the leader election, so that the workloads are restarted by the rollout of the leader replica only.")
+	flag.BoolVar(&enableWorkloadMutation, "enable-workload-mutation", false, "Enable the mutation of the pod templates of the workload resources on /mutate-workload path.")
+	flag.BoolVar(&enableCustomResourceMutation, "enable-custom-resource-mutation", false, "Enable the mutation of the pod specs embedded in the custom resources registered in the config on /mutate-custom-resource path.")
 
-	var ctx context.Context
-	ctx = context.Background()
-	ctx, cancel := context.WithCancel(ctx)
+	// ctx is cancelled on SIGTERM & SIGINT, stopping the manager & the background routines started along with it
+	ctx, cancel := context.WithCancel(signals.SetupSignalHandler())
 	defer cancel()
 
 	opts := zap.Options{
@@ -90,6 +151,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Intervals drive the tickers of the background routines, which do not accept the non-positive intervals
+	for name, interval := range map[string]time.Duration{"self-test-interval": selfTestInterval, "cert-check-interval": certCheckInterval} {
+		if interval <= 0 {
+			setupLog.Error(fmt.Errorf("%s must be positive, but is %s", name, interval), "Invalid interval")
+			os.Exit(1)
+		}
+	}
+
 	// Load the external config
 
 	err = lmk8swebhookconfig.LoadConfig(lmconfigFilePath)
@@ -109,6 +178,11 @@ func main() {
 		MetricsBindAddress:     metricAddr,
 		Port:                   port,
 		HealthProbeBindAddress: probeAddr,
+		// Leader runs the runnables needing the leader election, like the rollout of the workloads on the config reload
+		LeaderElection:             enableLeaderElection,
+		LeaderElectionID:           "lm-k8s-webhook-leader",
+		LeaderElectionNamespace:    os.Getenv(mutation.WebhookNamespace),
+		LeaderElectionResourceLock: resourcelock.LeasesResourceLock,
 	}
 
 	k8sRestConfig = config.GetConfigOrDie()
@@ -132,20 +206,143 @@ func main() {
 		os.Exit(1)
 	}
 
+	discoveryOrder, err := clusterinfo.ParseOrder(clusterNameDiscoveryOrder)
+	if err != nil {
+		setupLog.Error(err, "Failed in parsing cluster name discovery order")
+		os.Exit(1)
+	}
+	clusterNameDiscoverer := &clusterinfo.Discoverer{
+		Client:       k8sClient,
+		Log:          ctrl.Log.WithName("clusterinfo"),
+		Order:        discoveryOrder,
+		ClusterName:  clusterName,
+		ConfigMap:    clusterNameConfigMap,
+		ConfigMapKey: clusterNameConfigMapKey,
+	}
+	if _, _, err := clusterNameDiscoverer.Discover(ctx); err != nil {
+		setupLog.Error(err, "Cluster name is not discovered, LM_APM_CLUSTER_NAME will be empty")
+	}
+
+	var mutationCache *mutation.MutationCache
+	if mutationCacheSize > 0 {
+		mutationCache = mutation.NewMutationCache(mutationCacheSize, mutationCacheTTL)
+	}
+
+	var recorder *handler.Recorder
+	if captureDir != "" {
+		if err := os.MkdirAll(captureDir, 0700); err != nil {
+			setupLog.Error(err, "unable to create the capture directory", "captureDir", captureDir)
+			os.Exit(1)
+		}
+		if maxCaptures <= 0 || maxCaptureBytes <= 0 {
+			setupLog.Error(nil, "max-captures & max-capture-bytes must be positive", "maxCaptures", maxCaptures, "maxCaptureBytes", maxCaptureBytes)
+			os.Exit(1)
+		}
+		setupLog.Info("Capturing the pod admission requests", "captureDir", captureDir, "maxCaptures", maxCaptures, "maxCaptureBytes", maxCaptureBytes)
+		recorder = handler.NewRecorder(captureDir, ctrl.Log.WithName("lm-podmutator-recorder"), maxCaptures, maxCaptureBytes)
+		if err := mgr.Add(recorder); err != nil {
+			setupLog.Error(err, "unable to set up the capture recorder")
+			os.Exit(1)
+		}
+	}
+
+	var secretCopier mutation.SecretCopier
+	if namespaces, names := splitList(secretCopyNamespaces), splitList(secretCopyNames); len(namespaces) > 0 && len(names) > 0 {
+		if secretSyncInterval <= 0 {
+			setupLog.Error(nil, "secret-sync-interval must be positive", "secretSyncInterval", secretSyncInterval)
+			os.Exit(1)
+		}
+		secretSyncer := secretsync.NewSyncer(k8sClient, ctrl.Log.WithName("secret-sync"), os.Getenv(mutation.WebhookNamespace), namespaces, names, secretSyncInterval)
+		if err := mgr.Add(secretSyncer); err != nil {
+			setupLog.Error(err, "unable to set up secret syncer")
+			os.Exit(1)
+		}
+		secretCopier = secretSyncer
+	}
+
 	setupLog.Info("registering webhooks to the webhook server")
-	lmWebhookServer.Register("/mutate", &webhook.Admission{Handler: &handler.LMPodMutationHandler{Client: k8sClient, Log: ctrl.Log.WithName("lm-podmutator-webhook")}})
+	// Handlers share the in-flight limit, the memoized results & the recorder
+	handlerOptions := handler.Options{
+		Limiter:        handler.NewLimiter(maxInflightRequests, admissionTimeout),
+		WorkloadLookup: mutation.WorkloadLookupOptions{Timeout: workloadLookupTimeout, Retries: workloadLookupRetries},
+		Cache:          mutationCache,
+		ObserveOnly:    observeOnly,
+		SecretCopier:   secretCopier,
+		Recorder:       recorder,
+	}
+	podMutationHandler := &handler.LMPodMutationHandler{Client: k8sClient, Log: ctrl.Log.WithName("lm-podmutator-webhook"), Options: handlerOptions}
+	lmWebhookServer.Register("/mutate", &webhook.Admission{Handler: podMutationHandler})
+	if enableWorkloadMutation {
+		lmWebhookServer.Register("/mutate-workload", &webhook.Admission{Handler: &handler.LMWorkloadMutationHandler{Client: k8sClient, Log: ctrl.Log.WithName("lm-workloadmutator-webhook"), Options: handlerOptions}})
+	}
+	if enableCustomResourceMutation {
+		lmWebhookServer.Register("/mutate-custom-resource", &webhook.Admission{Handler: &handler.LMCustomResourceMutationHandler{Client: k8sClient, Log: ctrl.Log.WithName("lm-customresourcemutator-webhook"), Options: handlerOptions}})
+	}
+
+	if debugAPITokenFile != "" {
+		setupLog.Info("registering admin debug API to the webhook server")
+		debugAPI := &debug.API{
+			Client:         k8sClient,
+			Cache:          mutationCache,
+			WorkloadLookup: podMutationHandler.WorkloadLookup,
+			TokenFile:      debugAPITokenFile,
+			Log:            ctrl.Log.WithName("debug-api"),
+		}
+		debugAPI.Register(lmWebhookServer.Register)
+	}
+
+	// Namespace informer is started along with the manager, so that the webhook server is not blocked until its cache syncs,
+	// the informer readiness check gates the traffic until then
+	if err := mgr.Add(&lmk8swebhookconfig.NamespaceInformer{Client: k8sClient}); err != nil {
+		setupLog.Error(err, "unable to set up namespace informer")
+		os.Exit(1)
+	}
 
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
-	if err := mgr.AddReadyzCheck("check", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up ready check")
+
+	certWatcher := &certs.Watcher{
+		CertFile:          filepath.Join(webhookCertDir, webhookCertName),
+		KeyFile:           filepath.Join(webhookCertDir, webhookKeyName),
+		Log:               ctrl.Log.WithName("cert-watcher"),
+		Client:            k8sClient,
+		Recorder:          mgr.GetEventRecorderFor("lm-k8s-webhook"),
+		WebhookConfigName: webhookConfigName,
+		CheckInterval:     certCheckInterval,
+	}
+	if err := mgr.Add(certWatcher); err != nil {
+		setupLog.Error(err, "unable to set up cert watcher")
 		os.Exit(1)
 	}
 
+	selfTest := readiness.NewSelfTest(k8sClient, ctrl.Log.WithName("self-test"), os.Getenv(mutation.WebhookNamespace), selfTestInterval)
+	if err := mgr.Add(selfTest); err != nil {
+		setupLog.Error(err, "unable to set up self-test")
+		os.Exit(1)
+	}
+	readyChecks := map[string]healthz.Checker{
+		"config":      readiness.ConfigCheck(lmconfigFilePath),
+		"certificate": readiness.CertCheck(filepath.Join(webhookCertDir, webhookCertName), filepath.Join(webhookCertDir, webhookKeyName), certExpiryThreshold, certWatcher, ctrl.Log.WithName("cert-check")),
+		"informer":    readiness.InformerCheck(k8sClient),
+		"self-test":   selfTest.Check,
+	}
+	for name, check := range readyChecks {
+		if err := mgr.AddReadyzCheck(name, check); err != nil {
+			setupLog.Error(err, "unable to set up ready check", "check", name)
+			os.Exit(1)
+		}
+	}
+
 	if lmk8swebhookconfig.GetConfig().MutationConfigProvided {
 		setupLog.Info("setup config reloader")
+		rolloutController := rollout.NewController(k8sClient, ctrl.Log.WithName("rollout"))
+		reloader.AddReloadListener(rolloutController.OnConfigReload)
+		if err := mgr.Add(rolloutController); err != nil {
+			setupLog.Error(err, "unable to set up rollout controller")
+			os.Exit(1)
+		}
 		err := reloader.SetupConfigReloader(ctx, lmconfigFilePath)
 		if err != nil {
 			setupLog.Error(err, "failed to setup config-reloader")
@@ -154,9 +351,20 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "unable to run manager")
 		cancel()
 		os.Exit(1)
 	}
 }
+
+// splitList splits the comma separated list, ignoring the empty elements
+func splitList(value string) []string {
+	var list []string
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			list = append(list, element)
+		}
+	}
+	return list
+}
@@ -0,0 +1,238 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// EventReasonCABundleMismatch is the reason of the event emitted when the caBundle does not verify the serving certificate
+	EventReasonCABundleMismatch = "CABundleMismatch"
+
+	// reloadDelay is the delay after the last change in the cert directory before reloading the certificate,
+	// so that the certificate & the key updated one after another are loaded together
+	reloadDelay = 100 * time.Millisecond
+)
+
+// Watcher watches the cert directory, reloads the serving certificate on its changes and exposes its expiry through the metrics.
+// Watching the directory, instead of the files, catches the atomic updates of the mounted secrets as well.
+// The webhook server reloads the certificate it serves from the same files.
+type Watcher struct {
+	CertFile string
+	KeyFile  string
+	Log      logr.Logger
+
+	// Client & Recorder are used to check the caBundle of the MutatingWebhookConfiguration named WebhookConfigName,
+	// caBundle is not checked if WebhookConfigName is empty
+	Client            *config.K8sClient
+	Recorder          record.EventRecorder
+	WebhookConfigName string
+
+	// CheckInterval is the interval of refreshing the expiry metrics & checking the caBundle
+	CheckInterval time.Duration
+
+	lock sync.RWMutex
+	// chain is the loaded certificate chain, leaf certificate is the first one
+	chain []*x509.Certificate
+	// reloadErr is the error of the last reload, nil if it succeeded
+	reloadErr error
+}
+
+// Start watches the cert directory until the context is done
+func (w *Watcher) Start(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	certDir := filepath.Dir(w.CertFile)
+	if err := watcher.Add(certDir); err != nil {
+		return fmt.Errorf("failed to watch the cert directory %s: %w", certDir, err)
+	}
+	w.Log.Info("Watching the cert directory", "certDir", certDir)
+
+	w.reload(ctx)
+
+	ticker := time.NewTicker(w.CheckInterval)
+	defer ticker.Stop()
+	reloadTimer := time.NewTimer(reloadDelay)
+	reloadTimer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) != 0 {
+				w.Log.V(1).Info("Cert directory changed", "event", event)
+				reloadTimer.Reset(reloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.Log.Error(err, "Error in watching the cert directory")
+		case <-reloadTimer.C:
+			w.reload(ctx)
+		case <-ticker.C:
+			w.updateExpiry()
+			w.checkCABundle(ctx)
+		}
+	}
+}
+
+// NeedLeaderElection implements the LeaderElectionRunnable, certificate is watched on every replica
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+// Certificate returns the loaded serving certificate, it is nil until the certificate is loaded
+func (w *Watcher) Certificate() *x509.Certificate {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	if len(w.chain) == 0 {
+		return nil
+	}
+	return w.chain[0]
+}
+
+// ReloadError returns the error of the last reload of the certificate, nil if it succeeded or the certificate is not reloaded yet
+func (w *Watcher) ReloadError() error {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.reloadErr
+}
+
+// reload reloads the certificate and checks it against the caBundle
+func (w *Watcher) reload(ctx context.Context) {
+	if err := w.Reload(); err != nil {
+		w.Log.Error(err, "Error in reloading the serving certificate, previous certificate is kept")
+		return
+	}
+	w.checkCABundle(ctx)
+}
+
+// Reload loads the serving certificate & key from the cert directory and updates the expiry metrics
+func (w *Watcher) Reload() error {
+	chain, err := loadCertificate(w.CertFile, w.KeyFile)
+	if err != nil {
+		metrics.ServingCertReloads.WithLabelValues(metrics.CertReloadFailure).Inc()
+		w.lock.Lock()
+		w.reloadErr = err
+		w.lock.Unlock()
+		return err
+	}
+	metrics.ServingCertReloads.WithLabelValues(metrics.CertReloadSuccess).Inc()
+
+	cert := chain[0]
+	previous := w.Certificate()
+	w.lock.Lock()
+	w.chain = chain
+	w.reloadErr = nil
+	w.lock.Unlock()
+
+	if previous == nil || !previous.Equal(cert) {
+		w.Log.Info("Loaded the serving certificate", "subject", cert.Subject.String(), "notAfter", cert.NotAfter.Format(time.RFC3339))
+	}
+	metrics.ServingCertNotAfter.Set(float64(cert.NotAfter.Unix()))
+	w.updateExpiry()
+	return nil
+}
+
+// updateExpiry updates the time left until the loaded certificate expires
+func (w *Watcher) updateExpiry() {
+	if cert := w.Certificate(); cert != nil {
+		metrics.ServingCertExpirySeconds.Set(time.Until(cert.NotAfter).Seconds())
+	}
+}
+
+// checkCABundle checks if the caBundle of each webhook of the MutatingWebhookConfiguration verifies the loaded certificate,
+// mismatches are logged & reported as events on the MutatingWebhookConfiguration
+func (w *Watcher) checkCABundle(ctx context.Context) {
+	w.lock.RLock()
+	chain := w.chain
+	w.lock.RUnlock()
+	if w.WebhookConfigName == "" || len(chain) == 0 {
+		return
+	}
+	webhookConfig, err := w.Client.Clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, w.WebhookConfigName, metav1.GetOptions{})
+	if err != nil {
+		w.Log.Error(err, "Error in getting the MutatingWebhookConfiguration to check the caBundle", "name", w.WebhookConfigName)
+		return
+	}
+
+	mismatch := false
+	for _, webhook := range webhookConfig.Webhooks {
+		if err := verifyCertificate(chain, webhook.ClientConfig.CABundle); err != nil {
+			mismatch = true
+			w.Log.Error(err, "caBundle of the webhook does not match the serving certificate", "mutatingWebhookConfiguration", w.WebhookConfigName, "webhook", webhook.Name)
+			if w.Recorder != nil {
+				w.Recorder.Eventf(webhookConfig, corev1.EventTypeWarning, EventReasonCABundleMismatch,
+					"caBundle of webhook %s does not match the serving certificate: %v", webhook.Name, err)
+			}
+		}
+	}
+	if mismatch {
+		metrics.ServingCertCABundleMismatch.Set(1)
+	} else {
+		metrics.ServingCertCABundleMismatch.Set(0)
+	}
+}
+
+// loadCertificate loads the certificate & key pair and returns the parsed certificate chain
+func loadCertificate(certFile string, keyFile string) ([]*x509.Certificate, error) {
+	keyPair, err := tls.LoadX509KeyPair(filepath.Clean(certFile), filepath.Clean(keyFile))
+	if err != nil {
+		return nil, fmt.Errorf("serving certificate is not loaded: %w", err)
+	}
+	chain := make([]*x509.Certificate, 0, len(keyPair.Certificate))
+	for _, certDER := range keyPair.Certificate {
+		cert, err := x509.ParseCertificate(certDER)
+		if err != nil {
+			return nil, fmt.Errorf("serving certificate is not parsed: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
+
+// verifyCertificate verifies the leaf certificate of the chain against the PEM encoded CA bundle.
+// Certificate is verified as of its issue time, so that the expiry is not reported as the mismatch.
+func verifyCertificate(chain []*x509.Certificate, caBundle []byte) error {
+	if len(caBundle) == 0 {
+		return errors.New("caBundle is empty")
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caBundle) {
+		return errors.New("caBundle does not contain any PEM encoded certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   chain[0].NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
@@ -0,0 +1,162 @@
+package certs
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/logicmonitor/lm-k8s-webhook/internal/testutil"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var logger = logf.Log.WithName("unit-tests")
+
+func TestWatcherReload(t *testing.T) {
+	dir := t.TempDir()
+	watcher := &Watcher{CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key"), Log: logger, CheckInterval: time.Minute}
+
+	if err := watcher.Reload(); err == nil {
+		t.Errorf("Watcher.Reload() returned nil for the missing certificate, instead of error")
+	}
+	if watcher.Certificate() != nil {
+		t.Errorf("Watcher.Certificate() = %v, but expected = nil", watcher.Certificate())
+	}
+	if watcher.ReloadError() == nil {
+		t.Errorf("Watcher.ReloadError() returned nil after the failed reload, instead of error")
+	}
+
+	notAfter := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	certPEM, keyPEM := testutil.NewCert(t, notAfter)
+	testutil.WriteCert(t, dir, certPEM, keyPEM)
+	if err := watcher.Reload(); err != nil {
+		t.Errorf("Watcher.Reload() returned an unexpected error: %v", err)
+		return
+	}
+	if err := watcher.ReloadError(); err != nil {
+		t.Errorf("Watcher.ReloadError() returned an unexpected error after the successful reload: %v", err)
+	}
+	if got := watcher.Certificate().NotAfter; !got.Equal(notAfter) {
+		t.Errorf("Watcher.Certificate().NotAfter = %v, but expected = %v", got, notAfter)
+	}
+
+	// Certificate not matching the key is not loaded
+	certPEM, _ = testutil.NewCert(t, time.Now().Add(48*time.Hour))
+	_, keyPEM = testutil.NewCert(t, time.Now().Add(48*time.Hour))
+	testutil.WriteCert(t, dir, certPEM, keyPEM)
+	if err := watcher.Reload(); err == nil {
+		t.Errorf("Watcher.Reload() returned nil for the mismatched key pair, instead of error")
+	}
+	if got := watcher.Certificate().NotAfter; !got.Equal(notAfter) {
+		t.Errorf("Watcher.Certificate().NotAfter = %v, but expected the previous certificate = %v", got, notAfter)
+	}
+}
+
+func TestWatcherStart(t *testing.T) {
+	dir := t.TempDir()
+	initialNotAfter := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	certPEM, keyPEM := testutil.NewCert(t, initialNotAfter)
+	testutil.WriteCert(t, dir, certPEM, keyPEM)
+	watcher := &Watcher{CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key"), Log: logger, CheckInterval: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		if err := watcher.Start(ctx); err != nil {
+			t.Errorf("Watcher.Start() returned an unexpected error: %v", err)
+		}
+	}()
+
+	waitFor := func(notAfter time.Time) bool {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if cert := watcher.Certificate(); cert != nil && cert.NotAfter.Equal(notAfter) {
+				return true
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		return false
+	}
+
+	// Initial certificate is loaded once the directory is watched, so the rotation is not missed after it
+	if !waitFor(initialNotAfter) {
+		t.Errorf("Watcher did not load the initial certificate")
+		return
+	}
+
+	// Rotated certificate is reloaded
+	notAfter := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	certPEM, keyPEM = testutil.NewCert(t, notAfter)
+	testutil.WriteCert(t, dir, certPEM, keyPEM)
+	if !waitFor(notAfter) {
+		t.Errorf("Watcher did not reload the rotated certificate, notAfter = %v", watcher.Certificate().NotAfter)
+	}
+}
+
+func TestCheckCABundle(t *testing.T) {
+	certPEM, keyPEM := testutil.NewCert(t, time.Now().Add(24*time.Hour))
+	otherCertPEM, _ := testutil.NewCert(t, time.Now().Add(24*time.Hour))
+
+	tests := []struct {
+		name       string
+		caBundle   []byte
+		wantEvents int
+	}{
+		{
+			name:       "caBundle verifies the serving certificate",
+			caBundle:   certPEM,
+			wantEvents: 0,
+		},
+		{
+			name:       "caBundle of the other CA",
+			caBundle:   otherCertPEM,
+			wantEvents: 1,
+		},
+		{
+			name:       "Empty caBundle",
+			caBundle:   nil,
+			wantEvents: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			testutil.WriteCert(t, dir, certPEM, keyPEM)
+			k8sClient, err := testutil.NewFakeK8sClient(&admissionregistrationv1.MutatingWebhookConfiguration{
+				ObjectMeta: v1.ObjectMeta{Name: "lm-k8s-webhook-mutating-webhook-configuration"},
+				Webhooks: []admissionregistrationv1.MutatingWebhook{{
+					Name:         "lm-k8s-webhook.default.svc.cluster.local",
+					ClientConfig: admissionregistrationv1.WebhookClientConfig{CABundle: tt.caBundle},
+				}},
+			})
+			if err != nil {
+				t.Errorf("Error occured in getting fake k8s client: %v", err)
+				return
+			}
+			recorder := record.NewFakeRecorder(10)
+			watcher := &Watcher{
+				CertFile:          filepath.Join(dir, "tls.crt"),
+				KeyFile:           filepath.Join(dir, "tls.key"),
+				Log:               logger,
+				Client:            k8sClient,
+				Recorder:          recorder,
+				WebhookConfigName: "lm-k8s-webhook-mutating-webhook-configuration",
+				CheckInterval:     time.Minute,
+			}
+			watcher.reload(context.Background())
+
+			if events := len(recorder.Events); events != tt.wantEvents {
+				t.Errorf("checkCABundle() emitted %d events, but expected = %d", events, tt.wantEvents)
+			}
+			if tt.wantEvents > 0 {
+				if event := <-recorder.Events; !strings.Contains(event, EventReasonCABundleMismatch) {
+					t.Errorf("checkCABundle() emitted event = %s, but expected the reason = %s", event, EventReasonCABundleMismatch)
+				}
+			}
+		})
+	}
+}
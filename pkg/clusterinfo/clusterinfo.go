@@ -0,0 +1,244 @@
+package clusterinfo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/metrics"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Source represents the strategy used for discovering the cluster name
+type Source string
+
+const (
+	// SourceFlag discovers the cluster name from the --cluster-name flag or the CLUSTER_NAME env variable
+	SourceFlag Source = "flag"
+
+	// SourceConfigMap discovers the cluster name from the configured config map
+	SourceConfigMap Source = "configMap"
+
+	// SourceNamespaceAnnotation discovers the cluster name from the ClusterNameAnnotation of the kube-system namespace
+	SourceNamespaceAnnotation Source = "namespaceAnnotation"
+
+	// SourceNodeLabel discovers the cluster name from the cluster name labels set on the nodes by the cloud providers
+	SourceNodeLabel Source = "nodeLabel"
+
+	// SourceNamespaceUID uses the UID of the kube-system namespace as the cluster name
+	SourceNamespaceUID Source = "namespaceUID"
+
+	// ClusterNameEnv is the env variable holding the cluster name
+	ClusterNameEnv = "CLUSTER_NAME"
+
+	// ClusterNameAnnotation is the annotation of the kube-system namespace holding the cluster name
+	ClusterNameAnnotation = "lm-k8s-webhook/cluster-name"
+
+	// DefaultConfigMapKey is the key of the config map holding the cluster name, if key is not specified
+	DefaultConfigMapKey = "cluster_name"
+
+	// AKSClusterLabel is the node label set by AKS, holding the node resource group (MC_<resource group>_<cluster>_<region>)
+	AKSClusterLabel = "kubernetes.azure.com/cluster"
+
+	kubeSystemNamespace = "kube-system"
+)
+
+// DefaultOrder is the order in which the discovery strategies are tried, if order is not specified
+var DefaultOrder = []Source{SourceFlag, SourceConfigMap, SourceNamespaceAnnotation, SourceNodeLabel, SourceNamespaceUID}
+
+// NodeLabels are the node labels set by the cloud providers (EKS & GKE), holding the cluster name
+var NodeLabels = []string{
+	"alpha.eksctl.io/cluster-name",
+	"eks.amazonaws.com/cluster-name",
+	"cloud.google.com/gke-cluster-name",
+}
+
+var (
+	clusterInfoLock sync.RWMutex
+
+	clusterName   string
+	clusterSource Source
+)
+
+// Discoverer discovers the cluster name by trying the discovery strategies in the given order
+type Discoverer struct {
+	Client *config.K8sClient
+	Log    logr.Logger
+
+	// Order is the order in which the discovery strategies are tried
+	Order []Source
+
+	// ClusterName is the explicitly specified cluster name
+	ClusterName string
+
+	// ConfigMap is the config map holding the cluster name in "namespace/name" format
+	ConfigMap string
+
+	// ConfigMapKey is the key of the config map holding the cluster name
+	ConfigMapKey string
+}
+
+// ParseOrder parses the comma separated list of the discovery strategies
+func ParseOrder(order string) ([]Source, error) {
+	var sources []Source
+	for _, s := range strings.Split(order, ",") {
+		source := Source(strings.TrimSpace(s))
+		if source == "" {
+			continue
+		}
+		if !source.IsValid() {
+			return nil, fmt.Errorf("invalid cluster name discovery strategy: %s", source)
+		}
+		sources = append(sources, source)
+	}
+	if len(sources) == 0 {
+		return DefaultOrder, nil
+	}
+	return sources, nil
+}
+
+// IsValid checks if the discovery strategy is supported
+func (s Source) IsValid() bool {
+	for _, source := range DefaultOrder {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// Discover tries the discovery strategies in order, and sets the cluster name discovered by the first successful strategy
+func (d *Discoverer) Discover(ctx context.Context) (string, Source, error) {
+	order := d.Order
+	if len(order) == 0 {
+		order = DefaultOrder
+	}
+	for _, source := range order {
+		name, err := d.discover(ctx, source)
+		if err != nil {
+			d.Log.V(1).Info("cluster name discovery strategy failed", "source", source, "reason", err.Error())
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		setClusterName(name, source)
+		d.Log.Info("Discovered the cluster name", "clusterName", name, "source", source)
+		return name, source, nil
+	}
+	return "", "", fmt.Errorf("cluster name could not be discovered using any of the strategies: %v", order)
+}
+
+// discover discovers the cluster name using the given strategy
+func (d *Discoverer) discover(ctx context.Context, source Source) (string, error) {
+	switch source {
+	case SourceFlag:
+		if d.ClusterName != "" {
+			return d.ClusterName, nil
+		}
+		return os.Getenv(ClusterNameEnv), nil
+	case SourceConfigMap:
+		return d.fromConfigMap(ctx)
+	case SourceNamespaceAnnotation:
+		namespace, err := d.Client.Clientset.CoreV1().Namespaces().Get(ctx, kubeSystemNamespace, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return namespace.Annotations[ClusterNameAnnotation], nil
+	case SourceNodeLabel:
+		return d.fromNodeLabels(ctx)
+	case SourceNamespaceUID:
+		namespace, err := d.Client.Clientset.CoreV1().Namespaces().Get(ctx, kubeSystemNamespace, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return string(namespace.UID), nil
+	default:
+		return "", fmt.Errorf("invalid cluster name discovery strategy: %s", source)
+	}
+}
+
+// fromConfigMap reads the cluster name from the configured config map
+func (d *Discoverer) fromConfigMap(ctx context.Context) (string, error) {
+	if d.ConfigMap == "" {
+		return "", nil
+	}
+	parts := strings.SplitN(d.ConfigMap, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("config map must be specified in namespace/name format: %s", d.ConfigMap)
+	}
+	configMap, err := d.Client.Clientset.CoreV1().ConfigMaps(parts[0]).Get(ctx, parts[1], metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	key := d.ConfigMapKey
+	if key == "" {
+		key = DefaultConfigMapKey
+	}
+	return strings.TrimSpace(configMap.Data[key]), nil
+}
+
+// fromNodeLabels reads the cluster name from the cluster name labels of the nodes
+func (d *Discoverer) fromNodeLabels(ctx context.Context) (string, error) {
+	nodes, err := d.Client.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{Limit: 10})
+	if err != nil {
+		return "", err
+	}
+	for _, node := range nodes.Items {
+		for _, label := range NodeLabels {
+			if name := node.Labels[label]; name != "" {
+				return name, nil
+			}
+		}
+		if name := clusterFromNodeResourceGroup(node.Labels[AKSClusterLabel]); name != "" {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// clusterFromNodeResourceGroup parses the cluster name from the default node resource group of AKS (MC_<resource group>_<cluster>_<region>).
+// Region does not contain underscores, so the cluster name is the segment preceding it,
+// custom node resource groups not following the format are ignored.
+func clusterFromNodeResourceGroup(nodeResourceGroup string) string {
+	if !strings.HasPrefix(nodeResourceGroup, "MC_") {
+		return ""
+	}
+	parts := strings.Split(strings.TrimPrefix(nodeResourceGroup, "MC_"), "_")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[len(parts)-2]
+}
+
+// setClusterName sets the discovered cluster name and exposes its source as a metric
+func setClusterName(name string, source Source) {
+	clusterInfoLock.Lock()
+	defer clusterInfoLock.Unlock()
+	clusterName = name
+	clusterSource = source
+	metrics.ClusterNameInfo.Reset()
+	metrics.ClusterNameInfo.WithLabelValues(name, string(source)).Set(1)
+}
+
+// Name returns the discovered cluster name.
+// If the cluster name is not discovered, CLUSTER_NAME env variable is returned.
+func Name() string {
+	clusterInfoLock.RLock()
+	defer clusterInfoLock.RUnlock()
+	if clusterName == "" {
+		return os.Getenv(ClusterNameEnv)
+	}
+	return clusterName
+}
+
+// NameSource returns the strategy by which the cluster name is discovered
+func NameSource() Source {
+	clusterInfoLock.RLock()
+	defer clusterInfoLock.RUnlock()
+	return clusterSource
+}
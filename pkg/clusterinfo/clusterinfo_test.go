@@ -0,0 +1,164 @@
+package clusterinfo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/logicmonitor/lm-k8s-webhook/internal/testutil"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var logger = logf.Log.WithName("unit-tests")
+
+func newKubeSystemNamespace(annotations map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "kube-system", UID: "2b7c5a9e-kube-system", Annotations: annotations}}
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name       string
+		objects    []runtime.Object
+		discoverer Discoverer
+		wantName   string
+		wantSource Source
+		wantErr    bool
+	}{
+		{
+			name:       "Explicit cluster name",
+			objects:    []runtime.Object{newKubeSystemNamespace(nil)},
+			discoverer: Discoverer{ClusterName: "prod-cluster"},
+			wantName:   "prod-cluster",
+			wantSource: SourceFlag,
+		},
+		{
+			name: "Cluster name from config map",
+			objects: []runtime.Object{
+				newKubeSystemNamespace(nil),
+				&corev1.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "cluster-info", Namespace: "lm"}, Data: map[string]string{"cluster_name": "cm-cluster"}},
+			},
+			discoverer: Discoverer{ConfigMap: "lm/cluster-info"},
+			wantName:   "cm-cluster",
+			wantSource: SourceConfigMap,
+		},
+		{
+			name:       "Cluster name from kube-system namespace annotation",
+			objects:    []runtime.Object{newKubeSystemNamespace(map[string]string{ClusterNameAnnotation: "annotated-cluster"})},
+			discoverer: Discoverer{ConfigMap: "lm/missing"},
+			wantName:   "annotated-cluster",
+			wantSource: SourceNamespaceAnnotation,
+		},
+		{
+			name: "Cluster name from EKS node label",
+			objects: []runtime.Object{
+				newKubeSystemNamespace(nil),
+				&corev1.Node{ObjectMeta: v1.ObjectMeta{Name: "node-1", Labels: map[string]string{"alpha.eksctl.io/cluster-name": "eks-cluster"}}},
+			},
+			wantName:   "eks-cluster",
+			wantSource: SourceNodeLabel,
+		},
+		{
+			name: "Cluster name from GKE node label",
+			objects: []runtime.Object{
+				newKubeSystemNamespace(nil),
+				&corev1.Node{ObjectMeta: v1.ObjectMeta{Name: "node-1", Labels: map[string]string{"cloud.google.com/gke-cluster-name": "gke-cluster"}}},
+			},
+			wantName:   "gke-cluster",
+			wantSource: SourceNodeLabel,
+		},
+		{
+			name: "Cluster name from AKS node resource group label",
+			objects: []runtime.Object{
+				newKubeSystemNamespace(nil),
+				&corev1.Node{ObjectMeta: v1.ObjectMeta{Name: "node-1", Labels: map[string]string{AKSClusterLabel: "MC_prod_rg_aks-cluster_eastus"}}},
+			},
+			wantName:   "aks-cluster",
+			wantSource: SourceNodeLabel,
+		},
+		{
+			name: "Custom node resource group of AKS is ignored",
+			objects: []runtime.Object{
+				newKubeSystemNamespace(nil),
+				&corev1.Node{ObjectMeta: v1.ObjectMeta{Name: "node-1", Labels: map[string]string{AKSClusterLabel: "aks-nodes"}}},
+			},
+			wantName:   "2b7c5a9e-kube-system",
+			wantSource: SourceNamespaceUID,
+		},
+		{
+			name:       "Cluster name from kube-system namespace UID",
+			objects:    []runtime.Object{newKubeSystemNamespace(nil)},
+			wantName:   "2b7c5a9e-kube-system",
+			wantSource: SourceNamespaceUID,
+		},
+		{
+			name:       "Custom order",
+			objects:    []runtime.Object{newKubeSystemNamespace(map[string]string{ClusterNameAnnotation: "annotated-cluster"})},
+			discoverer: Discoverer{ClusterName: "prod-cluster", Order: []Source{SourceNamespaceUID, SourceFlag}},
+			wantName:   "2b7c5a9e-kube-system",
+			wantSource: SourceNamespaceUID,
+		},
+		{
+			name:       "Cluster name not discovered",
+			discoverer: Discoverer{Order: []Source{SourceNamespaceAnnotation, SourceNamespaceUID}},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k8sClient, err := testutil.NewFakeK8sClient(tt.objects...)
+			if err != nil {
+				t.Errorf("Error occurred in getting fake k8s client: %v", err)
+				return
+			}
+			discoverer := tt.discoverer
+			discoverer.Client = k8sClient
+			discoverer.Log = logger
+
+			name, source, err := discoverer.Discover(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Discover() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if name != tt.wantName || source != tt.wantSource {
+				t.Errorf("Discover() = %s, %s, but expected = %s, %s", name, source, tt.wantName, tt.wantSource)
+			}
+			if Name() != tt.wantName || NameSource() != tt.wantSource {
+				t.Errorf("Name(), NameSource() = %s, %s, but expected = %s, %s", Name(), NameSource(), tt.wantName, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		order   string
+		want    []Source
+		wantErr bool
+	}{
+		{name: "Empty order", order: "", want: DefaultOrder},
+		{name: "Custom order", order: "nodeLabel, flag", want: []Source{SourceNodeLabel, SourceFlag}},
+		{name: "Invalid strategy", order: "flag,dns", wantErr: true},
+		{name: "Kubeconfig strategy is not supported", order: "flag,kubeconfig", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOrder(tt.order)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseOrder() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseOrder() = %v, but expected = %v", got, tt.want)
+			}
+		})
+	}
+}
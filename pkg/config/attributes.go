@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// attributeMappingRegexps holds the compiled regexes of the attribute mappings of the loaded config, keyed by the expression
+var attributeMappingRegexps = map[string]*regexp.Regexp{}
+
+// AttributeMappingSource represents the pod metadata, whose entries are mapped to the resource attributes
+type AttributeMappingSource string
+
+const (
+	// AttributeMappingSourceLabel maps the pod labels
+	AttributeMappingSourceLabel AttributeMappingSource = "label"
+
+	// AttributeMappingSourceAnnotation maps the pod annotations
+	AttributeMappingSourceAnnotation AttributeMappingSource = "annotation"
+)
+
+// AttributeMapping maps the pod labels or annotations matching the allow regexes, and not matching the deny regexes, to the resource attributes
+type AttributeMapping struct {
+	Source AttributeMappingSource `yaml:"source"`
+
+	// Allow holds the regexes matched against the label or annotation keys, all the keys are allowed if not specified
+	Allow []string `yaml:"allow,omitempty"`
+
+	// Deny holds the regexes matched against the label or annotation keys, it takes precedence over allow
+	Deny []string `yaml:"deny,omitempty"`
+
+	// Rewrite rewrites the label or annotation key to the resource attribute key
+	Rewrite *KeyRewrite `yaml:"rewrite,omitempty"`
+
+	// AttributePrefix is prepended to the rewritten key
+	AttributePrefix string `yaml:"attributePrefix,omitempty"`
+
+	// MaxAttributes is the max number of resource attributes added by the mapping, defaults to DefaultMaxMappedAttributes
+	MaxAttributes int `yaml:"maxAttributes,omitempty"`
+}
+
+// KeyRewrite replaces the key matching the regex with the replacement, which can refer to the regex groups as $1
+type KeyRewrite struct {
+	Match       string `yaml:"match"`
+	Replacement string `yaml:"replacement"`
+}
+
+// DefaultMaxMappedAttributes is the max number of resource attributes added by a mapping, if not specified
+const DefaultMaxMappedAttributes = 32
+
+// GetAttributeMappingRegexp returns the compiled regex of the attribute mapping
+func GetAttributeMappingRegexp(expression string) (*regexp.Regexp, error) {
+	configLock.RLock()
+	exp, ok := attributeMappingRegexps[expression]
+	configLock.RUnlock()
+	if ok {
+		return exp, nil
+	}
+	return regexp.Compile(expression)
+}
+
+// compileAttributeMappings validates the attribute mappings of the mutation config and compiles their regexes
+func compileAttributeMappings(mutationConfig MutationConfig) (map[string]*regexp.Regexp, error) {
+	regexps := map[string]*regexp.Regexp{}
+	for idx, mapping := range mutationConfig.AttributeMappings {
+		if mapping.Source != AttributeMappingSourceLabel && mapping.Source != AttributeMappingSourceAnnotation {
+			return nil, fmt.Errorf("invalid source %q of attribute mapping %d", mapping.Source, idx)
+		}
+		if mapping.MaxAttributes < 0 {
+			return nil, fmt.Errorf("maxAttributes of attribute mapping %d can not be negative", idx)
+		}
+		expressions := append(append([]string{}, mapping.Allow...), mapping.Deny...)
+		if mapping.Rewrite != nil {
+			expressions = append(expressions, mapping.Rewrite.Match)
+		}
+		for _, expression := range expressions {
+			exp, err := regexp.Compile(expression)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex of attribute mapping %d: %w", idx, err)
+			}
+			regexps[expression] = exp
+		}
+	}
+	return regexps, nil
+}
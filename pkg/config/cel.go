@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+)
+
+const (
+	// celCostLimit is the max runtime cost allowed for evaluating a when expression
+	celCostLimit = 10000
+
+	// celInterruptCheckFrequency is the number of comprehension iterations after which the evaluation checks for the cancellation
+	celInterruptCheckFrequency = 100
+)
+
+var (
+	// whenPrograms holds the compiled when expressions of the loaded config, keyed by the expression
+	whenPrograms = map[string]cel.Program{}
+
+	// celEnv declares the variables, against which when expressions are evaluated, namespace is a reserved word in CEL
+	celEnv, celEnvErr = cel.NewEnv(
+		cel.Variable("pod", cel.DynType),
+		cel.Variable("namespaceObject", cel.DynType),
+		cel.Variable("owner", cel.DynType),
+	)
+)
+
+// GetWhenProgram returns the compiled program of the when expression
+func GetWhenProgram(expression string) (cel.Program, error) {
+	configLock.RLock()
+	program, ok := whenPrograms[expression]
+	configLock.RUnlock()
+	if ok {
+		return program, nil
+	}
+	return compileWhenExpression(expression)
+}
+
+// HasWhenExpressions checks if the loaded config has any when expression
+func HasWhenExpressions() bool {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return len(whenPrograms) > 0
+}
+
+// compileWhenExpression compiles the when expression, which must evaluate to bool
+func compileWhenExpression(expression string) (cel.Program, error) {
+	if celEnvErr != nil {
+		return nil, celEnvErr
+	}
+	ast, issues := celEnv.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if !cel.BoolType.IsAssignableType(ast.OutputType()) {
+		return nil, fmt.Errorf("expression must evaluate to bool, but evaluates to %s", ast.OutputType())
+	}
+	return celEnv.Program(ast,
+		cel.EvalOptions(cel.OptOptimize),
+		cel.CostLimit(celCostLimit),
+		cel.InterruptCheckFrequency(celInterruptCheckFrequency),
+	)
+}
+
+// compileWhenExpressions compiles all the when expressions of the mutation config
+func compileWhenExpressions(mutationConfig MutationConfig) (map[string]cel.Program, error) {
+	programs := map[string]cel.Program{}
+
+	expressions := map[string]string{}
+	for _, resourceEnv := range mutationConfig.LMEnvVars.Resource {
+		expressions[resourceEnv.When] = resourceEnv.Env.Name
+	}
+	for _, operationEnv := range mutationConfig.LMEnvVars.Operation {
+		expressions[operationEnv.When] = operationEnv.Env.Name
+	}
+
+	for expression, envName := range expressions {
+		if expression == "" {
+			continue
+		}
+		program, err := compileWhenExpression(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid when expression of env variable %s: %w", envName, err)
+		}
+		programs[expression] = program
+	}
+	return programs, nil
+}
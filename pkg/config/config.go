@@ -1,22 +1,39 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/ghodss/yaml"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/metrics"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	logr "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 var (
 	configLock = new(sync.RWMutex)
 	cfg        Config
+	cfgInfo    Info
+	loadErr    error
 	logger     = logr.Log.WithName(("config-loader"))
 )
 
+// Info holds the details of the loaded external config
+type Info struct {
+	// Hash is the SHA-256 hash of the config file
+	Hash string
+
+	// LoadTime is the time at which the config is loaded
+	LoadTime time.Time
+}
+
 // Config holds the external configuration
 type Config struct {
 	MutationConfigProvided bool
@@ -25,7 +42,216 @@ type Config struct {
 
 // MutationConfig holds the mutation config
 type MutationConfig struct {
-	LMEnvVars LMEnvVars `yaml:"lmEnvVars"`
+	LMEnvVars           LMEnvVars           `yaml:"lmEnvVars"`
+	Rollout             Rollout             `yaml:"rollout,omitempty"`
+	NamespaceAttributes NamespaceAttributes `yaml:"namespaceAttributes,omitempty"`
+	ServiceVersion      ServiceVersion      `yaml:"serviceVersion,omitempty"`
+	AttributeMappings   []AttributeMapping  `yaml:"attributeMappings,omitempty"`
+	DefaultAttributes   DefaultAttributes   `yaml:"defaultAttributes,omitempty"`
+	SemanticConventions SemanticConventions `yaml:"semanticConventions,omitempty"`
+	Collector           Collector           `yaml:"collector,omitempty"`
+	Profiles            map[string]Profile  `yaml:"profiles,omitempty"`
+	Containers          Containers          `yaml:"containers,omitempty"`
+	CustomResources     []CustomResource    `yaml:"customResources,omitempty"`
+
+	// EmitOTELServiceName injects OTEL_SERVICE_NAME with the value of SERVICE_NAME
+	EmitOTELServiceName bool `yaml:"emitOTELServiceName,omitempty"`
+}
+
+// Profile is a named set of the OpenTelemetry SDK env variables, which the pod selects using the profile annotation
+type Profile struct {
+	// Env holds the env variables of the profile
+	Env []corev1.EnvVar `yaml:"env,omitempty"`
+
+	// Collector overrides the collector config for the pods selecting the profile
+	Collector *Collector `yaml:"collector,omitempty"`
+
+	// ServiceVersion overrides the service version config for the pods selecting the profile
+	ServiceVersion *ServiceVersion `yaml:"serviceVersion,omitempty"`
+}
+
+// CollectorMode represents how the application pods reach the LM OTel collector
+type CollectorMode string
+
+const (
+	// CollectorModeService leaves the exporter endpoint as configured through the env variables, which is typically a central collector service
+	CollectorModeService CollectorMode = "service"
+
+	// CollectorModeNodeLocal points the exporter endpoint to the collector running as a DaemonSet on the same node, using the host IP
+	CollectorModeNodeLocal CollectorMode = "nodeLocal"
+)
+
+// Collector holds the config of the LM OTel collector endpoint injected into the application pods
+type Collector struct {
+	Mode CollectorMode `yaml:"mode,omitempty"`
+
+	// Protocol is the OTLP protocol, grpc or http/protobuf, defaults to grpc
+	Protocol string `yaml:"protocol,omitempty"`
+
+	// GRPCPort is the OTLP gRPC port of the node-local collector, defaults to 4317
+	GRPCPort int `yaml:"grpcPort,omitempty"`
+
+	// HTTPPort is the OTLP HTTP port of the node-local collector, defaults to 4318
+	HTTPPort int `yaml:"httpPort,omitempty"`
+
+	// OverrideDisabled decides if the endpoint env variables specified in the container are overridden
+	OverrideDisabled bool `yaml:"overrideDisabled,omitempty"`
+}
+
+// OTLP protocols
+const (
+	OTLPProtocolGRPC         = "grpc"
+	OTLPProtocolHTTPProtobuf = "http/protobuf"
+)
+
+// validateCollector checks if the collector mode & protocol are supported
+func validateCollector(mutationConfig MutationConfig) error {
+	collector := mutationConfig.Collector
+	switch collector.Mode {
+	case "", CollectorModeService, CollectorModeNodeLocal:
+	default:
+		return fmt.Errorf("invalid collector mode %q", collector.Mode)
+	}
+	switch collector.Protocol {
+	case "", OTLPProtocolGRPC, OTLPProtocolHTTPProtobuf:
+	default:
+		return fmt.Errorf("invalid collector protocol %q", collector.Protocol)
+	}
+	if collector.GRPCPort < 0 || collector.GRPCPort > 65535 || collector.HTTPPort < 0 || collector.HTTPPort > 65535 {
+		return fmt.Errorf("invalid collector port, grpcPort: %d, httpPort: %d", collector.GRPCPort, collector.HTTPPort)
+	}
+	return nil
+}
+
+// ContainerTargetMode represents which containers of the pod are mutated
+type ContainerTargetMode string
+
+const (
+	// ContainerTargetModeFirst mutates the first container of the pod
+	ContainerTargetModeFirst ContainerTargetMode = "first"
+
+	// ContainerTargetModeAll mutates all the containers of the pod
+	ContainerTargetModeAll ContainerTargetMode = "all"
+
+	// ContainerTargetModeNamed mutates the containers whose names are listed
+	ContainerTargetModeNamed ContainerTargetMode = "named"
+)
+
+// Containers holds the config of the containers to be mutated
+type Containers struct {
+	// Mode is first, all or named, defaults to first
+	Mode ContainerTargetMode `yaml:"mode,omitempty"`
+
+	// Names are the names of the containers to be mutated in the named mode
+	Names []string `yaml:"names,omitempty"`
+
+	// InitContainers decides if the init containers are mutated as well, in the named mode only the listed ones are mutated
+	InitContainers bool `yaml:"initContainers,omitempty"`
+}
+
+// validateContainers checks if the container target mode is supported and the names are specified for the named mode
+func validateContainers(mutationConfig MutationConfig) error {
+	containers := mutationConfig.Containers
+	switch containers.Mode {
+	case "", ContainerTargetModeFirst, ContainerTargetModeAll:
+	case ContainerTargetModeNamed:
+		if len(containers.Names) == 0 {
+			return fmt.Errorf("container names must be specified for the %q container target mode", containers.Mode)
+		}
+	default:
+		return fmt.Errorf("invalid container target mode %q", containers.Mode)
+	}
+	return nil
+}
+
+// DefaultAttributes customizes the default resource attributes set by the webhook in OTEL_RESOURCE_ATTRIBUTES
+type DefaultAttributes struct {
+	// Rename renames the default attribute keys, keyed by the default key
+	Rename map[string]string `yaml:"rename,omitempty"`
+
+	// Drop drops the default attributes
+	Drop []string `yaml:"drop,omitempty"`
+
+	// Add adds the attributes to the default ones, value can refer to the env variables managed by the webhook as $(LM_APM_POD_NAME)
+	Add []Attribute `yaml:"add,omitempty"`
+}
+
+// Attribute represents a resource attribute
+type Attribute struct {
+	Key   string `yaml:"key"`
+	Value string `yaml:"value"`
+}
+
+// ServiceVersion holds the config of the service.version resource attribute derived at the admission time
+type ServiceVersion struct {
+	// Disabled turns off the derivation of the service.version
+	Disabled bool `yaml:"disabled,omitempty"`
+
+	// Sources are tried in order, the first source with a non empty value is used
+	Sources []ServiceVersionSource `yaml:"sources,omitempty"`
+}
+
+// ServiceVersionSourceType represents the type of the source of the service.version
+type ServiceVersionSourceType string
+
+const (
+	// ServiceVersionSourceLabel derives the service.version from the pod label
+	ServiceVersionSourceLabel ServiceVersionSourceType = "label"
+
+	// ServiceVersionSourceAnnotation derives the service.version from the pod annotation
+	ServiceVersionSourceAnnotation ServiceVersionSourceType = "annotation"
+
+	// ServiceVersionSourceImageTag derives the service.version from the image tag of the application container
+	ServiceVersionSourceImageTag ServiceVersionSourceType = "imageTag"
+
+	// ServiceVersionSourceImageDigest derives the service.version from the image digest of the application container
+	ServiceVersionSourceImageDigest ServiceVersionSourceType = "imageDigest"
+)
+
+// ServiceVersionSource represents a source of the service.version, name is the label or annotation name
+type ServiceVersionSource struct {
+	Type ServiceVersionSourceType `yaml:"type"`
+	Name string                   `yaml:"name,omitempty"`
+}
+
+// IsEnabled checks if the service.version is to be derived
+func (s ServiceVersion) IsEnabled() bool {
+	return !s.Disabled && len(s.Sources) > 0
+}
+
+// NamespaceAttributes holds the config of the resource attributes derived from the labels or annotations of the pod namespace
+type NamespaceAttributes struct {
+	// ServiceNamespace is the source of the service.namespace resource attribute
+	ServiceNamespace NamespaceAttributeSource `yaml:"serviceNamespace,omitempty"`
+
+	// DeploymentEnvironment is the source of the deployment.environment resource attribute
+	DeploymentEnvironment NamespaceAttributeSource `yaml:"deploymentEnvironment,omitempty"`
+}
+
+// NamespaceAttributeSource represents the label or annotation of the namespace holding the attribute value, label takes precedence over annotation
+type NamespaceAttributeSource struct {
+	Label      string `yaml:"label,omitempty"`
+	Annotation string `yaml:"annotation,omitempty"`
+}
+
+// IsEmpty checks if neither label nor annotation is specified
+func (s NamespaceAttributeSource) IsEmpty() bool {
+	return s.Label == "" && s.Annotation == ""
+}
+
+// Rollout holds the config of the rollout of the running workloads, which is triggered when the reloaded config changes the injected env variables
+type Rollout struct {
+	// Enabled turns on the restart of the workloads whose pods would get different env variables under the reloaded config
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// BatchSize is the number of workloads restarted at once, defaults to 1
+	BatchSize int `yaml:"batchSize,omitempty"`
+
+	// BatchInterval is the wait time between two batches
+	BatchInterval metav1.Duration `yaml:"batchInterval,omitempty"`
+
+	// RespectPodDisruptionBudgets skips the restart of the workloads covered by a PodDisruptionBudget which does not allow any disruption
+	RespectPodDisruptionBudgets bool `yaml:"respectPodDisruptionBudgets,omitempty"`
 }
 
 // LMEnvVars holds the env variables for mutation
@@ -39,6 +265,11 @@ type LMEnvVars struct {
 	which will not be the part of OTEL_RESOURCE_ATTRIBUTES.
 	*/
 	Operation []OperationEnv `yaml:"operation,omitempty"`
+
+	/* EnvFrom holds the secrets & config maps,
+	all the keys of which will be injected as environment variables.
+	*/
+	EnvFrom []EnvFromSource `yaml:"envFrom,omitempty"`
 }
 
 // ResourceEnv represents the env variables which will be passed as a resource attributes with OTEL_RESOURCE_ATTRIBUTES env variable
@@ -46,16 +277,168 @@ type ResourceEnv struct {
 	Env              corev1.EnvVar `yaml:"env"`
 	ResAttrName      string        `yaml:"resAttrName,omitempty"`
 	OverrideDisabled bool          `yaml:"overrideDisabled,omitempty"`
+
+	// When is the CEL expression evaluated against the pod, its namespace & owner, env variable is injected only if it evaluates to true
+	When string `yaml:"when,omitempty"`
+
+	// MergeStrategy decides how the env variable is merged with the same name env variable of the container, it takes precedence over OverrideDisabled
+	MergeStrategy MergeStrategy `yaml:"mergeStrategy,omitempty"`
+
+	// Separator is used by the append, prepend & mergeKeyValue merge strategies
+	Separator string `yaml:"separator,omitempty"`
+
+	// CopyFromWebhookNamespace copies the secret referred by secretKeyRef from the webhook namespace into the pod namespace, if not present
+	CopyFromWebhookNamespace bool `yaml:"copyFromWebhookNamespace,omitempty"`
 }
 
 // OperationEnv represents the env variables that will be used by application, without passing it as a resource attribute
 type OperationEnv struct {
 	Env              corev1.EnvVar `yaml:"env"`
 	OverrideDisabled bool          `yaml:"overrideDisabled,omitempty"`
+
+	// When is the CEL expression evaluated against the pod, its namespace & owner, env variable is injected only if it evaluates to true
+	When string `yaml:"when,omitempty"`
+
+	// MergeStrategy decides how the env variable is merged with the same name env variable of the container, it takes precedence over OverrideDisabled
+	MergeStrategy MergeStrategy `yaml:"mergeStrategy,omitempty"`
+
+	// Separator is used by the append, prepend & mergeKeyValue merge strategies
+	Separator string `yaml:"separator,omitempty"`
+
+	// CopyFromWebhookNamespace copies the secret referred by secretKeyRef from the webhook namespace into the pod namespace, if not present
+	CopyFromWebhookNamespace bool `yaml:"copyFromWebhookNamespace,omitempty"`
+}
+
+// EnvFromSource represents the secret or config map, all the keys of which are injected as env variables
+type EnvFromSource struct {
+	corev1.EnvFromSource `yaml:",inline"`
+
+	// CopyFromWebhookNamespace copies the secret referred by secretRef from the webhook namespace into the pod namespace, if not present
+	CopyFromWebhookNamespace bool `yaml:"copyFromWebhookNamespace,omitempty"`
+}
+
+// MergeStrategy represents the strategy of merging the injected env variable with the same name env variable of the container
+type MergeStrategy string
+
+const (
+	// MergeStrategyReplace replaces the value of the container env variable with the injected one
+	MergeStrategyReplace MergeStrategy = "replace"
+
+	// MergeStrategyKeepExisting keeps the value of the container env variable
+	MergeStrategyKeepExisting MergeStrategy = "keepExisting"
+
+	// MergeStrategyAppend appends the injected value to the value of the container env variable
+	MergeStrategyAppend MergeStrategy = "append"
+
+	// MergeStrategyPrepend prepends the injected value to the value of the container env variable
+	MergeStrategyPrepend MergeStrategy = "prepend"
+
+	// MergeStrategyMergeKeyValue merges the key=value pairs of the injected value with the ones of the container env variable, injected keys take precedence
+	MergeStrategyMergeKeyValue MergeStrategy = "mergeKeyValue"
+)
+
+// IsValid checks if the merge strategy is one of the supported strategies, empty strategy is valid
+func (m MergeStrategy) IsValid() bool {
+	switch m {
+	case "", MergeStrategyReplace, MergeStrategyKeepExisting, MergeStrategyAppend, MergeStrategyPrepend, MergeStrategyMergeKeyValue:
+		return true
+	}
+	return false
+}
+
+// validateMergeStrategies checks if the env variables of the mutation config use the supported merge strategies
+func validateMergeStrategies(mutationConfig MutationConfig) error {
+	for _, resourceEnv := range mutationConfig.LMEnvVars.Resource {
+		if !resourceEnv.MergeStrategy.IsValid() {
+			return fmt.Errorf("invalid merge strategy %q of env variable %s", resourceEnv.MergeStrategy, resourceEnv.Env.Name)
+		}
+	}
+	for _, operationEnv := range mutationConfig.LMEnvVars.Operation {
+		if !operationEnv.MergeStrategy.IsValid() {
+			return fmt.Errorf("invalid merge strategy %q of env variable %s", operationEnv.MergeStrategy, operationEnv.Env.Name)
+		}
+	}
+	return nil
+}
+
+// validateServiceVersion checks if the service.version sources are supported and specify the name where required
+func validateServiceVersion(mutationConfig MutationConfig) error {
+	for _, source := range mutationConfig.ServiceVersion.Sources {
+		switch source.Type {
+		case ServiceVersionSourceLabel, ServiceVersionSourceAnnotation:
+			if source.Name == "" {
+				return fmt.Errorf("name of the %s source of service version is not specified", source.Type)
+			}
+		case ServiceVersionSourceImageTag, ServiceVersionSourceImageDigest:
+		default:
+			return fmt.Errorf("invalid service version source type %q", source.Type)
+		}
+	}
+	return nil
 }
 
-// LoadConfig loads the external config passed by the user
+// validateDefaultAttributes checks if the keys of the default attributes customization are not empty
+func validateDefaultAttributes(mutationConfig MutationConfig) error {
+	for key, newKey := range mutationConfig.DefaultAttributes.Rename {
+		if key == "" || newKey == "" {
+			return fmt.Errorf("invalid rename of default attribute %q to %q", key, newKey)
+		}
+	}
+	for _, attr := range mutationConfig.DefaultAttributes.Add {
+		if attr.Key == "" {
+			return fmt.Errorf("key of the added default attribute with value %q is not specified", attr.Value)
+		}
+	}
+	return nil
+}
+
+// validateProfiles checks if the profile names & the env variable names of the profiles are not empty
+func validateProfiles(mutationConfig MutationConfig) error {
+	for name, profile := range mutationConfig.Profiles {
+		if name == "" {
+			return fmt.Errorf("profile name can not be empty")
+		}
+		for _, env := range profile.Env {
+			if env.Name == "" {
+				return fmt.Errorf("name of the env variable of profile %s is not specified", name)
+			}
+		}
+		if profile.Collector != nil {
+			if err := validateCollector(MutationConfig{Collector: *profile.Collector}); err != nil {
+				return fmt.Errorf("invalid collector of profile %s: %w", name, err)
+			}
+		}
+		if profile.ServiceVersion != nil {
+			if err := validateServiceVersion(MutationConfig{ServiceVersion: *profile.ServiceVersion}); err != nil {
+				return fmt.Errorf("invalid service version of profile %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadConfig loads the external config passed by the user, error of the attempt is kept until the next one
 func LoadConfig(configFilePath string) error {
+	err := loadConfig(configFilePath)
+
+	configLock.Lock()
+	defer configLock.Unlock()
+	// As external config is optional, missing config file is not an error
+	if os.IsNotExist(err) {
+		loadErr = nil
+	} else {
+		loadErr = err
+	}
+	if loadErr != nil {
+		metrics.ConfigLoadFailed.Set(1)
+	} else {
+		metrics.ConfigLoadFailed.Set(0)
+	}
+	return err
+}
+
+// loadConfig reads, validates & loads the external config
+func loadConfig(configFilePath string) error {
 	logger = logr.Log.WithName(("load-config"))
 
 	// Check if config file provided
@@ -74,9 +457,62 @@ func LoadConfig(configFilePath string) error {
 		logger.Error(err, "Error in reading the config file", "configFilePath", configFilePath)
 		return err
 	}
+	if err := validateMergeStrategies(tempCfg); err != nil {
+		logger.Error(err, "Error in validating the config file", "configFilePath", configFilePath)
+		return err
+	}
+	if err := validateDefaultAttributes(tempCfg); err != nil {
+		logger.Error(err, "Error in validating the config file", "configFilePath", configFilePath)
+		return err
+	}
+	if err := validateProfiles(tempCfg); err != nil {
+		logger.Error(err, "Error in validating the config file", "configFilePath", configFilePath)
+		return err
+	}
+	if err := validateCollector(tempCfg); err != nil {
+		logger.Error(err, "Error in validating the config file", "configFilePath", configFilePath)
+		return err
+	}
+	if err := validateContainers(tempCfg); err != nil {
+		logger.Error(err, "Error in validating the config file", "configFilePath", configFilePath)
+		return err
+	}
+	if err := validateCustomResources(tempCfg); err != nil {
+		logger.Error(err, "Error in validating the config file", "configFilePath", configFilePath)
+		return err
+	}
+	if err := validateSemanticConventions(tempCfg); err != nil {
+		logger.Error(err, "Error in validating the config file", "configFilePath", configFilePath)
+		return err
+	}
+	if err := validateServiceVersion(tempCfg); err != nil {
+		logger.Error(err, "Error in validating the config file", "configFilePath", configFilePath)
+		return err
+	}
+	tempEnvTemplates, err := parseEnvTemplates(tempCfg)
+	if err != nil {
+		logger.Error(err, "Error in validating the config file", "configFilePath", configFilePath)
+		return err
+	}
+	tempWhenPrograms, err := compileWhenExpressions(tempCfg)
+	if err != nil {
+		logger.Error(err, "Error in validating the config file", "configFilePath", configFilePath)
+		return err
+	}
+	tempAttributeMappingRegexps, err := compileAttributeMappings(tempCfg)
+	if err != nil {
+		logger.Error(err, "Error in validating the config file", "configFilePath", configFilePath)
+		return err
+	}
+
+	hash := sha256.Sum256(data)
 
 	configLock.Lock()
 	cfg.MutationConfig = tempCfg
+	cfgInfo = Info{Hash: hex.EncodeToString(hash[:]), LoadTime: time.Now()}
+	envTemplates = tempEnvTemplates
+	whenPrograms = tempWhenPrograms
+	attributeMappingRegexps = tempAttributeMappingRegexps
 	cfg.MutationConfigProvided = true
 	// logger.Info("Config:", "Config", cfg)
 	configLock.Unlock()
@@ -84,6 +520,20 @@ func LoadConfig(configFilePath string) error {
 	return nil
 }
 
+// GetConfigInfo returns the details of the loaded external config, hash is empty if the config is not loaded
+func GetConfigInfo() Info {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return cfgInfo
+}
+
+// GetLoadError returns the error of the last attempt to load the external config, the previously loaded config is still in use if it is not nil
+func GetLoadError() error {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return loadErr
+}
+
 // GetConfig returns the external config object
 func GetConfig() Config {
 	configLock.RLock()
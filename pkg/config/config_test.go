@@ -1,11 +1,14 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	testclient "k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/rest"
@@ -90,6 +93,67 @@ func TestLoadConfig(t *testing.T) {
 			wantErr:     true,
 			wantPayload: Config{},
 		},
+
+		{
+			name:        "load config with invalid env value template",
+			args:        struct{ configFilePath string }{configFilePath: "testdata/config_with_invalid_template.yaml"},
+			wantErr:     true,
+			wantPayload: Config{},
+		},
+
+		{
+			name:        "load config with recursive env value template",
+			args:        struct{ configFilePath string }{configFilePath: "testdata/config_with_recursive_template.yaml"},
+			wantErr:     true,
+			wantPayload: Config{},
+		},
+
+		{
+			name:        "load config with invalid when expression",
+			args:        struct{ configFilePath string }{configFilePath: "testdata/config_with_invalid_when.yaml"},
+			wantErr:     true,
+			wantPayload: Config{},
+		},
+
+		{
+			name:        "load config with invalid merge strategy",
+			args:        struct{ configFilePath string }{configFilePath: "testdata/config_with_invalid_merge_strategy.yaml"},
+			wantErr:     true,
+			wantPayload: Config{},
+		},
+
+		{
+			name:        "load config with invalid service version source",
+			args:        struct{ configFilePath string }{configFilePath: "testdata/config_with_invalid_service_version.yaml"},
+			wantErr:     true,
+			wantPayload: Config{},
+		},
+
+		{
+			name:        "load config with invalid attribute mapping regex",
+			args:        struct{ configFilePath string }{configFilePath: "testdata/config_with_invalid_attribute_mapping.yaml"},
+			wantErr:     true,
+			wantPayload: Config{},
+		},
+
+		{
+			name:        "load config with unsupported semantic conventions version",
+			args:        struct{ configFilePath string }{configFilePath: "testdata/config_with_invalid_semconv_version.yaml"},
+			wantErr:     true,
+			wantPayload: Config{},
+		},
+		{
+			name:        "load config with named container target mode without names",
+			args:        struct{ configFilePath string }{configFilePath: "testdata/config_with_invalid_containers.yaml"},
+			wantErr:     true,
+			wantPayload: Config{},
+		},
+		{
+			name:        "load config with invalid pod spec path of the custom resource",
+			args:        struct{ configFilePath string }{configFilePath: "testdata/config_with_invalid_custom_resource.yaml"},
+			wantErr:     true,
+			wantPayload: Config{},
+		},
 	}
 
 	for _, tt := range tests {
@@ -197,6 +261,32 @@ func TestGetConfig(t *testing.T) {
 	}
 }
 
+func TestCompileWhenExpression(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		wantErr    bool
+	}{
+		{name: "Compile label based expression", expression: "pod.metadata.labels.tier == 'frontend'", wantErr: false},
+		{name: "Compile expression using namespace and owner", expression: "namespaceObject.metadata.name == 'default' && owner.kind == 'ReplicaSet'", wantErr: false},
+		{name: "Compile expression with syntax error", expression: "pod.metadata.labels.tier ==", wantErr: true},
+		{name: "Compile expression with undeclared variable", expression: "node.metadata.name == 'node-1'", wantErr: true},
+		{name: "Compile expression not evaluating to bool", expression: "'frontend'", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileWhenExpression(tt.expression)
+			if err == nil && tt.wantErr {
+				t.Errorf("compileWhenExpression() returned nil, instead of error")
+			}
+			if err != nil && !tt.wantErr {
+				t.Errorf("compileWhenExpression() returned an unexpected error: %+v", err)
+			}
+		})
+	}
+}
+
 func TestNewK8sClient(t *testing.T) {
 	tests := []struct {
 		name string
@@ -247,3 +337,96 @@ func TestNewK8sClient(t *testing.T) {
 		})
 	}
 }
+
+func TestNamespaceInformer(t *testing.T) {
+	k8sClient, err := NewK8sClient(nil, func(r *rest.Config) (kubernetes.Interface, error) {
+		return testclient.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}), nil
+	})
+	if err != nil {
+		t.Errorf("NewK8sClient() returned an unexpected error: %+v", err)
+		return
+	}
+	if k8sClient.NamespaceLister() != nil || k8sClient.NamespaceInformerSynced() {
+		t.Errorf("NamespaceLister() returned the lister before the informer is started, instead of nil")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- (&NamespaceInformer{Client: k8sClient}).Start(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !k8sClient.NamespaceInformerSynced() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !k8sClient.NamespaceInformerSynced() {
+		t.Errorf("NamespaceInformerSynced() = false, but expected = true")
+	}
+	if _, err := k8sClient.NamespaceLister().Get("default"); err != nil {
+		t.Errorf("NamespaceLister().Get() returned an unexpected error: %+v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("NamespaceInformer.Start() returned an unexpected error: %+v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("NamespaceInformer.Start() did not return after the context is done")
+	}
+}
+
+func TestGetSemconvKeys(t *testing.T) {
+	tests := []struct {
+		name                string
+		envName             string
+		semanticConventions SemanticConventions
+		wantKeys            []string
+		wantFound           bool
+	}{
+		{
+			name:      "Default version",
+			envName:   "DEPLOYMENT_ENVIRONMENT",
+			wantKeys:  []string{"deployment.environment"},
+			wantFound: true,
+		},
+		{
+			name:                "Renamed key in newer version",
+			envName:             "DEPLOYMENT_ENVIRONMENT",
+			semanticConventions: SemanticConventions{Version: "1.27.0"},
+			wantKeys:            []string{"deployment.environment.name"},
+			wantFound:           true,
+		},
+		{
+			name:                "Renamed key along with alias",
+			envName:             "DEPLOYMENT_ENVIRONMENT",
+			semanticConventions: SemanticConventions{Version: "1.27.0", EmitAliases: true},
+			wantKeys:            []string{"deployment.environment.name", "deployment.environment"},
+			wantFound:           true,
+		},
+		{
+			name:    "Mapping of config overrides built-in table",
+			envName: "SERVICE_NAME",
+			semanticConventions: SemanticConventions{EmitAliases: true, Mappings: []SemconvMapping{
+				{Env: "SERVICE_NAME", Key: "app.name", Aliases: []string{"service.name"}},
+			}},
+			wantKeys:  []string{"app.name", "service.name"},
+			wantFound: true,
+		},
+		{
+			name:    "Unknown env variable",
+			envName: "UNKNOWN",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, found := GetSemconvKeys(tt.envName, tt.semanticConventions)
+			if !cmp.Equal(keys, tt.wantKeys) || found != tt.wantFound {
+				t.Errorf("GetSemconvKeys() = %v, %v, but expected = %v, %v", keys, found, tt.wantKeys, tt.wantFound)
+			}
+		})
+	}
+}
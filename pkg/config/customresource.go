@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CustomResource registers the custom resource embedding the pod spec, which is mutated generically through the unstructured object
+type CustomResource struct {
+	Group   string `yaml:"group"`
+	Version string `yaml:"version"`
+	Kind    string `yaml:"kind"`
+
+	// PodSpecPath is the dot separated path of the pod spec in the custom resource, e.g. spec.template.spec
+	PodSpecPath string `yaml:"podSpecPath"`
+
+	// PodMetadataPath is the dot separated path of the pod metadata in the custom resource,
+	// defaults to the metadata next to the pod spec, e.g. spec.template.metadata
+	PodMetadataPath string `yaml:"podMetadataPath,omitempty"`
+}
+
+// PodSpecFields returns the fields of the pod spec path
+func (c CustomResource) PodSpecFields() []string {
+	return strings.Split(c.PodSpecPath, ".")
+}
+
+// PodMetadataFields returns the fields of the pod metadata path
+func (c CustomResource) PodMetadataFields() []string {
+	if c.PodMetadataPath != "" {
+		return strings.Split(c.PodMetadataPath, ".")
+	}
+	fields := c.PodSpecFields()
+	return append(fields[:len(fields)-1:len(fields)-1], "metadata")
+}
+
+// GetCustomResource returns the registered custom resource of the group, version & kind
+func (m MutationConfig) GetCustomResource(group string, version string, kind string) (CustomResource, bool) {
+	for _, customResource := range m.CustomResources {
+		if customResource.Group == group && customResource.Version == version && customResource.Kind == kind {
+			return customResource, true
+		}
+	}
+	return CustomResource{}, false
+}
+
+// validateCustomResources checks if the version, kind & pod spec path of the custom resources are specified and the paths are valid
+func validateCustomResources(mutationConfig MutationConfig) error {
+	for _, customResource := range mutationConfig.CustomResources {
+		if customResource.Version == "" || customResource.Kind == "" {
+			return fmt.Errorf("version & kind of the custom resource must be specified, group: %q, version: %q, kind: %q", customResource.Group, customResource.Version, customResource.Kind)
+		}
+		if customResource.PodSpecPath == "" {
+			return fmt.Errorf("pod spec path of the custom resource %s must be specified", customResource.Kind)
+		}
+		for _, path := range []string{customResource.PodSpecPath, customResource.PodMetadataPath} {
+			if path == "" {
+				continue
+			}
+			for _, field := range strings.Split(path, ".") {
+				if field == "" {
+					return fmt.Errorf("invalid path %q of the custom resource %s", path, customResource.Kind)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -1,13 +1,32 @@
 package config
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 )
 
+// namespaceResyncPeriod is the resync period of the namespace informer
+const namespaceResyncPeriod = 10 * time.Minute
+
 // K8sClient represents the Kubernetes client object
 type K8sClient struct {
 	Clientset kubernetes.Interface
+
+	informerLock sync.RWMutex
+
+	// namespaceLister lists the namespaces from the informer cache, it is nil until the namespace informer cache is synced
+	namespaceLister corelisters.NamespaceLister
+
+	// namespaceInformerSynced reports if the namespace informer cache is synced, it is nil until the namespace informer is started
+	namespaceInformerSynced cache.InformerSynced
 }
 
 // NewK8sClient creates and returns kuberentes client
@@ -27,3 +46,58 @@ func NewK8sClientSet(k8sRestConfig *rest.Config) (kubernetes.Interface, error) {
 	}
 	return clientset, nil
 }
+
+// StartNamespaceInformer starts the namespace informer and waits for its cache to sync, until the stop channel is closed.
+// Namespace lister is available once the cache is synced.
+func (k *K8sClient) StartNamespaceInformer(stopCh <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactory(k.Clientset, namespaceResyncPeriod)
+	namespaceInformer := factory.Core().V1().Namespaces()
+	lister := namespaceInformer.Lister()
+
+	k.informerLock.Lock()
+	k.namespaceInformerSynced = namespaceInformer.Informer().HasSynced
+	k.informerLock.Unlock()
+
+	factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, namespaceInformer.Informer().HasSynced) {
+		return errors.New("namespace informer cache is not synced")
+	}
+	k.informerLock.Lock()
+	k.namespaceLister = lister
+	k.informerLock.Unlock()
+	return nil
+}
+
+// NamespaceLister returns the lister listing the namespaces from the informer cache, it returns nil until the cache is synced
+func (k *K8sClient) NamespaceLister() corelisters.NamespaceLister {
+	k.informerLock.RLock()
+	defer k.informerLock.RUnlock()
+	return k.namespaceLister
+}
+
+// NamespaceInformerSynced checks if the namespace informer is started and its cache is synced
+func (k *K8sClient) NamespaceInformerSynced() bool {
+	k.informerLock.RLock()
+	defer k.informerLock.RUnlock()
+	return k.namespaceLister != nil && k.namespaceInformerSynced()
+}
+
+// NamespaceInformer runs the namespace informer of the k8s client as the manager runnable,
+// so that the webhook starts serving without waiting for the cache to sync, the informer readiness check gates the traffic until then.
+type NamespaceInformer struct {
+	Client *K8sClient
+}
+
+// Start starts the namespace informer and runs it until the context is done
+func (n *NamespaceInformer) Start(ctx context.Context) error {
+	if err := n.Client.StartNamespaceInformer(ctx.Done()); err != nil && ctx.Err() == nil {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// NeedLeaderElection implements the LeaderElectionRunnable, informer runs on every replica
+func (n *NamespaceInformer) NeedLeaderElection() bool {
+	return false
+}
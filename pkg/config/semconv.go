@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DefaultSemconvVersion is the semantic conventions version used, if version is not specified
+const DefaultSemconvVersion = "1.4.0"
+
+// SemanticConventions holds the config of the mapping of the resource env variables to the resource attribute keys
+type SemanticConventions struct {
+	// Version selects the built-in mapping table of the semantic conventions version
+	Version string `yaml:"version,omitempty"`
+
+	// EmitAliases emits the old keys of the renamed attributes along with the new ones, for the transition period
+	EmitAliases bool `yaml:"emitAliases,omitempty"`
+
+	// Mappings override or extend the built-in mapping table
+	Mappings []SemconvMapping `yaml:"mappings,omitempty"`
+}
+
+// SemconvMapping maps the env variable to the resource attribute key, aliases are the old keys of the attribute
+type SemconvMapping struct {
+	Env     string   `yaml:"env"`
+	Key     string   `yaml:"key"`
+	Aliases []string `yaml:"aliases,omitempty"`
+}
+
+// semconvTables are the built-in mapping tables keyed by the semantic conventions version
+var semconvTables = map[string][]SemconvMapping{
+	"1.4.0": {
+		{Env: "SERVICE_NAME", Key: "service.name"},
+		{Env: "SERVICE_NAMESPACE", Key: "service.namespace"},
+		{Env: "SERVICE_VERSION", Key: "service.version"},
+		{Env: "SERVICE_INSTANCE_ID", Key: "service.instance.id"},
+		{Env: "DEPLOYMENT_ENVIRONMENT", Key: "deployment.environment"},
+	},
+	"1.26.0": {
+		{Env: "SERVICE_NAME", Key: "service.name"},
+		{Env: "SERVICE_NAMESPACE", Key: "service.namespace"},
+		{Env: "SERVICE_VERSION", Key: "service.version"},
+		{Env: "SERVICE_INSTANCE_ID", Key: "service.instance.id"},
+		{Env: "DEPLOYMENT_ENVIRONMENT", Key: "deployment.environment"},
+	},
+	"1.27.0": {
+		{Env: "SERVICE_NAME", Key: "service.name"},
+		{Env: "SERVICE_NAMESPACE", Key: "service.namespace"},
+		{Env: "SERVICE_VERSION", Key: "service.version"},
+		{Env: "SERVICE_INSTANCE_ID", Key: "service.instance.id"},
+		{Env: "DEPLOYMENT_ENVIRONMENT", Key: "deployment.environment.name", Aliases: []string{"deployment.environment"}},
+	},
+}
+
+// SemconvVersions returns the semantic conventions versions of the built-in mapping tables
+func SemconvVersions() []string {
+	versions := make([]string, 0, len(semconvTables))
+	for version := range semconvTables {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// GetSemconvKeys returns the resource attribute key of the env variable, followed by its aliases if they are to be emitted
+func GetSemconvKeys(envName string, semanticConventions SemanticConventions) ([]string, bool) {
+	mapping, found := getSemconvMapping(envName, semanticConventions)
+	if !found {
+		return nil, false
+	}
+	keys := []string{mapping.Key}
+	if semanticConventions.EmitAliases {
+		keys = append(keys, mapping.Aliases...)
+	}
+	return keys, true
+}
+
+// getSemconvMapping returns the mapping of the env variable, mappings of the config take precedence over the built-in table
+func getSemconvMapping(envName string, semanticConventions SemanticConventions) (SemconvMapping, bool) {
+	for _, mapping := range semanticConventions.Mappings {
+		if mapping.Env == envName {
+			return mapping, true
+		}
+	}
+	version := semanticConventions.Version
+	if version == "" {
+		version = DefaultSemconvVersion
+	}
+	for _, mapping := range semconvTables[version] {
+		if mapping.Env == envName {
+			return mapping, true
+		}
+	}
+	return SemconvMapping{}, false
+}
+
+// validateSemanticConventions checks if the semantic conventions version is supported and the mappings are complete
+func validateSemanticConventions(mutationConfig MutationConfig) error {
+	semanticConventions := mutationConfig.SemanticConventions
+	if _, ok := semconvTables[semanticConventions.Version]; semanticConventions.Version != "" && !ok {
+		return fmt.Errorf("unsupported semantic conventions version %q, supported versions are %v", semanticConventions.Version, SemconvVersions())
+	}
+	for _, mapping := range semanticConventions.Mappings {
+		if mapping.Env == "" || mapping.Key == "" {
+			return fmt.Errorf("env & key of the semantic conventions mapping must be specified, env: %q, key: %q", mapping.Env, mapping.Key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replaces the values of the sensitive env variables, wherever they are exposed outside of the pods
+const RedactedValue = "<redacted>"
+
+// sensitiveEnvNameExp matches the names of the env variables, whose values are considered sensitive, like OTEL_EXPORTER_OTLP_HEADERS
+var sensitiveEnvNameExp = regexp.MustCompile(`(?i)(token|secret|passw|key|credential|auth|header|cookie)`)
+
+// IsSensitiveEnvName reports if the value of the env variable is considered sensitive by its name
+func IsSensitiveEnvName(name string) bool {
+	return sensitiveEnvNameExp.MatchString(name)
+}
+
+// RedactEnvValues returns the copy of the decoded JSON value with the values of the sensitive env variables redacted, wherever they are nested.
+// Env variables are the objects holding the name & the value, the value is held by any of the keys ending with value, like "env value" of the logs.
+func RedactEnvValues(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		sensitive := false
+		redacted := make(map[string]interface{}, len(typed))
+		for key, field := range typed {
+			if name, ok := field.(string); ok && strings.EqualFold(strings.Trim(key, " :"), "name") && IsSensitiveEnvName(name) {
+				sensitive = true
+			}
+			redacted[key] = RedactEnvValues(field)
+		}
+		if sensitive {
+			for key, field := range typed {
+				if envValue, ok := field.(string); ok && envValue != "" && strings.HasSuffix(strings.ToLower(key), "value") {
+					redacted[key] = RedactedValue
+				}
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(typed))
+		for idx, item := range typed {
+			redacted[idx] = RedactEnvValues(item)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
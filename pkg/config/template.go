@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+var (
+	// envTemplates holds the parsed go-templates of the env values of the loaded config, keyed by the env value
+	envTemplates = map[string]*template.Template{}
+
+	// envTemplateFuncs are the only functions, apart from the go-template builtins, which can be used in the env value templates
+	envTemplateFuncs = template.FuncMap{
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"default": func(defaultValue string, value interface{}) string {
+			if s, ok := value.(string); ok && s != "" {
+				return s
+			}
+			return defaultValue
+		},
+	}
+)
+
+// IsEnvTemplate checks if the env value is a go-template expression
+func IsEnvTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// GetEnvTemplate returns the parsed go-template of the env value
+func GetEnvTemplate(value string) (*template.Template, error) {
+	configLock.RLock()
+	tmpl, ok := envTemplates[value]
+	configLock.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+	return parseEnvTemplate(value, value)
+}
+
+// HasEnvTemplates checks if the loaded config has any env value template
+func HasEnvTemplates() bool {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return len(envTemplates) > 0
+}
+
+// errEnvTemplateInvocation is returned for the env value templates defining or invoking the templates,
+// as the recursive invocations are the only way for the template execution to be unbounded
+var errEnvTemplateInvocation = errors.New("env value template must not define or invoke the templates")
+
+// parseEnvTemplate parses the env value as a go-template.
+// Templates can only use the restricted functions & range over the finite template data,
+// so that their execution is bounded by the size of the template & the data.
+func parseEnvTemplate(name string, value string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Funcs(envTemplateFuncs).Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(tmpl.Templates()) > 1 || hasTemplateNode(tmpl.Tree.Root) {
+		return nil, errEnvTemplateInvocation
+	}
+	return tmpl, nil
+}
+
+// hasTemplateNode checks if the parsed template invokes any template
+func hasTemplateNode(node parse.Node) bool {
+	switch node := node.(type) {
+	case *parse.TemplateNode:
+		return true
+	case *parse.ListNode:
+		if node == nil {
+			return false
+		}
+		for _, child := range node.Nodes {
+			if hasTemplateNode(child) {
+				return true
+			}
+		}
+	case *parse.IfNode:
+		return hasTemplateNode(node.List) || hasTemplateNode(node.ElseList)
+	case *parse.RangeNode:
+		return hasTemplateNode(node.List) || hasTemplateNode(node.ElseList)
+	case *parse.WithNode:
+		return hasTemplateNode(node.List) || hasTemplateNode(node.ElseList)
+	}
+	return false
+}
+
+// parseEnvTemplates parses all the go-template env values of the mutation config
+func parseEnvTemplates(mutationConfig MutationConfig) (map[string]*template.Template, error) {
+	templates := map[string]*template.Template{}
+
+	values := map[string]string{}
+	for _, resourceEnv := range mutationConfig.LMEnvVars.Resource {
+		values[resourceEnv.Env.Value] = resourceEnv.Env.Name
+	}
+	for _, operationEnv := range mutationConfig.LMEnvVars.Operation {
+		values[operationEnv.Env.Value] = operationEnv.Env.Name
+	}
+
+	for value, envName := range values {
+		if !IsEnvTemplate(value) {
+			continue
+		}
+		tmpl, err := parseEnvTemplate(value, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template in the value of env variable %s: %w", envName, err)
+		}
+		templates[value] = tmpl
+	}
+	return templates, nil
+}
@@ -0,0 +1,200 @@
+package debug
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/mutation"
+	"gomodules.xyz/jsonpatch/v2"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Paths of the debug API
+const (
+	ConfigPath = "/debug/config"
+	OwnersPath = "/debug/owners"
+	MutatePath = "/debug/mutate"
+)
+
+const (
+	// maxPodSize is the max size of the pod posted to the MutatePath
+	maxPodSize = 1 << 20
+
+	// mutateTimeout bounds the mutation run on demand
+	mutateTimeout = 10 * time.Second
+)
+
+// API is the admin debug API showing the loaded config & the owner cache, and running the mutations on demand.
+// Requests are authenticated by the bearer token read from the TokenFile, so that the token can be rotated without restart.
+type API struct {
+	Client         *config.K8sClient
+	Cache          *mutation.MutationCache
+	WorkloadLookup mutation.WorkloadLookupOptions
+	TokenFile      string
+	Log            logr.Logger
+}
+
+// ConfigResponse is the response of the ConfigPath
+type ConfigResponse struct {
+	MutationConfigProvided bool                  `json:"mutationConfigProvided"`
+	MutationConfig         config.MutationConfig `json:"mutationConfig"`
+	Hash                   string                `json:"hash,omitempty"`
+	LoadTime               *time.Time            `json:"loadTime,omitempty"`
+	LoadError              string                `json:"loadError,omitempty"`
+}
+
+// MutateResponse is the response of the MutatePath
+type MutateResponse struct {
+	Patch    []jsonpatch.JsonPatchOperation `json:"patch"`
+	Warnings []string                       `json:"warnings,omitempty"`
+	Error    string                         `json:"error,omitempty"`
+	Trace    []TraceEntry                   `json:"trace"`
+}
+
+// Register registers the handlers of the debug API using the register function, like the one of the webhook server
+func (a *API) Register(register func(path string, handler http.Handler)) {
+	register(ConfigPath, a.authenticated(http.MethodGet, http.HandlerFunc(a.serveConfig)))
+	register(OwnersPath, a.authenticated(http.MethodGet, http.HandlerFunc(a.serveOwners)))
+	register(MutatePath, a.authenticated(http.MethodPost, http.HandlerFunc(a.serveMutate)))
+}
+
+// authenticated allows the requests of the method, which carry the bearer token of the TokenFile
+func (a *API) authenticated(method string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token, err := ioutil.ReadFile(filepath.Clean(a.TokenFile))
+		if err != nil {
+			a.Log.Error(err, "Error in reading the debug API token", "tokenFile", a.TokenFile)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		expected := bytes.TrimSpace(token)
+		provided := []byte(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if len(expected) == 0 || subtle.ConstantTimeCompare(provided, expected) != 1 {
+			a.Log.Info("Unauthorized debug API request", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		a.Log.Info("Debug API request", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveConfig returns the loaded config with the sensitive values redacted, along with its hash & load time
+func (a *API) serveConfig(w http.ResponseWriter, r *http.Request) {
+	lmConfig := config.GetConfig()
+	mutationConfig := redactConfig(lmConfig.MutationConfig)
+	resp := ConfigResponse{
+		MutationConfigProvided: lmConfig.MutationConfigProvided,
+		MutationConfig:         mutationConfig,
+	}
+	if info := config.GetConfigInfo(); info.Hash != "" {
+		resp.Hash = info.Hash
+		resp.LoadTime = &info.LoadTime
+	}
+	if err := config.GetLoadError(); err != nil {
+		resp.LoadError = err.Error()
+	}
+	a.writeJSON(w, resp)
+}
+
+// serveOwners returns the workload names of the pod owners memoized by the owner cache
+func (a *API) serveOwners(w http.ResponseWriter, r *http.Request) {
+	a.writeJSON(w, a.Cache.Owners())
+}
+
+// serveMutate runs the mutations on the posted pod as a dry run and returns the patch along with the decision trace.
+// Namespace of the pod is taken from the namespace query parameter, the pod or the default namespace in that order.
+// Values of the sensitive env variables are redacted by their names in the patch & the trace.
+func (a *API) serveMutate(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPodSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(body, pod); err != nil {
+		http.Error(w, "invalid pod: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		namespace = pod.Namespace
+	}
+	if namespace == "" {
+		namespace = corev1.NamespaceDefault
+	}
+	pod.Namespace = namespace
+	original, err := json.Marshal(pod)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lmConfig := config.GetConfig()
+	trace := &trace{}
+	ctx, cancel := context.WithTimeout(log.IntoContext(r.Context(), trace.Logger()), mutateTimeout)
+	defer cancel()
+
+	params := &mutation.Params{
+		Client:         a.Client,
+		Log:            trace.Logger(),
+		LMConfig:       lmConfig,
+		Mutations:      mutation.Mutations,
+		Pod:            pod,
+		Namespace:      namespace,
+		WorkloadLookup: a.WorkloadLookup,
+		// Mutation on demand is a dry run
+		DryRun: true,
+	}
+	resp := MutateResponse{Patch: []jsonpatch.JsonPatchOperation{}}
+	if err := mutation.RunMutations(ctx, params); err != nil {
+		resp.Error = err.Error()
+	} else {
+		mutated, err := json.Marshal(pod)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		patch, err := jsonpatch.CreatePatch(original, mutated)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Patch = redactPatch(patch, pod)
+	}
+	resp.Warnings = params.Warnings
+	resp.Trace = redactTrace(trace.Entries())
+	a.writeJSON(w, resp)
+}
+
+// writeJSON writes the JSON encoded response
+func (a *API) writeJSON(w http.ResponseWriter, resp interface{}) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(resp); err != nil {
+		a.Log.Error(err, "Error in encoding the debug API response")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		a.Log.Error(err, "Error in writing the debug API response")
+	}
+}
@@ -0,0 +1,286 @@
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/logicmonitor/lm-k8s-webhook/internal/testutil"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/mutation"
+	"gomodules.xyz/jsonpatch/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var logger = logf.Log.WithName("unit-tests")
+
+const testToken = "debug-token"
+
+// newTestServer returns the test server serving the debug API
+func newTestServer(t *testing.T, api *API) *httptest.Server {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte(testToken+"\n"), 0600); err != nil {
+		t.Fatalf("Error occured in writing the token: %v", err)
+	}
+	api.TokenFile = tokenFile
+	api.Log = logger
+	mux := http.NewServeMux()
+	api.Register(mux.Handle)
+	return httptest.NewServer(mux)
+}
+
+// doRequest sends the request to the debug API and returns the response status & body
+func doRequest(t *testing.T, method string, url string, token string, body string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Error occured in building the request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error occured in sending the request: %v", err)
+	}
+	defer resp.Body.Close()
+	out, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error occured in reading the response: %v", err)
+	}
+	return resp.StatusCode, string(out)
+}
+
+func TestAuthentication(t *testing.T) {
+	server := newTestServer(t, &API{})
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		wantStatus int
+	}{
+		{
+			name:       "Request without token",
+			method:     http.MethodGet,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Request with invalid token",
+			method:     http.MethodGet,
+			token:      "invalid-token",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Request with valid token",
+			method:     http.MethodGet,
+			token:      testToken,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Request with unsupported method",
+			method:     http.MethodDelete,
+			token:      testToken,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _ := doRequest(t, tt.method, server.URL+ConfigPath, tt.token, "")
+			if status != tt.wantStatus {
+				t.Errorf("%s %s returned status = %d, but expected = %d", tt.method, ConfigPath, status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestServeConfig(t *testing.T) {
+	if err := config.LoadConfig("./testdata/config.yaml"); err != nil {
+		t.Errorf("Error occured in loading the config: %v", err)
+		return
+	}
+	server := newTestServer(t, &API{})
+	defer server.Close()
+
+	status, body := doRequest(t, http.MethodGet, server.URL+ConfigPath, testToken, "")
+	if status != http.StatusOK {
+		t.Errorf("GET %s returned status = %d, but expected = %d", ConfigPath, status, http.StatusOK)
+		return
+	}
+	if strings.Contains(body, "s3cr3t-api-key") {
+		t.Errorf("GET %s returned the sensitive value: %s", ConfigPath, body)
+	}
+	if !strings.Contains(body, RedactedValue) || !strings.Contains(body, "ABC Corporation") {
+		t.Errorf("GET %s returned = %s, but expected the sensitive value to be redacted & the rest to be kept", ConfigPath, body)
+	}
+
+	var resp ConfigResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Errorf("Error occured in decoding the response: %v", err)
+		return
+	}
+	if resp.Hash != config.GetConfigInfo().Hash || resp.LoadTime == nil {
+		t.Errorf("GET %s returned hash = %s & load time = %v, but expected = %s", ConfigPath, resp.Hash, resp.LoadTime, config.GetConfigInfo().Hash)
+	}
+}
+
+func TestServeOwners(t *testing.T) {
+	k8sClient, err := testutil.NewFakeK8sClient(&appsv1.ReplicaSet{ObjectMeta: v1.ObjectMeta{
+		Name:            "checkout-5d8f7c9b6",
+		Namespace:       "default",
+		OwnerReferences: []v1.OwnerReference{{Kind: mutation.WorkloadResourceDeployment, Name: "checkout"}},
+	}})
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+	cache := mutation.NewMutationCache(10, time.Minute)
+	params := &mutation.Params{
+		Client: k8sClient,
+		Log:    logger,
+		Pod: &corev1.Pod{
+			ObjectMeta: v1.ObjectMeta{GenerateName: "checkout-5d8f7c9b6-", OwnerReferences: []v1.OwnerReference{{Kind: mutation.WorkloadResourceReplicaSet, Name: "checkout-5d8f7c9b6"}}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "checkout"}}},
+		},
+		Mutations: mutation.Mutations,
+		Namespace: "default",
+		Cache:     cache,
+	}
+	if err := mutation.RunMutations(context.Background(), params); err != nil {
+		t.Errorf("Error occured in running the mutations: %v", err)
+		return
+	}
+	server := newTestServer(t, &API{Cache: cache})
+	defer server.Close()
+
+	status, body := doRequest(t, http.MethodGet, server.URL+OwnersPath, testToken, "")
+	if status != http.StatusOK {
+		t.Errorf("GET %s returned status = %d, but expected = %d", OwnersPath, status, http.StatusOK)
+		return
+	}
+	var owners map[string]string
+	if err := json.Unmarshal([]byte(body), &owners); err != nil {
+		t.Errorf("Error occured in decoding the response: %v", err)
+		return
+	}
+	if got := owners["default/ReplicaSet/checkout-5d8f7c9b6"]; got != "checkout" {
+		t.Errorf("GET %s returned = %v, but expected the workload name = checkout", OwnersPath, owners)
+	}
+}
+
+func TestServeMutate(t *testing.T) {
+	if err := config.LoadConfig("./testdata/config.yaml"); err != nil {
+		t.Errorf("Error occured in loading the config: %v", err)
+		return
+	}
+	k8sClient, err := testutil.NewFakeK8sClient(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "payments"}})
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+	server := newTestServer(t, &API{Client: k8sClient})
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "Mutate the posted pod",
+			body:       `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "checkout"}, "spec": {"containers": [{"name": "checkout", "image": "checkout:v1"}]}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Mutate the posted pod with the sensitive env variable",
+			body:       `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "checkout"}, "spec": {"containers": [{"name": "checkout", "image": "checkout:v1", "env": [{"name": "DB_PASSWORD", "value": "s3cr3t-db-password"}]}]}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Invalid pod",
+			body:       `{"spec": "checkout"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, http.MethodPost, server.URL+MutatePath+"?namespace=payments", testToken, tt.body)
+			if status != tt.wantStatus {
+				t.Errorf("POST %s returned status = %d, but expected = %d", MutatePath, status, tt.wantStatus)
+				return
+			}
+			if status != http.StatusOK {
+				return
+			}
+			if strings.Contains(body, "s3cr3t") {
+				t.Errorf("POST %s returned the sensitive value: %s", MutatePath, body)
+			}
+			var resp MutateResponse
+			if err := json.Unmarshal([]byte(body), &resp); err != nil {
+				t.Errorf("Error occured in decoding the response: %v", err)
+				return
+			}
+			if resp.Error != "" || len(resp.Patch) == 0 {
+				t.Errorf("POST %s returned error = %s & %d patch operations, but expected the patch", MutatePath, resp.Error, len(resp.Patch))
+			}
+			if !strings.Contains(body, "SERVICE_NAME") || !strings.Contains(body, "LM_APM_POD_NAMESPACE") {
+				t.Errorf("POST %s returned = %s, but expected the injected env variables", MutatePath, body)
+			}
+			if len(resp.Trace) == 0 {
+				t.Errorf("POST %s returned empty trace, but expected the decisions of the mutation", MutatePath)
+			}
+		})
+	}
+}
+
+func TestRedactPatch(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+		Name: "checkout",
+		Env:  []corev1.EnvVar{{Name: "DB_PASSWORD", Value: "s3cr3t"}, {Name: "SERVICE_NAME", Value: "checkout"}},
+	}}}}
+	tests := []struct {
+		name      string
+		operation jsonpatch.JsonPatchOperation
+		want      interface{}
+	}{
+		{
+			name:      "Value of the sensitive env variable",
+			operation: jsonpatch.JsonPatchOperation{Operation: "replace", Path: "/spec/containers/0/env/0/value", Value: "s3cr3t"},
+			want:      RedactedValue,
+		},
+		{
+			name:      "Value of the other env variable",
+			operation: jsonpatch.JsonPatchOperation{Operation: "replace", Path: "/spec/containers/0/env/1/value", Value: "checkout"},
+			want:      "checkout",
+		},
+		{
+			name:      "Value of the unknown env variable",
+			operation: jsonpatch.JsonPatchOperation{Operation: "replace", Path: "/spec/containers/0/env/5/value", Value: "s3cr3t"},
+			want:      RedactedValue,
+		},
+		{
+			name:      "Sensitive env variable added",
+			operation: jsonpatch.JsonPatchOperation{Operation: "add", Path: "/spec/containers/0/env/0", Value: map[string]interface{}{"name": "DB_PASSWORD", "value": "s3cr3t"}},
+			want:      map[string]interface{}{"name": "DB_PASSWORD", "value": RedactedValue},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactPatch([]jsonpatch.JsonPatchOperation{tt.operation}, pod)
+			if !reflect.DeepEqual(got[0].Value, tt.want) {
+				t.Errorf("redactPatch() = %v, but expected = %v", got[0].Value, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package debug
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"gomodules.xyz/jsonpatch/v2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// RedactedValue replaces the values of the sensitive env variables
+const RedactedValue = config.RedactedValue
+
+// envPathExp matches the patch paths within an env variable of a container, capturing the kind of the container, its index & the index of the env variable
+var envPathExp = regexp.MustCompile(`^/spec/(initContainers|containers|ephemeralContainers)/(\d+)/env/(\d+)/`)
+
+// redactConfig returns the copy of the config with the values of the sensitive env variables redacted
+func redactConfig(mutationConfig config.MutationConfig) config.MutationConfig {
+	resource := make([]config.ResourceEnv, len(mutationConfig.LMEnvVars.Resource))
+	for idx, envVar := range mutationConfig.LMEnvVars.Resource {
+		envVar.Env = redactEnv(envVar.Env)
+		resource[idx] = envVar
+	}
+	mutationConfig.LMEnvVars.Resource = resource
+
+	operation := make([]config.OperationEnv, len(mutationConfig.LMEnvVars.Operation))
+	for idx, envVar := range mutationConfig.LMEnvVars.Operation {
+		envVar.Env = redactEnv(envVar.Env)
+		operation[idx] = envVar
+	}
+	mutationConfig.LMEnvVars.Operation = operation
+
+	profiles := make(map[string]config.Profile, len(mutationConfig.Profiles))
+	for name, profile := range mutationConfig.Profiles {
+		env := make([]corev1.EnvVar, len(profile.Env))
+		for idx, envVar := range profile.Env {
+			env[idx] = redactEnv(envVar)
+		}
+		profile.Env = env
+		profiles[name] = profile
+	}
+	mutationConfig.Profiles = profiles
+
+	return mutationConfig
+}
+
+// redactEnv redacts the value of the env variable if it is sensitive
+func redactEnv(envVar corev1.EnvVar) corev1.EnvVar {
+	if envVar.Value != "" && config.IsSensitiveEnvName(envVar.Name) {
+		envVar.Value = RedactedValue
+	}
+	return envVar
+}
+
+// redactPatch returns the copy of the patch of the pod with the values of the sensitive env variables redacted.
+// Value set within an env variable, like its value alone, is redacted by the name of the env variable in the mutated pod.
+func redactPatch(patch []jsonpatch.JsonPatchOperation, pod *corev1.Pod) []jsonpatch.JsonPatchOperation {
+	redacted := make([]jsonpatch.JsonPatchOperation, 0, len(patch))
+	for _, operation := range patch {
+		if operation.Value != nil && envPathExp.MatchString(operation.Path) {
+			if name, found := envNameAt(pod, operation.Path); !found || config.IsSensitiveEnvName(name) {
+				operation.Value = RedactedValue
+			}
+		} else {
+			operation.Value = config.RedactEnvValues(operation.Value)
+		}
+		redacted = append(redacted, operation)
+	}
+	return redacted
+}
+
+// envNameAt returns the name of the env variable of the pod, the patch path is within
+func envNameAt(pod *corev1.Pod, path string) (string, bool) {
+	match := envPathExp.FindStringSubmatch(path)
+	if match == nil {
+		return "", false
+	}
+	containerIdx, _ := strconv.Atoi(match[2])
+	envIdx, _ := strconv.Atoi(match[3])
+	var env []corev1.EnvVar
+	switch match[1] {
+	case "initContainers":
+		if containerIdx < len(pod.Spec.InitContainers) {
+			env = pod.Spec.InitContainers[containerIdx].Env
+		}
+	case "containers":
+		if containerIdx < len(pod.Spec.Containers) {
+			env = pod.Spec.Containers[containerIdx].Env
+		}
+	case "ephemeralContainers":
+		if containerIdx < len(pod.Spec.EphemeralContainers) {
+			env = pod.Spec.EphemeralContainers[containerIdx].Env
+		}
+	}
+	if envIdx >= len(env) {
+		return "", false
+	}
+	return env[envIdx].Name, true
+}
+
+// redactTrace returns the copy of the trace with the values of the sensitive env variables redacted,
+// logged values are redacted in their JSON form, as they are returned in the response
+func redactTrace(entries []TraceEntry) []TraceEntry {
+	redacted := make([]TraceEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Values != nil {
+			entry.Values = redactTraceValues(entry.Values)
+		}
+		redacted = append(redacted, entry)
+	}
+	return redacted
+}
+
+// redactTraceValues returns the logged values with the values of the sensitive env variables redacted,
+// all of them are redacted if they can not be JSON encoded
+func redactTraceValues(values map[string]interface{}) map[string]interface{} {
+	var decoded map[string]interface{}
+	data, err := json.Marshal(values)
+	if err == nil {
+		err = json.Unmarshal(data, &decoded)
+	}
+	if err != nil {
+		redacted := make(map[string]interface{}, len(values))
+		for key := range values {
+			redacted[key] = RedactedValue
+		}
+		return redacted
+	}
+	redacted, _ := config.RedactEnvValues(decoded).(map[string]interface{})
+	return redacted
+}
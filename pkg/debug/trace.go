@@ -0,0 +1,103 @@
+package debug
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+)
+
+// TraceEntry is a decision taken by the mutation, as logged by it
+type TraceEntry struct {
+	Logger  string                 `json:"logger,omitempty"`
+	Message string                 `json:"message"`
+	Error   string                 `json:"error,omitempty"`
+	Values  map[string]interface{} `json:"values,omitempty"`
+}
+
+// trace collects the entries logged through its loggers
+type trace struct {
+	lock    sync.Mutex
+	entries []TraceEntry
+}
+
+// Entries returns the collected entries in the order they are logged
+func (t *trace) Entries() []TraceEntry {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]TraceEntry(nil), t.entries...)
+}
+
+// Logger returns the logger adding the logged messages to the trace
+func (t *trace) Logger() logr.Logger {
+	return &traceLogger{trace: t}
+}
+
+func (t *trace) add(entry TraceEntry) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.entries = append(t.entries, entry)
+}
+
+// traceLogger is the logr.Logger adding the messages of all the levels to the trace
+type traceLogger struct {
+	trace  *trace
+	name   string
+	values []interface{}
+}
+
+func (l *traceLogger) Enabled() bool {
+	return true
+}
+
+func (l *traceLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.trace.add(TraceEntry{Logger: l.name, Message: msg, Values: l.valueMap(keysAndValues)})
+}
+
+func (l *traceLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	entry := TraceEntry{Logger: l.name, Message: msg, Values: l.valueMap(keysAndValues)}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	l.trace.add(entry)
+}
+
+func (l *traceLogger) V(level int) logr.Logger {
+	return l
+}
+
+func (l *traceLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	values := append(append([]interface{}(nil), l.values...), keysAndValues...)
+	return &traceLogger{trace: l.trace, name: l.name, values: values}
+}
+
+func (l *traceLogger) WithName(name string) logr.Logger {
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	return &traceLogger{trace: l.trace, name: name, values: l.values}
+}
+
+// valueMap returns the key value pairs of the logger & the message as map, keys are trimmed as some of them are logged with the separators
+func (l *traceLogger) valueMap(keysAndValues []interface{}) map[string]interface{} {
+	all := append(append([]interface{}(nil), l.values...), keysAndValues...)
+	if len(all) == 0 {
+		return nil
+	}
+	values := make(map[string]interface{}, len(all)/2)
+	for idx := 0; idx < len(all); idx += 2 {
+		key := strings.Trim(fmt.Sprint(all[idx]), " :")
+		if idx+1 < len(all) {
+			// Errors are not JSON encoded as is
+			if err, ok := all[idx+1].(error); ok {
+				values[key] = err.Error()
+				continue
+			}
+			values[key] = all[idx+1]
+		} else {
+			values[key] = nil
+		}
+	}
+	return values
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/metrics"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/mutation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// LMCustomResourceMutationHandler represents the handler for the admission requests of the custom resources embedding the pod spec,
+// custom resources are registered in the customResources section of the config
+type LMCustomResourceMutationHandler struct {
+	Client  *config.K8sClient
+	decoder *admission.Decoder
+	Log     logr.Logger
+
+	Options
+}
+
+// Handle is called internally to handle the admission request
+func (customResourceMutationHandler *LMCustomResourceMutationHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := customResourceMutationHandler.Log.WithValues("lm-customresourcemutator-webhook", fmt.Sprintf("%s/%s/%s", req.Kind.Kind, req.Namespace, req.Name))
+
+	logger.Info("Received admission request:", req.Namespace, req.Name)
+
+	ctx, release, ok := customResourceMutationHandler.Limiter.Acquire(ctx)
+	defer release()
+	if !ok {
+		logger.Info("In-flight limit is reached within the time budget, allowing the custom resource without mutation", "budget", customResourceMutationHandler.Limiter.Budget())
+		metrics.AdmissionRequestsShed.WithLabelValues(metrics.ShedReasonInFlightLimit).Inc()
+		return admission.Allowed("in-flight limit is reached, custom resource is not mutated")
+	}
+
+	customResource, found := config.GetConfig().MutationConfig.GetCustomResource(req.Kind.Group, req.Kind.Version, req.Kind.Kind)
+	if !found {
+		logger.Info("Custom resource is not registered, skipping the mutation", "gvk", req.Kind)
+		return admission.Allowed("custom resource is not registered")
+	}
+
+	object := &unstructured.Unstructured{}
+	if err := customResourceMutationHandler.decoder.Decode(req, object); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	podSpecMap, found, err := unstructured.NestedMap(object.Object, customResource.PodSpecFields()...)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if !found {
+		logger.Info("Pod spec is not found in the custom resource, skipping the mutation", "podSpecPath", customResource.PodSpecPath)
+		return admission.Allowed("pod spec is not found")
+	}
+	var podSpec corev1.PodSpec
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(podSpecMap, &podSpec); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// Labels & annotations of the pod metadata are used for deriving the env variables
+	var podMetadata metav1.ObjectMeta
+	podMetadataMap, found, err := unstructured.NestedMap(object.Object, customResource.PodMetadataFields()...)
+	if err == nil && found {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(podMetadataMap, &podMetadata); err != nil {
+			logger.Error(err, "error in converting the pod metadata of the custom resource", "podMetadataPath", strings.Join(customResource.PodMetadataFields(), "."))
+		}
+	}
+
+	pod := &corev1.Pod{ObjectMeta: podMetadata, Spec: *podSpec.DeepCopy()}
+	pod.Namespace = req.Namespace
+
+	logger.Info("Calling mutation")
+
+	params := NewWorkloadParams(pod, customResourceMutationHandler.Client, customResourceMutationHandler.Log, req.Namespace, object.GetName())
+	customResourceMutationHandler.Options.apply(params)
+	params.DryRun = req.DryRun != nil && *req.DryRun
+	observeOnly := mutation.IsObserveOnly(ctx, params, customResourceMutationHandler.ObserveOnly)
+	params.DryRun = params.DryRun || observeOnly
+
+	if err := mutation.RunMutations(ctx, params); err != nil {
+		if ctx.Err() != nil {
+			logger.Error(err, "Time budget is exhausted in mutating the k8s resource, allowing the custom resource without mutation")
+			metrics.AdmissionRequestsShed.WithLabelValues(metrics.ShedReasonBudgetExhausted).Inc()
+			return admission.Allowed("time budget is exhausted, custom resource is not mutated")
+		}
+		logger.Error(err, "Error occurred in mutating the k8s resource")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	logger.Info("End mutation")
+
+	patches, err := getPodSpecPatches(podSpec, pod.Spec, toJSONPointer(customResource.PodSpecFields()))
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	customResourceMutationHandler.Recorder.RecordPodTemplate(req, object.GetName(), &corev1.PodTemplateSpec{ObjectMeta: podMetadata, Spec: podSpec}, pod, params.Warnings)
+
+	resp := admission.Patched("", patches...).WithWarnings(params.Warnings...)
+	if observeOnly {
+		return observeOnlyResponse(logger, req.Kind.Kind, resp)
+	}
+	return resp
+}
+
+// InjectDecoder injects the decoder.
+func (a *LMCustomResourceMutationHandler) InjectDecoder(d *admission.Decoder) error {
+	a.decoder = d
+	return nil
+}
+
+// jsonPointerEscaper escapes the reference tokens of the JSON pointer as per RFC 6901
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// toJSONPointer returns the JSON pointer of the fields
+func toJSONPointer(fields []string) string {
+	var pointer strings.Builder
+	for _, field := range fields {
+		pointer.WriteString("/")
+		pointer.WriteString(jsonPointerEscaper.Replace(field))
+	}
+	return pointer.String()
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/logicmonitor/lm-k8s-webhook/internal/testutil"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestCustomResourceHandle(t *testing.T) {
+	k8sClient, err := testutil.NewFakeK8sClient()
+	if err != nil {
+		t.Errorf("Error occurred in getting fake k8s client: %v", err)
+		return
+	}
+	os.Setenv("CLUSTER_NAME", "default")
+	defer os.Unsetenv("CLUSTER_NAME")
+
+	if err := config.LoadConfig("testdata/config_with_custom_resources.yaml"); err != nil {
+		t.Errorf("Error occurred in loading the config: %v", err)
+		return
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Errorf("Error occurred in getting decoder: %v", err)
+		return
+	}
+
+	podTemplate := `{"metadata": {"labels": {"app": "checkout"}}, "spec": {"containers": [{"image": "bar:v2", "name": "bar"}]}}`
+
+	tests := []struct {
+		name            string
+		kind            v1.GroupVersionKind
+		object          string
+		wantEnvPath     string
+		wantServiceName string
+	}{
+		{
+			name:            "Mutate pod spec of the argo rollout",
+			kind:            v1.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"},
+			object:          `{"apiVersion": "argoproj.io/v1alpha1", "kind": "Rollout", "metadata": {"name": "checkout", "namespace": "default"}, "spec": {"template": ` + podTemplate + `}}`,
+			wantEnvPath:     "/spec/template/spec/containers/0/env",
+			wantServiceName: "checkout",
+		},
+		{
+			name:            "Mutate pod spec of the keda scaled job",
+			kind:            v1.GroupVersionKind{Group: "keda.sh", Version: "v1alpha1", Kind: "ScaledJob"},
+			object:          `{"apiVersion": "keda.sh/v1alpha1", "kind": "ScaledJob", "metadata": {"name": "report", "namespace": "default"}, "spec": {"jobTargetRef": {"template": ` + podTemplate + `}}}`,
+			wantEnvPath:     "/spec/jobTargetRef/template/spec/containers/0/env",
+			wantServiceName: "report",
+		},
+		{
+			name:   "Skip pod spec not found in the custom resource",
+			kind:   v1.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"},
+			object: `{"apiVersion": "argoproj.io/v1alpha1", "kind": "Rollout", "metadata": {"name": "checkout", "namespace": "default"}, "spec": {"workloadRef": {"kind": "Deployment", "name": "checkout"}}}`,
+		},
+		{
+			name:   "Skip custom resource which is not registered",
+			kind:   v1.GroupVersionKind{Group: "serving.knative.dev", Version: "v1", Kind: "Service"},
+			object: `{"apiVersion": "serving.knative.dev/v1", "kind": "Service", "metadata": {"name": "checkout", "namespace": "default"}, "spec": {"template": ` + podTemplate + `}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			customResourceMutationHandler := &LMCustomResourceMutationHandler{Client: k8sClient, Log: logger, decoder: decoder}
+			resp := customResourceMutationHandler.Handle(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					UID:       "5a1e2b3c-4d5e-4f60-8a1b-2c3d4e5f6a7b",
+					Kind:      tt.kind,
+					Namespace: "default",
+					Operation: admissionv1.Create,
+					Object:    runtime.RawExtension{Raw: []byte(tt.object)},
+				},
+			})
+
+			if !resp.Allowed {
+				t.Errorf("Handle() returned AdmissionResponse.Allowed = false, but expected AdmissionResponse.Allowed = true, result = %v", resp.Result)
+				return
+			}
+			if tt.wantEnvPath == "" {
+				if len(resp.Patches) > 0 {
+					t.Errorf("Handle() returned patches = %v, but no patches are expected", resp.Patches)
+				}
+				return
+			}
+
+			var serviceName string
+			for _, patch := range resp.Patches {
+				if patch.Path != tt.wantEnvPath {
+					continue
+				}
+				envVars, _ := patch.Value.([]interface{})
+				for _, envVar := range envVars {
+					if env, ok := envVar.(map[string]interface{}); ok && env["name"] == "SERVICE_NAME" {
+						serviceName, _ = env["value"].(string)
+					}
+				}
+			}
+			if serviceName != tt.wantServiceName {
+				t.Errorf("Handle() SERVICE_NAME at %s = %s, but expected = %s, patches = %v", tt.wantEnvPath, serviceName, tt.wantServiceName, resp.Patches)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/metrics"
 	"github.com/logicmonitor/lm-k8s-webhook/pkg/mutation"
 
 	"net/http"
@@ -21,6 +22,8 @@ type LMPodMutationHandler struct {
 	Client  *config.K8sClient
 	decoder *admission.Decoder
 	Log     logr.Logger
+
+	Options
 }
 
 // Handle is called internally to handle the admission request
@@ -30,18 +33,40 @@ func (podMutationHandler *LMPodMutationHandler) Handle(ctx context.Context, req
 
 	logger.Info("Received admission request:", req.Namespace, req.Name)
 
+	ctx, release, ok := podMutationHandler.Limiter.Acquire(ctx)
+	defer release()
+	if !ok {
+		logger.Info("In-flight limit is reached within the time budget, allowing the pod without mutation", "budget", podMutationHandler.Limiter.Budget())
+		metrics.AdmissionRequestsShed.WithLabelValues(metrics.ShedReasonInFlightLimit).Inc()
+		return admission.Allowed("in-flight limit is reached, pod is not mutated")
+	}
+
 	err := podMutationHandler.decoder.Decode(req, pod)
 	if err != nil {
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 
+	if mutation.IsTemplateMutated(pod) {
+		logger.Info("Pod template is already mutated by the workload handler, skipping the mutation")
+		return admission.Allowed("pod template is already mutated")
+	}
+
 	logger.Info("Calling mutation")
 
 	params := NewParams(pod, podMutationHandler, req.Namespace)
+	params.DryRun = req.DryRun != nil && *req.DryRun
+	observeOnly := mutation.IsObserveOnly(ctx, params, podMutationHandler.ObserveOnly)
+	// Observed mutation is a dry run
+	params.DryRun = params.DryRun || observeOnly
 
 	err = mutation.RunMutations(ctx, params)
 
 	if err != nil {
+		if ctx.Err() != nil {
+			logger.Error(err, "Time budget is exhausted in mutating the k8s resource, allowing the pod without mutation")
+			metrics.AdmissionRequestsShed.WithLabelValues(metrics.ShedReasonBudgetExhausted).Inc()
+			return admission.Allowed("time budget is exhausted, pod is not mutated")
+		}
 		logger.Error(err, "Error occurred in mutating the k8s resource")
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
@@ -54,7 +79,12 @@ func (podMutationHandler *LMPodMutationHandler) Handle(ctx context.Context, req
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
 
-	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledPod)
+	resp := admission.PatchResponseFromRaw(req.Object.Raw, marshaledPod).WithWarnings(params.Warnings...)
+	podMutationHandler.Recorder.Record(req, marshaledPod, params.Warnings)
+	if observeOnly {
+		return observeOnlyResponse(logger, req.Kind.Kind, resp)
+	}
+	return resp
 }
 
 // InjectDecoder injects the decoder.
@@ -65,7 +95,7 @@ func (a *LMPodMutationHandler) InjectDecoder(d *admission.Decoder) error {
 
 // NewParams returns Params object
 func NewParams(pod *corev1.Pod, mutationHandler *LMPodMutationHandler, namespace string) *mutation.Params {
-	return &mutation.Params{
+	params := &mutation.Params{
 		Client:    mutationHandler.Client,
 		Pod:       pod,
 		LMConfig:  config.GetConfig(),
@@ -73,4 +103,6 @@ func NewParams(pod *corev1.Pod, mutationHandler *LMPodMutationHandler, namespace
 		Namespace: namespace,
 		Log:       mutationHandler.Log,
 	}
+	mutationHandler.Options.apply(params)
+	return params
 }
@@ -2,10 +2,14 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/logicmonitor/lm-k8s-webhook/internal/testutil"
 	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
 	"github.com/logicmonitor/lm-k8s-webhook/pkg/mutation"
 
@@ -25,16 +29,9 @@ import (
 
 var logger = logf.Log.WithName("unit-tests")
 
-// getFakeK8sClient returns the dummy kubernetes client object for testing
-func getFakeK8sClient() (*config.K8sClient, error) {
-	return config.NewK8sClient(nil, func(r *rest.Config) (kubernetes.Interface, error) {
-		return testclient.NewSimpleClientset(), nil
-	})
-}
-
 func TestHandle(t *testing.T) {
 
-	k8sClient, err := getFakeK8sClient()
+	k8sClient, err := testutil.NewFakeK8sClient()
 	if err != nil {
 		t.Errorf("Error occurred in getting fake k8s client: %v", err)
 		return
@@ -137,7 +134,7 @@ func TestHandle(t *testing.T) {
 
 func TestInjectDecoder(t *testing.T) {
 
-	k8sClient, err := getFakeK8sClient()
+	k8sClient, err := testutil.NewFakeK8sClient()
 	if err != nil {
 		t.Errorf("Error occurred in getting fake k8s client: %v", err)
 		return
@@ -229,3 +226,142 @@ func TestNewParams(t *testing.T) {
 		return
 	}
 }
+
+func TestHandleObserveOnly(t *testing.T) {
+	k8sClient, err := config.NewK8sClient(nil, func(r *rest.Config) (kubernetes.Interface, error) {
+		return testclient.NewSimpleClientset(
+			&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}},
+			&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "observed", Annotations: map[string]string{mutation.ObserveOnlyAnnotation: "true"}}},
+			&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "mutated", Annotations: map[string]string{mutation.ObserveOnlyAnnotation: "false"}}},
+		), nil
+	})
+	if err != nil {
+		t.Errorf("Error occurred in getting fake k8s client: %v", err)
+		return
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Errorf("Error occurred in getting decoder: %v", err)
+		return
+	}
+
+	tests := []struct {
+		name            string
+		observeOnly     bool
+		namespace       string
+		wantObserveOnly bool
+	}{
+		{
+			name:            "Global observe-only mode",
+			observeOnly:     true,
+			namespace:       "default",
+			wantObserveOnly: true,
+		},
+		{
+			name:            "Namespace opted into observe-only mode",
+			observeOnly:     false,
+			namespace:       "observed",
+			wantObserveOnly: true,
+		},
+		{
+			name:            "Namespace opted out of global observe-only mode",
+			observeOnly:     true,
+			namespace:       "mutated",
+			wantObserveOnly: false,
+		},
+		{
+			name:            "Observe-only mode is off",
+			observeOnly:     false,
+			namespace:       "default",
+			wantObserveOnly: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podMutationHandler := &LMPodMutationHandler{Client: k8sClient, Log: logger, decoder: decoder, Options: Options{ObserveOnly: tt.observeOnly}}
+			req := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					UID:       "2a4c6f0e-5b1d-4f7e-9c3a-8d2e1f0b6a71",
+					Kind:      v1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+					Resource:  v1.GroupVersionResource{Version: "v1", Resource: "pods"},
+					Namespace: tt.namespace,
+					Operation: admissionv1.Create,
+					Object: runtime.RawExtension{Raw: []byte(
+						`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "foo"}, "spec": {"containers": [{"image": "bar:v2", "name": "bar"}]}}`,
+					)},
+				},
+			}
+
+			resp := podMutationHandler.Handle(context.Background(), req)
+
+			if !resp.Allowed {
+				t.Errorf("Handle() returned AdmissionResponse.Allowed = %v, but expected AdmissionResponse.Allowed = %v", resp.Allowed, true)
+				return
+			}
+			if tt.wantObserveOnly {
+				if len(resp.Patches) != 0 {
+					t.Errorf("Handle() returned %d patches in observe-only mode, but expected none", len(resp.Patches))
+				}
+				if resp.AuditAnnotations[AuditAnnotationObserveOnly] != "true" {
+					t.Errorf("Handle() returned audit annotations = %v, but expected %s = true", resp.AuditAnnotations, AuditAnnotationObserveOnly)
+				}
+				var wouldBePatch []jsonpatch.Operation
+				if err := json.Unmarshal([]byte(resp.AuditAnnotations[AuditAnnotationWouldBePatch]), &wouldBePatch); err != nil || len(wouldBePatch) == 0 {
+					t.Errorf("Handle() returned would-be patch = %s, but expected the patch operations", resp.AuditAnnotations[AuditAnnotationWouldBePatch])
+				}
+				return
+			}
+			if len(resp.Patches) == 0 {
+				t.Errorf("Handle() returned no patches, but expected the pod to be mutated")
+			}
+			if _, found := resp.AuditAnnotations[AuditAnnotationObserveOnly]; found {
+				t.Errorf("Handle() returned audit annotations = %v, but expected no %s annotation", resp.AuditAnnotations, AuditAnnotationObserveOnly)
+			}
+		})
+	}
+}
+
+func TestObserveOnlyResponseRedactsPatch(t *testing.T) {
+	patches := []jsonpatch.Operation{
+		{Operation: "add", Path: "/spec/containers/0/env", Value: []interface{}{
+			map[string]interface{}{"name": "OTEL_EXPORTER_OTLP_HEADERS", "value": "authorization=Bearer s3cr3t"},
+			map[string]interface{}{"name": "SERVICE_NAME", "value": "checkout"},
+		}},
+		{Operation: "replace", Path: "/spec/containers/1/env/0/value", Value: "s3cr3t"},
+	}
+	for idx := 0; idx < maxAuditPatchOperations; idx++ {
+		patches = append(patches, jsonpatch.Operation{Operation: "add", Path: "/metadata/labels/label" + strconv.Itoa(idx), Value: "value"})
+	}
+
+	resp := observeOnlyResponse(logger, "Pod", admission.Patched("", patches...))
+
+	if annotation := resp.AuditAnnotations[AuditAnnotationWouldBePatch]; strings.Contains(annotation, "s3cr3t") || strings.Contains(annotation, "checkout") {
+		t.Errorf("observeOnlyResponse() returned would-be patch = %s, but expected the operations & paths only", annotation)
+	}
+	var summary []jsonpatch.Operation
+	if err := json.Unmarshal([]byte(resp.AuditAnnotations[AuditAnnotationWouldBePatch]), &summary); err != nil || len(summary) != maxAuditPatchOperations {
+		t.Errorf("observeOnlyResponse() returned %d would-be patch operations, but expected = %d", len(summary), maxAuditPatchOperations)
+	}
+	if got, want := resp.AuditAnnotations[AuditAnnotationWouldBePatchOperations], strconv.Itoa(len(patches)); got != want {
+		t.Errorf("observeOnlyResponse() returned would-be patch operations = %s, but expected = %s", got, want)
+	}
+
+	redacted, err := json.Marshal(redactPatch(patches[:2]))
+	if err != nil {
+		t.Errorf("Error occurred in marshaling the redacted patch: %v", err)
+		return
+	}
+	if strings.Contains(string(redacted), "s3cr3t") {
+		t.Errorf("redactPatch() = %s, but expected the sensitive values to be redacted", redacted)
+	}
+	if !strings.Contains(string(redacted), "checkout") {
+		t.Errorf("redactPatch() = %s, but expected the values of the other env variables to be kept", redacted)
+	}
+	if patches[1].Value != "s3cr3t" {
+		t.Errorf("redactPatch() modified the patch = %v, but expected the copy to be redacted", patches[1])
+	}
+}
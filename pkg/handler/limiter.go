@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/metrics"
+)
+
+// budgetRatio is the share of the admission timeout available for handling the request,
+// rest of the timeout is the margin for the response to reach the API server
+const budgetRatio = 0.8
+
+// Limiter limits the number of the admission requests handled concurrently and the time budget of each request.
+// Nil Limiter does not limit the requests.
+type Limiter struct {
+	inFlight chan struct{}
+	budget   time.Duration
+}
+
+// NewLimiter returns the Limiter allowing maxInFlight requests at a time, with the time budget derived from the admission timeout.
+// maxInFlight <= 0 does not limit the in-flight requests, admissionTimeout <= 0 does not limit the time budget.
+func NewLimiter(maxInFlight int, admissionTimeout time.Duration) *Limiter {
+	limiter := &Limiter{budget: time.Duration(float64(admissionTimeout) * budgetRatio)}
+	if maxInFlight > 0 {
+		limiter.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return limiter
+}
+
+// Budget returns the time budget of a request
+func (l *Limiter) Budget() time.Duration {
+	if l == nil {
+		return 0
+	}
+	return l.budget
+}
+
+// Acquire waits for the in-flight slot until the time budget of the request is exhausted, returned context is bounded by the budget.
+// release must be called once the request is handled, ok is false if the request is to be shed.
+func (l *Limiter) Acquire(ctx context.Context) (context.Context, func(), bool) {
+	if l == nil {
+		return ctx, func() {}, true
+	}
+
+	cancel := func() {}
+	if l.budget > 0 {
+		ctx, cancel = context.WithTimeout(ctx, l.budget)
+	}
+	if l.inFlight == nil {
+		return ctx, cancel, true
+	}
+
+	select {
+	case l.inFlight <- struct{}{}:
+		metrics.AdmissionInFlightRequests.Inc()
+		return ctx, func() {
+			<-l.inFlight
+			metrics.AdmissionInFlightRequests.Dec()
+			cancel()
+		}, true
+	case <-ctx.Done():
+		return ctx, cancel, false
+	}
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterAcquire(t *testing.T) {
+	tests := []struct {
+		name             string
+		maxInFlight      int
+		admissionTimeout time.Duration
+		acquired         int
+		wantOK           bool
+		wantDeadline     bool
+	}{
+		{name: "Unlimited requests", acquired: 10, wantOK: true},
+		{name: "Slot is available", maxInFlight: 2, admissionTimeout: time.Second, acquired: 1, wantOK: true, wantDeadline: true},
+		{name: "Request is shed once the budget is exhausted", maxInFlight: 2, admissionTimeout: 50 * time.Millisecond, acquired: 2, wantOK: false, wantDeadline: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewLimiter(tt.maxInFlight, tt.admissionTimeout)
+			for i := 0; i < tt.acquired; i++ {
+				_, release, ok := limiter.Acquire(context.Background())
+				if !ok {
+					t.Errorf("Acquire() = false for the request %d, but expected = true", i)
+					return
+				}
+				defer release()
+			}
+
+			ctx, release, ok := limiter.Acquire(context.Background())
+			defer release()
+			if ok != tt.wantOK {
+				t.Errorf("Acquire() = %v, but expected = %v", ok, tt.wantOK)
+			}
+			if _, hasDeadline := ctx.Deadline(); hasDeadline != tt.wantDeadline {
+				t.Errorf("Acquire() returned context with deadline = %v, but expected = %v", hasDeadline, tt.wantDeadline)
+			}
+		})
+	}
+}
+
+func TestLimiterRelease(t *testing.T) {
+	limiter := NewLimiter(1, time.Second)
+	_, release, ok := limiter.Acquire(context.Background())
+	if !ok {
+		t.Errorf("Acquire() = false, but expected = true")
+		return
+	}
+	release()
+	_, release, ok = limiter.Acquire(context.Background())
+	defer release()
+	if !ok {
+		t.Errorf("Acquire() = false after the release, but expected = true")
+	}
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/metrics"
+	"gomodules.xyz/jsonpatch/v2"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Audit annotations of the admission requests handled in observe-only mode
+const (
+	AuditAnnotationObserveOnly            = "observe-only"
+	AuditAnnotationWouldBePatch           = "would-be-patch"
+	AuditAnnotationWouldBePatchOperations = "would-be-patch-operations"
+)
+
+// maxAuditPatchOperations is the max number of the would-be patch operations added to the audit annotation,
+// as the audit annotations are stored along with each audit event
+const maxAuditPatchOperations = 50
+
+// envValuePathExp matches the patch paths within an env variable of a container, the name of which is not known from the path
+var envValuePathExp = regexp.MustCompile(`/env/\d+/`)
+
+// observeOnlyResponse turns the patch response into the allowed response without patch,
+// would-be patch is logged, counted & summarized in the audit annotations, so that the mutation can be reviewed before it is applied.
+// Values of the sensitive env variables are redacted in the log, audit annotation holds the operations & paths only.
+func observeOnlyResponse(logger logr.Logger, kind string, resp admission.Response) admission.Response {
+	if !resp.Allowed {
+		return resp
+	}
+
+	outcome := metrics.ObserveOutcomeUnchanged
+	if len(resp.Patches) > 0 {
+		outcome = metrics.ObserveOutcomeWouldMutate
+	}
+	metrics.ObservedAdmissions.WithLabelValues(kind, outcome).Inc()
+	for _, operation := range resp.Patches {
+		metrics.ObservedPatchOperations.WithLabelValues(kind, operation.Operation).Inc()
+	}
+	patch, err := json.Marshal(redactPatch(resp.Patches))
+	if err != nil {
+		logger.Error(err, "Error in marshaling the would-be patch")
+		patch = []byte("[]")
+	}
+	logger.Info("Observe-only mode, allowing without the patch", "outcome", outcome, "wouldBePatch", string(patch))
+
+	observed := admission.Allowed("observe-only mode, patch is not applied")
+	observed.AuditAnnotations = map[string]string{
+		AuditAnnotationObserveOnly:            "true",
+		AuditAnnotationWouldBePatch:           summarizePatch(resp.Patches),
+		AuditAnnotationWouldBePatchOperations: strconv.Itoa(len(resp.Patches)),
+	}
+	observed.Warnings = resp.Warnings
+	return observed
+}
+
+// summarizePatch returns the JSON encoded operations & paths of the patch without the values, up to maxAuditPatchOperations
+func summarizePatch(patches []jsonpatch.Operation) string {
+	if len(patches) > maxAuditPatchOperations {
+		patches = patches[:maxAuditPatchOperations]
+	}
+	summary := make([]jsonpatch.Operation, 0, len(patches))
+	for _, operation := range patches {
+		summary = append(summary, jsonpatch.Operation{Operation: operation.Operation, Path: operation.Path})
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
+
+// redactPatch returns the copy of the patch with the values of the sensitive env variables redacted.
+// Value set within an env variable, like its value alone, is redacted as the name of the env variable is not known.
+func redactPatch(patches []jsonpatch.Operation) []jsonpatch.Operation {
+	redacted := make([]jsonpatch.Operation, 0, len(patches))
+	for _, operation := range patches {
+		if operation.Value != nil && envValuePathExp.MatchString(operation.Path) {
+			operation.Value = config.RedactedValue
+		} else {
+			operation.Value = config.RedactEnvValues(operation.Value)
+		}
+		redacted = append(redacted, operation)
+	}
+	return redacted
+}
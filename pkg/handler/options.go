@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/mutation"
+)
+
+// Options holds the settings shared by the pod, workload & custom resource mutation handlers
+type Options struct {
+	// Limiter limits the in-flight requests & the time budget of each request, requests are not limited if it is nil
+	Limiter *Limiter
+
+	// WorkloadLookup, Cache & SecretCopier are passed to the mutations as is, see mutation.Params
+	WorkloadLookup mutation.WorkloadLookupOptions
+	Cache          *mutation.MutationCache
+	SecretCopier   mutation.SecretCopier
+
+	// ObserveOnly records the mutations as a dry run, unless overridden by the namespace annotation
+	ObserveOnly bool
+
+	// Recorder saves the sanitized requests & the resulting patches to be replayed against the later versions, nothing is recorded if it is nil
+	Recorder *Recorder
+}
+
+// apply sets the options used by the mutations on the params
+func (options Options) apply(params *mutation.Params) {
+	params.WorkloadLookup = options.WorkloadLookup
+	params.Cache = options.Cache
+	params.SecretCopier = options.SecretCopier
+}
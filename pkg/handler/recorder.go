@@ -0,0 +1,295 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/clusterinfo"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// captureFileExt is the extension of the capture files
+	captureFileExt = ".json"
+
+	// recorderQueueSize is the max number of the captures queued to be saved
+	recorderQueueSize = 100
+
+	// lastAppliedConfigAnnotation holds the manifest applied by kubectl, which may hold the sensitive values as is
+	lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// Capture is the sanitized admission request saved by the Recorder along with the resulting patch
+type Capture struct {
+	// ClusterName & ConfigHash are the cluster name & the hash of the external config the request is mutated with
+	ClusterName string `json:"clusterName,omitempty"`
+	ConfigHash  string `json:"configHash,omitempty"`
+
+	Request  admissionv1.AdmissionRequest   `json:"request"`
+	Patch    []jsonpatch.JsonPatchOperation `json:"patch"`
+	Warnings []string                       `json:"warnings,omitempty"`
+}
+
+// Recorder saves the sanitized admission requests & the resulting patches to the capture directory,
+// so that the captures can be replayed against the later versions of the mutations.
+// Captures are queued by the admission requests and saved by the recorder running along with the manager, off the admission path.
+type Recorder struct {
+	Dir string
+	Log logr.Logger
+
+	// MaxCaptures & MaxBytes are the max number & the max total size of the captures saved by the recorder, both must be positive
+	MaxCaptures int64
+	MaxBytes    int64
+
+	queue chan captureRequest
+	// full is set once either of the limits is reached, captures are not queued afterwards
+	full int32
+
+	// captures & bytes are accessed by the recorder routine only
+	captures int64
+	bytes    int64
+}
+
+// captureRequest is the admission request of the pod & the mutated pod queued to be captured
+type captureRequest struct {
+	req        admissionv1.AdmissionRequest
+	mutatedPod []byte
+	warnings   []string
+}
+
+// NewRecorder returns the recorder saving up to maxCaptures captures & maxBytes bytes of them to the dir
+func NewRecorder(dir string, logger logr.Logger, maxCaptures int64, maxBytes int64) *Recorder {
+	return &Recorder{
+		Dir:         dir,
+		Log:         logger,
+		MaxCaptures: maxCaptures,
+		MaxBytes:    maxBytes,
+		queue:       make(chan captureRequest, recorderQueueSize),
+	}
+}
+
+// Record queues the admission request of the pod & the mutated pod to be captured, it never blocks the admission request.
+// Capture is dropped if the queue is full, as the recording must not slow down or fail the request.
+func (r *Recorder) Record(req admission.Request, mutatedPod []byte, warnings []string) {
+	if r == nil || atomic.LoadInt32(&r.full) == 1 {
+		return
+	}
+	select {
+	case r.queue <- captureRequest{req: req.AdmissionRequest, mutatedPod: mutatedPod, warnings: append([]string(nil), warnings...)}:
+	default:
+		r.Log.V(1).Info("Capture queue is full, dropping the capture", "uid", req.UID)
+	}
+}
+
+// RecordPodTemplate queues the pod built from the pod template of the workload or the custom resource & the mutated pod to be captured,
+// as the request creating the pod named after the workload, so that it is replayed as the orphan pod getting the same workload name.
+func (r *Recorder) RecordPodTemplate(req admission.Request, workloadName string, template *corev1.PodTemplateSpec, mutatedPod *corev1.Pod, warnings []string) {
+	if r == nil || atomic.LoadInt32(&r.full) == 1 {
+		return
+	}
+	pod := &corev1.Pod{ObjectMeta: *template.ObjectMeta.DeepCopy(), Spec: template.Spec}
+	pod.Name, pod.Namespace = workloadName, req.Namespace
+	mutated := mutatedPod.DeepCopy()
+	mutated.Name = workloadName
+	original, err := json.Marshal(pod)
+	if err != nil {
+		r.Log.Error(err, "Error in marshaling the pod of the pod template", "uid", req.UID)
+		return
+	}
+	marshaledPod, err := json.Marshal(mutated)
+	if err != nil {
+		r.Log.Error(err, "Error in marshaling the mutated pod of the pod template", "uid", req.UID)
+		return
+	}
+
+	podReq := req.AdmissionRequest.DeepCopy()
+	podReq.Kind = metav1.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	podReq.Resource = metav1.GroupVersionResource{Version: "v1", Resource: "pods"}
+	podReq.RequestKind, podReq.RequestResource, podReq.SubResource = nil, nil, ""
+	podReq.Name = workloadName
+	podReq.Operation = admissionv1.Create
+	podReq.Object = runtime.RawExtension{Raw: original}
+	r.Record(admission.Request{AdmissionRequest: *podReq}, marshaledPod, warnings)
+}
+
+// Start saves the queued captures until the context is done
+func (r *Recorder) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case captureReq := <-r.queue:
+			r.capture(captureReq)
+		}
+	}
+}
+
+// NeedLeaderElection implements the LeaderElectionRunnable, each replica captures the requests it handles
+func (r *Recorder) NeedLeaderElection() bool {
+	return false
+}
+
+// capture sanitizes & saves the queued capture within the limits, errors are logged as there is no request to fail
+func (r *Recorder) capture(captureReq captureRequest) {
+	if atomic.LoadInt32(&r.full) == 1 {
+		return
+	}
+	capture, err := NewCapture(captureReq.req, captureReq.mutatedPod, captureReq.warnings)
+	if err != nil {
+		r.Log.Error(err, "Error in capturing the admission request", "uid", captureReq.req.UID)
+		return
+	}
+	data, err := encodeCapture(capture)
+	if err != nil {
+		r.Log.Error(err, "Error in encoding the admission request capture", "uid", captureReq.req.UID)
+		return
+	}
+	if r.captures >= r.MaxCaptures || r.bytes+int64(len(data)) > r.MaxBytes {
+		atomic.StoreInt32(&r.full, 1)
+		r.Log.Info("Capture limit is reached, admission requests are not captured anymore", "captures", r.captures, "bytes", r.bytes)
+		return
+	}
+	if err := r.save(capture.Request.UID, data); err != nil {
+		r.Log.Error(err, "Error in saving the admission request capture", "uid", captureReq.req.UID)
+		return
+	}
+	r.captures++
+	r.bytes += int64(len(data))
+	if r.captures >= r.MaxCaptures {
+		atomic.StoreInt32(&r.full, 1)
+	}
+}
+
+// encodeCapture returns the indented JSON encoded capture
+func encodeCapture(capture *Capture) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(capture); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// save writes the capture to the temp file, which is renamed afterwards, so that the partially written captures are never replayed
+func (r *Recorder) save(uid types.UID, data []byte) error {
+	name := fmt.Sprintf("%s-%s%s", time.Now().UTC().Format("20060102T150405.000000000"), uid, captureFileExt)
+	path := filepath.Join(r.Dir, name)
+	tempPath := filepath.Join(r.Dir, "."+name+".tmp")
+	if err := ioutil.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+// NewCapture returns the sanitized capture of the admission request of the pod & the mutated pod.
+// Sensitive env values, kubectl last applied configuration, managed fields & user info are removed from the request,
+// and the patch is created between the sanitized pods, so that the replayed patches can be compared with it as is.
+func NewCapture(req admissionv1.AdmissionRequest, mutatedPod []byte, warnings []string) (*Capture, error) {
+	original, err := sanitizePod(req.Object.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("pod in the request is not sanitized: %w", err)
+	}
+	patch, err := sanitizedPatch(original, mutatedPod)
+	if err != nil {
+		return nil, err
+	}
+	req.Object = runtime.RawExtension{Raw: original}
+	req.OldObject = runtime.RawExtension{}
+	req.UserInfo = authenticationv1.UserInfo{}
+	return &Capture{
+		ClusterName: clusterinfo.Name(),
+		ConfigHash:  config.GetConfigInfo().Hash,
+		Request:     req,
+		Patch:       patch,
+		Warnings:    warnings,
+	}, nil
+}
+
+// LoadCaptures loads the captures saved in the directory, keyed by their file names
+func LoadCaptures(dir string) (map[string]*Capture, error) {
+	files, err := ioutil.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+	captures := make(map[string]*Capture)
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") || filepath.Ext(file.Name()) != captureFileExt {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		capture := &Capture{}
+		if err := json.Unmarshal(data, capture); err != nil {
+			return nil, fmt.Errorf("capture %s is not valid: %w", file.Name(), err)
+		}
+		captures[file.Name()] = capture
+	}
+	return captures, nil
+}
+
+// sanitizedPatch returns the patch between the sanitized original pod & the mutated pod, sorted by the path to be compared as is
+func sanitizedPatch(sanitizedOriginal []byte, mutatedPod []byte) ([]jsonpatch.JsonPatchOperation, error) {
+	mutated, err := sanitizePod(mutatedPod)
+	if err != nil {
+		return nil, fmt.Errorf("mutated pod is not sanitized: %w", err)
+	}
+	patch, err := jsonpatch.CreatePatch(sanitizedOriginal, mutated)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(patch, func(i, j int) bool {
+		return patch[i].Path < patch[j].Path
+	})
+	return patch, nil
+}
+
+// sanitizePod returns the JSON encoded pod without the sensitive env values, kubectl last applied configuration & managed fields
+func sanitizePod(raw []byte) ([]byte, error) {
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(raw, pod); err != nil {
+		return nil, err
+	}
+	pod.ManagedFields = nil
+	delete(pod.Annotations, lastAppliedConfigAnnotation)
+	for idx := range pod.Spec.InitContainers {
+		redactEnv(pod.Spec.InitContainers[idx].Env)
+	}
+	for idx := range pod.Spec.Containers {
+		redactEnv(pod.Spec.Containers[idx].Env)
+	}
+	for idx := range pod.Spec.EphemeralContainers {
+		redactEnv(pod.Spec.EphemeralContainers[idx].Env)
+	}
+	return json.Marshal(pod)
+}
+
+// redactEnv redacts the values of the sensitive env variables
+func redactEnv(env []corev1.EnvVar) {
+	for idx := range env {
+		if env[idx].Value != "" && config.IsSensitiveEnvName(env[idx].Name) {
+			env[idx].Value = config.RedactedValue
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/logicmonitor/lm-k8s-webhook/internal/testutil"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// newPodRequest returns the admission request creating the pod
+func newPodRequest(uid string, namespace string, pod string) admission.Request {
+	return admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       types.UID(uid),
+			Kind:      v1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Resource:  v1.GroupVersionResource{Version: "v1", Resource: "pods"},
+			Namespace: namespace,
+			Operation: admissionv1.Create,
+			UserInfo:  authenticationv1.UserInfo{Username: "jane@example.com", Groups: []string{"system:authenticated"}},
+			Object:    runtime.RawExtension{Raw: []byte(pod)},
+		},
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	os.Setenv("CLUSTER_NAME", "default")
+	defer os.Unsetenv("CLUSTER_NAME")
+	if err := config.LoadConfig("testdata/captures/config.yaml"); err != nil {
+		t.Fatalf("Error occurred in loading the config: %v", err)
+	}
+	k8sClient, err := testutil.NewFakeK8sClient()
+	if err != nil {
+		t.Fatalf("Error occurred in getting fake k8s client: %v", err)
+	}
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatalf("Error occurred in getting decoder: %v", err)
+	}
+
+	dir := t.TempDir()
+	recorder := NewRecorder(dir, logger, 1, 1<<20)
+	podMutationHandler := &LMPodMutationHandler{
+		Client:  k8sClient,
+		Log:     logger,
+		decoder: decoder,
+		Options: Options{Recorder: recorder},
+	}
+	pod := `{
+		"apiVersion": "v1",
+		"kind": "Pod",
+		"metadata": {
+			"name": "foo",
+			"annotations": {"kubectl.kubernetes.io/last-applied-configuration": "{\"API_TOKEN\": \"p0d-t0ken\"}"},
+			"managedFields": [{"manager": "kubectl", "operation": "Update"}]
+		},
+		"spec": {"containers": [{"image": "bar:v2", "name": "bar", "env": [{"name": "API_TOKEN", "value": "p0d-t0ken"}]}]}
+	}`
+
+	podMutationHandler.Handle(context.Background(), newPodRequest("0f1e2d3c-4b5a-4969-8877-665544332211", "default", pod))
+	podMutationHandler.Handle(context.Background(), newPodRequest("1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d", "default", pod))
+	drainRecorder(recorder)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Error occurred in reading the capture directory: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Recorder saved %d captures, but expected = %d", len(files), 1)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatalf("Error occurred in reading the capture: %v", err)
+	}
+	for _, sensitive := range []string{"p0d-t0ken", "s3cr3t-api-key", "jane@example.com", "last-applied-configuration", "managedFields"} {
+		if strings.Contains(string(data), sensitive) {
+			t.Errorf("Recorder saved the capture containing %q, but expected it to be sanitized", sensitive)
+		}
+	}
+
+	captures, err := LoadCaptures(dir)
+	if err != nil {
+		t.Fatalf("LoadCaptures() returned error = %v, but expected = nil", err)
+	}
+	capture := captures[files[0].Name()]
+	if capture == nil || len(capture.Patch) == 0 {
+		t.Fatalf("LoadCaptures() returned capture = %v, but expected the capture with the patch", capture)
+	}
+	patch, _, err := podMutationHandler.Replay(context.Background(), capture)
+	if err != nil {
+		t.Fatalf("Replay() returned error = %v, but expected = nil", err)
+	}
+	if diff := cmp.Diff(capture.Patch, patch); diff != "" {
+		t.Errorf("Replay() returned patch different from the captured patch (-captured +replayed):\n%s", diff)
+	}
+}
+
+// drainRecorder saves the queued captures, as the recorder routine does
+func drainRecorder(recorder *Recorder) {
+	for len(recorder.queue) > 0 {
+		recorder.capture(<-recorder.queue)
+	}
+}
+
+func TestRecorderLimits(t *testing.T) {
+	pod := `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "foo"}, "spec": {"containers": [{"image": "bar:v2", "name": "bar"}]}}`
+	tests := []struct {
+		name         string
+		maxCaptures  int64
+		maxBytes     int64
+		requests     int
+		wantCaptures int
+	}{
+		{
+			name:         "Captures are limited by number",
+			maxCaptures:  2,
+			maxBytes:     1 << 20,
+			requests:     3,
+			wantCaptures: 2,
+		},
+		{
+			name:         "Captures are limited by total size",
+			maxCaptures:  10,
+			maxBytes:     1,
+			requests:     3,
+			wantCaptures: 0,
+		},
+		{
+			name:         "Captures exceeding the queue are dropped",
+			maxCaptures:  1000,
+			maxBytes:     1 << 30,
+			requests:     recorderQueueSize + 10,
+			wantCaptures: recorderQueueSize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			recorder := NewRecorder(dir, logger, tt.maxCaptures, tt.maxBytes)
+			for idx := 0; idx < tt.requests; idx++ {
+				recorder.Record(newPodRequest(fmt.Sprintf("0f1e2d3c-4b5a-4969-8877-%012d", idx), "default", pod), []byte(pod), nil)
+			}
+			drainRecorder(recorder)
+
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("Error occurred in reading the capture directory: %v", err)
+			}
+			if len(files) != tt.wantCaptures {
+				t.Errorf("Recorder saved %d captures, but expected = %d", len(files), tt.wantCaptures)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/mutation"
+	"gomodules.xyz/jsonpatch/v2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Replay runs the mutations of the handler on the pod of the capture and returns the patch comparable with the captured one.
+// Mutations are run as a dry run without the limiter & the observe-only mode, so that only the mutations decide the patch.
+func (podMutationHandler *LMPodMutationHandler) Replay(ctx context.Context, capture *Capture) ([]jsonpatch.JsonPatchOperation, []string, error) {
+	raw := capture.Request.Object.Raw
+	if len(raw) == 0 {
+		return nil, nil, errors.New("capture does not hold the pod")
+	}
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(raw, pod); err != nil {
+		return nil, nil, err
+	}
+
+	params := NewParams(pod, podMutationHandler, capture.Request.Namespace)
+	params.Cache = nil
+	params.DryRun = true
+	if err := mutation.RunMutations(ctx, params); err != nil {
+		return nil, nil, err
+	}
+
+	marshaledPod, err := json.Marshal(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	original, err := sanitizePod(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	patch, err := sanitizedPatch(original, marshaledPod)
+	return patch, params.Warnings, err
+}
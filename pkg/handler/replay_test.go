@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/logicmonitor/lm-k8s-webhook/internal/testutil"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/clusterinfo"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// capturesDir is the directory of the captures replayed by TestReplayCaptures.
+// It holds the config.yaml the captures are mutated with, and optionally the objects.yaml holding the k8s objects looked up by the mutations,
+// so the captures of the clusters can be replayed by: go test ./pkg/handler -run TestReplayCaptures -captures <dir>
+var capturesDir = flag.String("captures", "testdata/captures", "Directory of the admission request captures to replay")
+
+// loadObjects loads the k8s objects of the YAML documents in the file, file is optional
+func loadObjects(path string) ([]runtime.Object, error) {
+	data, err := ioutil.ReadFile(filepath.Clean(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var objects []runtime.Object
+	decoder := clientgoscheme.Codecs.UniversalDeserializer()
+	for _, doc := range strings.Split(string(data), "\n---") {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		object, _, err := decoder.Decode([]byte(doc), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+func TestReplayCaptures(t *testing.T) {
+	if err := config.LoadConfig(filepath.Join(*capturesDir, "config.yaml")); err != nil {
+		t.Fatalf("Error occurred in loading the config of the captures: %v", err)
+	}
+	objects, err := loadObjects(filepath.Join(*capturesDir, "objects.yaml"))
+	if err != nil {
+		t.Fatalf("Error occurred in loading the objects of the captures: %v", err)
+	}
+	k8sClient, err := testutil.NewFakeK8sClient(objects...)
+	if err != nil {
+		t.Fatalf("Error occurred in getting fake k8s client: %v", err)
+	}
+	captures, err := LoadCaptures(*capturesDir)
+	if err != nil {
+		t.Fatalf("Error occurred in loading the captures: %v", err)
+	}
+	if len(captures) == 0 {
+		t.Fatalf("No captures found in %s", *capturesDir)
+	}
+	defer os.Unsetenv(clusterinfo.ClusterNameEnv)
+
+	podMutationHandler := &LMPodMutationHandler{Client: k8sClient, Log: logger}
+	configHash := config.GetConfigInfo().Hash
+
+	names := make([]string, 0, len(captures))
+	for name := range captures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		capture := captures[name]
+		t.Run(name, func(t *testing.T) {
+			os.Setenv(clusterinfo.ClusterNameEnv, capture.ClusterName)
+			patch, warnings, err := podMutationHandler.Replay(context.Background(), capture)
+			if err != nil {
+				t.Errorf("Replay() returned error = %v, but expected = nil", err)
+				return
+			}
+			if diff := cmp.Diff(capture.Patch, patch); diff != "" {
+				if capture.ConfigHash != "" && capture.ConfigHash != configHash {
+					t.Logf("Capture is mutated with the config of hash %s, but replayed with %s", capture.ConfigHash, configHash)
+				}
+				t.Errorf("Replay() returned patch different from the captured patch (-captured +replayed):\n%s", diff)
+			}
+			if diff := cmp.Diff(capture.Warnings, warnings); diff != "" {
+				t.Errorf("Replay() returned warnings different from the captured warnings (-captured +replayed):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/metrics"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/mutation"
+	"gomodules.xyz/jsonpatch/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// LMWorkloadMutationHandler represents the handler for the admission requests of the workload resources,
+// pod template of the workload is mutated, so that the injected env variables are visible in the workload spec.
+// Mutated template is annotated with the TemplateMutatedAnnotation, so that the pods created from it are not mutated again.
+type LMWorkloadMutationHandler struct {
+	Client  *config.K8sClient
+	decoder *admission.Decoder
+	Log     logr.Logger
+
+	Options
+}
+
+// Handle is called internally to handle the admission request
+func (workloadMutationHandler *LMWorkloadMutationHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := workloadMutationHandler.Log.WithValues("lm-workloadmutator-webhook", fmt.Sprintf("%s/%s/%s", req.Kind.Kind, req.Namespace, req.Name))
+
+	logger.Info("Received admission request:", req.Namespace, req.Name)
+
+	ctx, release, ok := workloadMutationHandler.Limiter.Acquire(ctx)
+	defer release()
+	if !ok {
+		logger.Info("In-flight limit is reached within the time budget, allowing the workload without mutation", "budget", workloadMutationHandler.Limiter.Budget())
+		metrics.AdmissionRequestsShed.WithLabelValues(metrics.ShedReasonInFlightLimit).Inc()
+		return admission.Allowed("in-flight limit is reached, workload is not mutated")
+	}
+
+	workload, template, templatePath, err := workloadMutationHandler.decodeWorkload(req)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if workload == nil {
+		logger.Info("Workload kind is not supported, skipping the mutation")
+		return admission.Allowed("workload kind is not supported")
+	}
+
+	// Pod is built from the pod template, mutations are applied on the pod spec
+	pod := &corev1.Pod{ObjectMeta: *template.ObjectMeta.DeepCopy(), Spec: *template.Spec.DeepCopy()}
+	pod.Namespace = req.Namespace
+
+	logger.Info("Calling mutation")
+
+	params := NewWorkloadParams(pod, workloadMutationHandler.Client, workloadMutationHandler.Log, req.Namespace, workload.GetName())
+	workloadMutationHandler.Options.apply(params)
+	params.DryRun = req.DryRun != nil && *req.DryRun
+	observeOnly := mutation.IsObserveOnly(ctx, params, workloadMutationHandler.ObserveOnly)
+	params.DryRun = params.DryRun || observeOnly
+
+	if err := mutation.RunMutations(ctx, params); err != nil {
+		if ctx.Err() != nil {
+			logger.Error(err, "Time budget is exhausted in mutating the k8s resource, allowing the workload without mutation")
+			metrics.AdmissionRequestsShed.WithLabelValues(metrics.ShedReasonBudgetExhausted).Inc()
+			return admission.Allowed("time budget is exhausted, workload is not mutated")
+		}
+		logger.Error(err, "Error occurred in mutating the k8s resource")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	logger.Info("End mutation")
+
+	// Patches are limited to the pod spec & the mutated annotation of the template, so that the rest of the workload is not touched
+	patches, err := getPodSpecPatches(template.Spec, pod.Spec, templatePath+"/spec")
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	patches = append(patches, getTemplateMutatedPatches(template.ObjectMeta, templatePath+"/metadata", len(patches) > 0)...)
+	workloadMutationHandler.Recorder.RecordPodTemplate(req, workload.GetName(), template, pod, params.Warnings)
+
+	resp := admission.Patched("", patches...).WithWarnings(params.Warnings...)
+	if observeOnly {
+		return observeOnlyResponse(logger, req.Kind.Kind, resp)
+	}
+	return resp
+}
+
+// decodeWorkload decodes the workload resource of the request and returns it along with its pod template & the JSON path of the pod template,
+// nil workload is returned if the kind is not supported
+func (workloadMutationHandler *LMWorkloadMutationHandler) decodeWorkload(req admission.Request) (client.Object, *corev1.PodTemplateSpec, string, error) {
+	switch req.Kind.Kind {
+	case mutation.WorkloadResourceDeployment:
+		workload := &appsv1.Deployment{}
+		err := workloadMutationHandler.decoder.Decode(req, workload)
+		return workload, &workload.Spec.Template, "/spec/template", err
+	case mutation.WorkloadResourceStatefulSet:
+		workload := &appsv1.StatefulSet{}
+		err := workloadMutationHandler.decoder.Decode(req, workload)
+		return workload, &workload.Spec.Template, "/spec/template", err
+	case mutation.WorkloadResourceDaemonSet:
+		workload := &appsv1.DaemonSet{}
+		err := workloadMutationHandler.decoder.Decode(req, workload)
+		return workload, &workload.Spec.Template, "/spec/template", err
+	case mutation.WorkloadResourceJob:
+		workload := &batchv1.Job{}
+		err := workloadMutationHandler.decoder.Decode(req, workload)
+		return workload, &workload.Spec.Template, "/spec/template", err
+	case mutation.WorkloadResourceCronJob:
+		workload := &batchv1.CronJob{}
+		err := workloadMutationHandler.decoder.Decode(req, workload)
+		return workload, &workload.Spec.JobTemplate.Spec.Template, "/spec/jobTemplate/spec/template", err
+	}
+	return nil, nil, "", nil
+}
+
+// InjectDecoder injects the decoder.
+func (a *LMWorkloadMutationHandler) InjectDecoder(d *admission.Decoder) error {
+	a.decoder = d
+	return nil
+}
+
+// NewWorkloadParams returns Params object for mutating the pod spec embedded in the workload
+func NewWorkloadParams(pod *corev1.Pod, k8sClient *config.K8sClient, log logr.Logger, namespace string, workloadName string) *mutation.Params {
+	return &mutation.Params{
+		Client:       k8sClient,
+		Pod:          pod,
+		LMConfig:     config.GetConfig(),
+		Mutations:    mutation.Mutations,
+		Namespace:    namespace,
+		WorkloadName: workloadName,
+		Log:          log,
+	}
+}
+
+// getPodSpecPatches returns the JSON patches of the mutated pod spec, paths of the patches are prefixed with the JSON path of the pod spec
+func getPodSpecPatches(podSpec corev1.PodSpec, mutatedPodSpec corev1.PodSpec, podSpecPath string) ([]jsonpatch.JsonPatchOperation, error) {
+	marshaledSpec, err := json.Marshal(podSpec)
+	if err != nil {
+		return nil, err
+	}
+	marshaledMutatedSpec, err := json.Marshal(mutatedPodSpec)
+	if err != nil {
+		return nil, err
+	}
+	patches, err := jsonpatch.CreatePatch(marshaledSpec, marshaledMutatedSpec)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range patches {
+		patches[idx].Path = podSpecPath + patches[idx].Path
+	}
+	return patches, nil
+}
+
+// getTemplateMutatedPatches returns the JSON patches annotating the pod template with the hash of the config it is mutated with.
+// Template is annotated if it is mutated now, or the annotation is refreshed if the template is mutated with the previous config.
+func getTemplateMutatedPatches(metadata metav1.ObjectMeta, metadataPath string, mutated bool) []jsonpatch.JsonPatchOperation {
+	hash := config.GetConfigInfo().Hash
+	current, found := metadata.Annotations[mutation.TemplateMutatedAnnotation]
+	if (!mutated && !found) || (found && current == hash) {
+		return nil
+	}
+	if metadata.Annotations == nil {
+		return []jsonpatch.JsonPatchOperation{jsonpatch.NewOperation("add", metadataPath+"/annotations", map[string]string{mutation.TemplateMutatedAnnotation: hash})}
+	}
+	return []jsonpatch.JsonPatchOperation{jsonpatch.NewOperation("add", metadataPath+"/annotations/"+jsonPointerEscaper.Replace(mutation.TemplateMutatedAnnotation), hash)}
+}
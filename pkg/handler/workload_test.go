@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/logicmonitor/lm-k8s-webhook/internal/testutil"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/mutation"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestWorkloadHandle(t *testing.T) {
+	k8sClient, err := testutil.NewFakeK8sClient()
+	if err != nil {
+		t.Errorf("Error occurred in getting fake k8s client: %v", err)
+		return
+	}
+	os.Setenv("CLUSTER_NAME", "default")
+	defer os.Unsetenv("CLUSTER_NAME")
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Errorf("Error occurred in getting decoder: %v", err)
+		return
+	}
+
+	podTemplate := `{"metadata": {"labels": {"app": "checkout"}}, "spec": {"containers": [{"image": "bar:v2", "name": "bar"}]}}`
+
+	tests := []struct {
+		name          string
+		kind          v1.GroupVersionKind
+		object        string
+		wantEnvPath   string
+		wantPatched   bool
+		wantNameValue string
+	}{
+		{
+			name:          "Mutate pod template of the deployment",
+			kind:          v1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+			object:        `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "checkout", "namespace": "default"}, "spec": {"selector": {"matchLabels": {"app": "checkout"}}, "template": ` + podTemplate + `}}`,
+			wantEnvPath:   "/spec/template/spec/containers/0/env",
+			wantPatched:   true,
+			wantNameValue: "checkout",
+		},
+		{
+			name:          "Mutate pod template of the cron job",
+			kind:          v1.GroupVersionKind{Group: "batch", Version: "v1", Kind: "CronJob"},
+			object:        `{"apiVersion": "batch/v1", "kind": "CronJob", "metadata": {"name": "report", "namespace": "default"}, "spec": {"schedule": "0 * * * *", "jobTemplate": {"spec": {"template": ` + podTemplate + `}}}}`,
+			wantEnvPath:   "/spec/jobTemplate/spec/template/spec/containers/0/env",
+			wantPatched:   true,
+			wantNameValue: "report",
+		},
+		{
+			name:   "Skip unsupported workload kind",
+			kind:   v1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"},
+			object: `{"apiVersion": "apps/v1", "kind": "ReplicaSet", "metadata": {"name": "checkout-5d8f", "namespace": "default"}, "spec": {"selector": {"matchLabels": {"app": "checkout"}}, "template": ` + podTemplate + `}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workloadMutationHandler := &LMWorkloadMutationHandler{Client: k8sClient, Log: logger, decoder: decoder}
+			resp := workloadMutationHandler.Handle(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					UID:       "1f0b5c3e-4d8a-4b8e-9e36-0a4f1c1e2d7b",
+					Kind:      tt.kind,
+					Namespace: "default",
+					Operation: admissionv1.Create,
+					Object:    runtime.RawExtension{Raw: []byte(tt.object)},
+				},
+			})
+
+			if !resp.Allowed {
+				t.Errorf("Handle() returned AdmissionResponse.Allowed = false, but expected AdmissionResponse.Allowed = true, result = %v", resp.Result)
+				return
+			}
+			if (len(resp.Patches) > 0) != tt.wantPatched {
+				t.Errorf("Handle() returned patches = %v, but patched expected = %v", resp.Patches, tt.wantPatched)
+				return
+			}
+			if !tt.wantPatched {
+				return
+			}
+
+			var serviceName string
+			for _, patch := range resp.Patches {
+				if patch.Path != tt.wantEnvPath {
+					continue
+				}
+				envVars, _ := patch.Value.([]interface{})
+				for _, envVar := range envVars {
+					if env, ok := envVar.(map[string]interface{}); ok && env["name"] == "SERVICE_NAME" {
+						serviceName, _ = env["value"].(string)
+					}
+				}
+			}
+			if serviceName != tt.wantNameValue {
+				t.Errorf("Handle() SERVICE_NAME at %s = %s, but expected = %s, patches = %v", tt.wantEnvPath, serviceName, tt.wantNameValue, resp.Patches)
+			}
+			for _, patch := range resp.Patches {
+				if !strings.HasPrefix(patch.Path, strings.TrimSuffix(tt.wantEnvPath, "/spec/containers/0/env")) {
+					t.Errorf("Handle() returned patch %s outside the pod template", patch.Path)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkloadHandleMarksTemplate(t *testing.T) {
+	k8sClient, err := testutil.NewFakeK8sClient()
+	if err != nil {
+		t.Errorf("Error occurred in getting fake k8s client: %v", err)
+		return
+	}
+	os.Setenv("CLUSTER_NAME", "default")
+	defer os.Unsetenv("CLUSTER_NAME")
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Errorf("Error occurred in getting decoder: %v", err)
+		return
+	}
+	hash := config.GetConfigInfo().Hash
+
+	workloadMutationHandler := &LMWorkloadMutationHandler{Client: k8sClient, Log: logger, decoder: decoder}
+	resp := workloadMutationHandler.Handle(context.Background(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       "5c7e9a1b-3d5f-4b7d-8f1a-2c4e6a8b0d2f",
+			Kind:      v1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+			Namespace: "default",
+			Operation: admissionv1.Create,
+			Object: runtime.RawExtension{Raw: []byte(
+				`{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "checkout", "namespace": "default"}, "spec": {"selector": {"matchLabels": {"app": "checkout"}}, "template": {"metadata": {"labels": {"app": "checkout"}}, "spec": {"containers": [{"image": "bar:v2", "name": "bar"}]}}}}`,
+			)},
+		},
+	})
+	var marked bool
+	for _, patch := range resp.Patches {
+		if patch.Path == "/spec/template/metadata/annotations" && reflect.DeepEqual(patch.Value, map[string]string{mutation.TemplateMutatedAnnotation: hash}) {
+			marked = true
+		}
+	}
+	if !marked {
+		t.Errorf("Handle() returned patches = %v, but expected the %s annotation on the pod template", resp.Patches, mutation.TemplateMutatedAnnotation)
+	}
+
+	tests := []struct {
+		name        string
+		annotation  string
+		wantPatched bool
+	}{
+		{
+			name:        "Skip pod of the template mutated with the current config",
+			annotation:  hash,
+			wantPatched: false,
+		},
+		{
+			name:        "Mutate pod of the template mutated with the previous config",
+			annotation:  "previous-config-hash",
+			wantPatched: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podMutationHandler := &LMPodMutationHandler{Client: k8sClient, Log: logger, decoder: decoder}
+			resp := podMutationHandler.Handle(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					UID:       "6d8f0b2c-4e6a-4c8e-9a2b-3d5f7b9c1e3a",
+					Kind:      v1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+					Resource:  v1.GroupVersionResource{Version: "v1", Resource: "pods"},
+					Namespace: "default",
+					Operation: admissionv1.Create,
+					Object: runtime.RawExtension{Raw: []byte(
+						`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "checkout-1", "annotations": {"` + mutation.TemplateMutatedAnnotation + `": "` + tt.annotation + `"}}, "spec": {"containers": [{"image": "bar:v2", "name": "bar"}]}}`,
+					)},
+				},
+			})
+			if !resp.Allowed {
+				t.Errorf("Handle() returned AdmissionResponse.Allowed = false, but expected AdmissionResponse.Allowed = true, result = %v", resp.Result)
+				return
+			}
+			if (len(resp.Patches) > 0) != tt.wantPatched {
+				t.Errorf("Handle() returned patches = %v, but patched expected = %v", resp.Patches, tt.wantPatched)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "lm_k8s_webhook"
+
+// Reasons of shedding the admission requests
+const (
+	ShedReasonInFlightLimit   = "inflight_limit"
+	ShedReasonBudgetExhausted = "budget_exhausted"
+)
+
+// Results of the cache lookups
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// Results of the serving certificate reloads
+const (
+	CertReloadSuccess = "success"
+	CertReloadFailure = "failure"
+)
+
+// Outcomes of the admission requests handled in observe-only mode
+const (
+	ObserveOutcomeWouldMutate = "would_mutate"
+	ObserveOutcomeUnchanged   = "unchanged"
+)
+
+// DegradedStepWorkloadLookup is the workload lookup skipped by the degraded mutations
+const DegradedStepWorkloadLookup = "workload_lookup"
+
+var (
+	// MutationDuration tracks the time taken by each mutation
+	MutationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mutation_duration_seconds",
+		Help:      "Time taken by the mutation of the pod.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"mutation"})
+
+	// MutationErrors counts the failed mutations
+	MutationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mutation_errors_total",
+		Help:      "Number of the failed mutations.",
+	}, []string{"mutation"})
+
+	// WhenEvaluationDuration tracks the time taken by the evaluation of the when expressions
+	WhenEvaluationDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "when_evaluation_duration_seconds",
+		Help:      "Time taken by the evaluation of the CEL when expression of an env variable.",
+		Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+	})
+
+	// WhenEvaluationCost tracks the CEL runtime cost of the evaluation of the when expressions
+	WhenEvaluationCost = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "when_evaluation_cost",
+		Help:      "CEL runtime cost of the evaluation of the when expression of an env variable.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	})
+
+	// WhenEvaluations counts the evaluations of the when expressions by the result
+	WhenEvaluations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "when_evaluations_total",
+		Help:      "Number of the evaluations of the CEL when expressions by result.",
+	}, []string{"result"})
+
+	// AdmissionInFlightRequests tracks the admission requests being handled
+	AdmissionInFlightRequests = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "admission_inflight_requests",
+		Help:      "Number of the admission requests being handled.",
+	})
+
+	// AdmissionRequestsShed counts the admission requests allowed without mutation to shed the load
+	AdmissionRequestsShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "admission_requests_shed_total",
+		Help:      "Number of the admission requests allowed without mutation, as the in-flight limit or the time budget is exhausted.",
+	}, []string{"reason"})
+
+	// DegradedMutations counts the mutations which skipped a step, as the time budget of the request is exhausted
+	DegradedMutations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "degraded_mutations_total",
+		Help:      "Number of the mutations which skipped a step, as the time budget of the admission request is exhausted.",
+	}, []string{"step"})
+
+	// MutationCacheRequests counts the lookups of the mutation caches by the result
+	MutationCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mutation_cache_requests_total",
+		Help:      "Number of the lookups of the mutation result & owner caches by result, hit or miss.",
+	}, []string{"cache", "result"})
+
+	// ObservedAdmissions counts the admission requests allowed without patch in observe-only mode by the outcome
+	ObservedAdmissions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "observed_admissions_total",
+		Help:      "Number of the admission requests allowed without patch in observe-only mode by the kind of the resource & outcome, would_mutate or unchanged.",
+	}, []string{"kind", "outcome"})
+
+	// ObservedPatchOperations counts the operations of the would-be patches in observe-only mode
+	ObservedPatchOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "observed_patch_operations_total",
+		Help:      "Number of the JSON patch operations, which would be applied if observe-only mode was off, by the kind of the resource & operation.",
+	}, []string{"kind", "operation"})
+
+	// ConfigLoadFailed reports if the last load of the external config failed
+	ConfigLoadFailed = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_load_failed",
+		Help:      "1 if the last load of the external config failed, the previously loaded config is still in use, 0 otherwise.",
+	})
+
+	// ServingCertNotAfter exposes the expiry time of the serving certificate loaded from the cert directory
+	ServingCertNotAfter = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "serving_cert_not_after_timestamp_seconds",
+		Help:      "Expiry time of the serving certificate in unix seconds.",
+	})
+
+	// ServingCertExpirySeconds tracks the time left until the serving certificate expires
+	ServingCertExpirySeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "serving_cert_expiry_seconds",
+		Help:      "Seconds left until the serving certificate expires, negative if it is expired.",
+	})
+
+	// ServingCertReloads counts the reloads of the serving certificate by the result
+	ServingCertReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "serving_cert_reloads_total",
+		Help:      "Number of the reloads of the serving certificate from the cert directory by result, success or failure.",
+	}, []string{"result"})
+
+	// ServingCertCABundleMismatch reports if the caBundle of the MutatingWebhookConfiguration does not verify the serving certificate
+	ServingCertCABundleMismatch = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "serving_cert_cabundle_mismatch",
+		Help:      "1 if the caBundle of any webhook of the MutatingWebhookConfiguration does not verify the serving certificate, 0 otherwise.",
+	})
+
+	// ClusterNameInfo exposes the discovered cluster name along with the strategy by which it is discovered
+	ClusterNameInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cluster_name_info",
+		Help:      "Discovered cluster name and the discovery strategy, value is always 1.",
+	}, []string{"cluster_name", "source"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		MutationDuration,
+		MutationErrors,
+		WhenEvaluationDuration,
+		WhenEvaluationCost,
+		WhenEvaluations,
+		ClusterNameInfo,
+		AdmissionInFlightRequests,
+		AdmissionRequestsShed,
+		DegradedMutations,
+		MutationCacheRequests,
+		ObservedAdmissions,
+		ObservedPatchOperations,
+		ConfigLoadFailed,
+		ServingCertNotAfter,
+		ServingCertExpirySeconds,
+		ServingCertReloads,
+		ServingCertCABundleMismatch,
+	)
+}
@@ -0,0 +1,124 @@
+package mutation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// addMappedAttributesToOtelResAttribute adds the resource attributes mapped from the pod labels & annotations to the OTELResourceAttributes.
+// Attributes which are already present in the OTELResourceAttributes are not overridden.
+func addMappedAttributesToOtelResAttribute(ctx context.Context, pod *corev1.Pod, newEnvVars []corev1.EnvVar, mappings []config.AttributeMapping) []corev1.EnvVar {
+	logger := log.FromContext(ctx).WithName("addMappedAttributesToOtelResAttribute")
+
+	otelResourceAttributesIndex := getIndexOfEnv(newEnvVars, OTELResourceAttributes)
+	if otelResourceAttributesIndex < 0 {
+		return newEnvVars
+	}
+
+	existingKeys := map[string]bool{}
+	for _, attr := range strings.Split(newEnvVars[otelResourceAttributesIndex].Value, ",") {
+		existingKeys[strings.SplitN(attr, "=", 2)[0]] = true
+	}
+
+	var attrs []string
+	for _, mapping := range mappings {
+		entries := pod.Labels
+		if mapping.Source == config.AttributeMappingSourceAnnotation {
+			entries = pod.Annotations
+		}
+		maxAttributes := mapping.MaxAttributes
+		if maxAttributes == 0 {
+			maxAttributes = config.DefaultMaxMappedAttributes
+		}
+
+		// Keys are sorted, so that the same attributes are picked when the cap is reached
+		keys := make([]string, 0, len(entries))
+		for key := range entries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		added := 0
+		for _, key := range keys {
+			if !isKeyAllowed(key, mapping) {
+				continue
+			}
+			attrKey := encodeAttribute(mapping.AttributePrefix + rewriteKey(key, mapping.Rewrite))
+			if attrKey == "" || existingKeys[attrKey] {
+				continue
+			}
+			if added == maxAttributes {
+				logger.Info("max attributes of the mapping reached, skipping the remaining keys", "source", mapping.Source, "maxAttributes", maxAttributes)
+				break
+			}
+			existingKeys[attrKey] = true
+			attrs = append(attrs, fmt.Sprintf("%s=%s", attrKey, encodeAttribute(entries[key])))
+			added++
+		}
+	}
+
+	if len(attrs) > 0 {
+		newEnvVars[otelResourceAttributesIndex].Value = fmt.Sprintf("%s,%s", newEnvVars[otelResourceAttributesIndex].Value, strings.Join(attrs, ","))
+	}
+	return newEnvVars
+}
+
+// isKeyAllowed checks if the key matches any of the allow regexes and none of the deny regexes of the mapping
+func isKeyAllowed(key string, mapping config.AttributeMapping) bool {
+	for _, expression := range mapping.Deny {
+		if matchAttributeMappingRegexp(expression, key) {
+			return false
+		}
+	}
+	if len(mapping.Allow) == 0 {
+		return true
+	}
+	for _, expression := range mapping.Allow {
+		if matchAttributeMappingRegexp(expression, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteKey rewrites the key as per the rewrite rule, key is returned as is if it does not match
+func rewriteKey(key string, rewrite *config.KeyRewrite) string {
+	if rewrite == nil {
+		return key
+	}
+	exp, err := config.GetAttributeMappingRegexp(rewrite.Match)
+	if err != nil || !exp.MatchString(key) {
+		return key
+	}
+	return exp.ReplaceAllString(key, rewrite.Replacement)
+}
+
+func matchAttributeMappingRegexp(expression string, key string) bool {
+	exp, err := config.GetAttributeMappingRegexp(expression)
+	if err != nil {
+		return false
+	}
+	return exp.MatchString(key)
+}
+
+// attributeUnsafeChars are percent-encoded in the keys & values of the OTELResourceAttributes,
+// $ is encoded as well, so that kubelet does not expand the $(VAR) references in the literal values
+var attributeUnsafeChars = regexp.MustCompile(`[^!#&'*+\-./0-9:<>?@A-Z\[\]^_` + "`" + `a-z|~]`)
+
+// encodeAttribute percent-encodes the characters which are not allowed in the keys & values of the OTELResourceAttributes
+func encodeAttribute(s string) string {
+	return attributeUnsafeChars.ReplaceAllStringFunc(s, func(c string) string {
+		var encoded strings.Builder
+		for _, b := range []byte(c) {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+		return encoded.String()
+	})
+}
@@ -0,0 +1,204 @@
+package mutation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/clusterinfo"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+// Caches of the MutationCache
+const (
+	cacheResult    = "result"
+	cacheOwner     = "owner"
+	cacheEnvSource = "envSource"
+)
+
+// MutationCache memoizes the mutated pod specs of the identical pods, like the pods of a ReplicaSet, the workload names of the pod owners,
+// and the keys of the secrets & config maps referred by the injected env variables. Nil MutationCache does not memoize anything.
+type MutationCache struct {
+	results    *cache.LRUExpireCache
+	owners     *cache.LRUExpireCache
+	envSources *cache.LRUExpireCache
+	ttl        time.Duration
+}
+
+// mutationResult is the memoized result of the mutations
+type mutationResult struct {
+	spec     corev1.PodSpec
+	warnings []string
+}
+
+// NewMutationCache returns the MutationCache holding max size entries in each of its caches, entries expire after the ttl
+func NewMutationCache(size int, ttl time.Duration) *MutationCache {
+	return &MutationCache{
+		results:    cache.NewLRUExpireCache(size),
+		owners:     cache.NewLRUExpireCache(size),
+		envSources: cache.NewLRUExpireCache(size),
+		ttl:        ttl,
+	}
+}
+
+// resultKey returns the key of the mutation result of the pod, pods without owner are not memoized.
+// Key is the hash of the pod inputs the mutations read, its namespace & workload, the resource version of the namespace, the cluster name,
+// the config hash and the mutations, so that the replicas created from the same template share the key.
+// Namespace is looked up from the informer cache only, as the lookup must not cost an API call, pods are not memoized until the cache is synced.
+func (c *MutationCache) resultKey(ctx context.Context, params *Params) (string, bool) {
+	if c == nil || len(params.Pod.GetOwnerReferences()) == 0 || params.Client == nil {
+		return "", false
+	}
+	lister := params.Client.NamespaceLister()
+	if lister == nil {
+		return "", false
+	}
+	namespace, err := lister.Get(params.Namespace)
+	if err != nil {
+		return "", false
+	}
+	mutationNames := make([]string, 0, len(params.Mutations))
+	for _, mutation := range params.Mutations {
+		mutationNames = append(mutationNames, mutation.Name)
+	}
+	data, err := json.Marshal(struct {
+		Pod              interface{}
+		Namespace        string
+		NamespaceVersion string
+		WorkloadName     string
+		ClusterName      string
+		ConfigHash       string
+		Mutations        []string
+	}{podKeyInputs(params.Pod), params.Namespace, namespace.GetResourceVersion(), params.WorkloadName, clusterinfo.Name(), config.GetConfigInfo().Hash, mutationNames})
+	if err != nil {
+		return "", false
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), true
+}
+
+// podKeyInputs returns the fields of the pod the mutations read: its labels, annotations, owners & containers.
+// Pod name is read by the env value templates, and the whole pod by the when expressions, so they are included only if the config has them.
+func podKeyInputs(pod *corev1.Pod) interface{} {
+	if config.HasWhenExpressions() {
+		return pod
+	}
+	inputs := struct {
+		Name            string `json:",omitempty"`
+		GenerateName    string
+		Labels          map[string]string
+		Annotations     map[string]string
+		OwnerReferences []metav1.OwnerReference
+		InitContainers  []corev1.Container
+		Containers      []corev1.Container
+	}{
+		GenerateName:    pod.GetGenerateName(),
+		Labels:          pod.GetLabels(),
+		Annotations:     pod.GetAnnotations(),
+		OwnerReferences: pod.GetOwnerReferences(),
+		InitContainers:  pod.Spec.InitContainers,
+		Containers:      pod.Spec.Containers,
+	}
+	if config.HasEnvTemplates() {
+		inputs.Name = pod.GetName()
+	}
+	return inputs
+}
+
+// getResult returns the memoized mutation result of the key
+func (c *MutationCache) getResult(key string) (mutationResult, bool) {
+	value, found := c.results.Get(key)
+	if !found {
+		metrics.MutationCacheRequests.WithLabelValues(cacheResult, metrics.CacheMiss).Inc()
+		return mutationResult{}, false
+	}
+	metrics.MutationCacheRequests.WithLabelValues(cacheResult, metrics.CacheHit).Inc()
+	result := value.(mutationResult)
+	return mutationResult{spec: *result.spec.DeepCopy(), warnings: append([]string(nil), result.warnings...)}, true
+}
+
+// addResult memoizes the mutation result of the key
+func (c *MutationCache) addResult(key string, spec corev1.PodSpec, warnings []string) {
+	c.results.Add(key, mutationResult{spec: *spec.DeepCopy(), warnings: append([]string(nil), warnings...)}, c.ttl)
+}
+
+// ownerKey returns the key of the workload name of the pod owner
+func ownerKey(pod *corev1.Pod, namespace string) (string, bool) {
+	if len(pod.GetOwnerReferences()) == 0 {
+		return "", false
+	}
+	owner := pod.GetOwnerReferences()[0]
+	return fmt.Sprintf("%s/%s/%s", namespace, owner.Kind, owner.Name), true
+}
+
+// getWorkloadName returns the memoized workload name of the pod owner
+func (c *MutationCache) getWorkloadName(pod *corev1.Pod, namespace string) (string, bool) {
+	key, ok := ownerKey(pod, namespace)
+	if c == nil || !ok {
+		return "", false
+	}
+	value, found := c.owners.Get(key)
+	if !found {
+		metrics.MutationCacheRequests.WithLabelValues(cacheOwner, metrics.CacheMiss).Inc()
+		return "", false
+	}
+	metrics.MutationCacheRequests.WithLabelValues(cacheOwner, metrics.CacheHit).Inc()
+	return value.(string), true
+}
+
+// addWorkloadName memoizes the workload name of the pod owner
+func (c *MutationCache) addWorkloadName(pod *corev1.Pod, namespace string, workloadName string) {
+	key, ok := ownerKey(pod, namespace)
+	if c == nil || !ok {
+		return
+	}
+	c.owners.Add(key, workloadName, c.ttl)
+}
+
+// envSourceKey returns the key of the secret or config map in the namespace
+func envSourceKey(kind string, namespace string, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+// getEnvSourceKeys returns the memoized keys of the secret or config map in the namespace
+func (c *MutationCache) getEnvSourceKeys(kind string, namespace string, name string) (map[string]bool, bool) {
+	if c == nil {
+		return nil, false
+	}
+	value, found := c.envSources.Get(envSourceKey(kind, namespace, name))
+	if !found {
+		metrics.MutationCacheRequests.WithLabelValues(cacheEnvSource, metrics.CacheMiss).Inc()
+		return nil, false
+	}
+	metrics.MutationCacheRequests.WithLabelValues(cacheEnvSource, metrics.CacheHit).Inc()
+	return value.(map[string]bool), true
+}
+
+// addEnvSourceKeys memoizes the keys of the secret or config map in the namespace, memoized keys must not be modified
+func (c *MutationCache) addEnvSourceKeys(kind string, namespace string, name string, keys map[string]bool) {
+	if c == nil {
+		return
+	}
+	c.envSources.Add(envSourceKey(kind, namespace, name), keys, c.ttl)
+}
+
+// Owners returns the memoized workload names keyed by the pod owners in namespace/kind/name format
+func (c *MutationCache) Owners() map[string]string {
+	owners := map[string]string{}
+	if c == nil {
+		return owners
+	}
+	for _, key := range c.owners.Keys() {
+		if value, found := c.owners.Get(key); found {
+			owners[key.(string)] = value.(string)
+		}
+	}
+	return owners
+}
@@ -0,0 +1,83 @@
+package mutation
+
+import (
+	"fmt"
+
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultCollectorGRPCPort = 4317
+	defaultCollectorHTTPPort = 4318
+)
+
+// getNodeLocalCollectorEnvVars returns the env variables pointing the OTLP exporter to the collector running on the same node
+func getNodeLocalCollectorEnvVars(collector config.Collector) []corev1.EnvVar {
+	protocol := collector.Protocol
+	if protocol == "" {
+		protocol = config.OTLPProtocolGRPC
+	}
+
+	envVars := []corev1.EnvVar{{Name: OTELExporterOTLPProtocol, Value: protocol}}
+
+	if protocol == config.OTLPProtocolHTTPProtobuf {
+		port := collector.HTTPPort
+		if port == 0 {
+			port = defaultCollectorHTTPPort
+		}
+		endpoint := fmt.Sprintf("http://$(%s):%d", LMAPMHostIP, port)
+		// Signal specific endpoints are used as is, so they must include the signal path
+		return append(envVars,
+			corev1.EnvVar{Name: OTELExporterOTLPEndpoint, Value: endpoint},
+			corev1.EnvVar{Name: OTELExporterOTLPTracesEndpoint, Value: endpoint + "/v1/traces"},
+			corev1.EnvVar{Name: OTELExporterOTLPMetricsEndpoint, Value: endpoint + "/v1/metrics"},
+			corev1.EnvVar{Name: OTELExporterOTLPLogsEndpoint, Value: endpoint + "/v1/logs"},
+		)
+	}
+
+	port := collector.GRPCPort
+	if port == 0 {
+		port = defaultCollectorGRPCPort
+	}
+	endpoint := fmt.Sprintf("http://$(%s):%d", LMAPMHostIP, port)
+	return append(envVars,
+		corev1.EnvVar{Name: OTELExporterOTLPEndpoint, Value: endpoint},
+		corev1.EnvVar{Name: OTELExporterOTLPTracesEndpoint, Value: endpoint},
+		corev1.EnvVar{Name: OTELExporterOTLPMetricsEndpoint, Value: endpoint},
+		corev1.EnvVar{Name: OTELExporterOTLPLogsEndpoint, Value: endpoint},
+	)
+}
+
+// containerSpecifiesCollectorEnv checks if the container specifies any of the endpoint or protocol env variables of the collector
+func containerSpecifiesCollectorEnv(container corev1.Container, collectorEnvVars []corev1.EnvVar) bool {
+	for _, collectorEnvVar := range collectorEnvVars {
+		if getIndexOfEnv(container.Env, collectorEnvVar.Name) > -1 {
+			return true
+		}
+	}
+	return false
+}
+
+// addNodeLocalCollectorEnvVars adds the host IP & the node-local collector endpoint env variables, replacing the endpoint env variables of the config.
+// Endpoint & protocol env variables are a group, if the container specifies any of them, the whole group is left as is unless overriding is disabled,
+// so that the container exporting to its own endpoint is not partially pointed to the node-local collector.
+func addNodeLocalCollectorEnvVars(container corev1.Container, newEnvVars []corev1.EnvVar, mergeOptions map[string]envMergeOption, collector config.Collector) []corev1.EnvVar {
+	collectorEnvVars := getNodeLocalCollectorEnvVars(collector)
+	if !collector.OverrideDisabled && containerSpecifiesCollectorEnv(container, collectorEnvVars) {
+		return newEnvVars
+	}
+
+	for _, collectorEnvVar := range collectorEnvVars {
+		if idx := getIndexOfEnv(newEnvVars, collectorEnvVar.Name); idx > -1 {
+			newEnvVars = append(newEnvVars[:idx], newEnvVars[idx+1:]...)
+		}
+		delete(mergeOptions, collectorEnvVar.Name)
+	}
+
+	newEnvVars = append(newEnvVars, corev1.EnvVar{
+		Name:      LMAPMHostIP,
+		ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.hostIP"}},
+	})
+	return append(newEnvVars, collectorEnvVars...)
+}
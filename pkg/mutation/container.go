@@ -0,0 +1,120 @@
+package mutation
+
+import (
+	"context"
+
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// getTargetContainers returns the containers of the pod to be mutated as per the containers config, init containers come first.
+// Returned containers point to the pod spec, so that they can be mutated in place.
+func getTargetContainers(ctx context.Context, pod *corev1.Pod, containersConfig config.Containers) []*corev1.Container {
+	logger := log.FromContext(ctx).WithName("getTargetContainers")
+
+	names := map[string]bool{}
+	for _, name := range containersConfig.Names {
+		names[name] = true
+	}
+
+	var targets []*corev1.Container
+	if containersConfig.InitContainers {
+		for idx := range pod.Spec.InitContainers {
+			if containersConfig.Mode == config.ContainerTargetModeNamed && !names[pod.Spec.InitContainers[idx].Name] {
+				continue
+			}
+			targets = append(targets, &pod.Spec.InitContainers[idx])
+		}
+	}
+	for idx := range pod.Spec.Containers {
+		switch containersConfig.Mode {
+		case config.ContainerTargetModeAll:
+		case config.ContainerTargetModeNamed:
+			if !names[pod.Spec.Containers[idx].Name] {
+				continue
+			}
+		default:
+			if idx > 0 {
+				continue
+			}
+		}
+		targets = append(targets, &pod.Spec.Containers[idx])
+	}
+
+	if len(targets) == 0 {
+		logger.Info("none of the containers of the pod is to be mutated", "mode", containersConfig.Mode, "names", containersConfig.Names)
+	}
+	return targets
+}
+
+// orderEnvByDependency orders the injected env variables, so that the env variables referred as $(VAR) are defined before the ones referring to them,
+// as kubelet resolves the references only to the previously defined env variables.
+// Env variables of the container keep their relative order, as the container may rely on the references not being resolved.
+// Order of the env variables is kept as is otherwise, env variables with cyclic references are left in their order.
+func orderEnvByDependency(envVars []corev1.EnvVar, containerEnvVars []corev1.EnvVar) []corev1.EnvVar {
+	definedEnvVars := map[string]bool{}
+	for _, env := range envVars {
+		definedEnvVars[env.Name] = true
+	}
+	containerEnvNames := map[string]bool{}
+	for _, env := range containerEnvVars {
+		containerEnvNames[env.Name] = true
+	}
+
+	dependencies := make([][]string, len(envVars))
+	previousContainerEnv := ""
+	for idx, env := range envVars {
+		for _, match := range envVarRefExp.FindAllStringSubmatch(env.Value, -1) {
+			// References among the env variables of the container are left as is, as they are kept in order
+			if match[1] == env.Name || !definedEnvVars[match[1]] || (containerEnvNames[env.Name] && containerEnvNames[match[1]]) {
+				continue
+			}
+			dependencies[idx] = append(dependencies[idx], match[1])
+		}
+		// Env variable of the container depends on the previous one of the container, so that they are never reordered among themselves
+		if containerEnvNames[env.Name] {
+			if previousContainerEnv != "" {
+				dependencies[idx] = append(dependencies[idx], previousContainerEnv)
+			}
+			previousContainerEnv = env.Name
+		}
+	}
+
+	ordered := make([]corev1.EnvVar, 0, len(envVars))
+	added := make([]bool, len(envVars))
+	addedEnvVars := map[string]bool{}
+	for len(ordered) < len(envVars) {
+		// Pick the first env variable whose dependencies are already added
+		next := -1
+		for idx := range envVars {
+			if added[idx] {
+				continue
+			}
+			ready := true
+			for _, dependency := range dependencies[idx] {
+				if !addedEnvVars[dependency] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = idx
+				break
+			}
+		}
+		// Cyclic references can not be resolved, add the first remaining env variable
+		if next < 0 {
+			for idx := range envVars {
+				if !added[idx] {
+					next = idx
+					break
+				}
+			}
+		}
+		added[next] = true
+		addedEnvVars[envVars[next].Name] = true
+		ordered = append(ordered, envVars[next])
+	}
+	return ordered
+}
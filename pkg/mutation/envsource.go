@@ -0,0 +1,196 @@
+package mutation
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// WebhookNamespace is the env variable holding the namespace in which webhook is running
+	WebhookNamespace = "POD_NAMESPACE"
+)
+
+// envSourceRef represents the secret or config map referred by the injected env variable
+type envSourceRef struct {
+	kind     string
+	name     string
+	key      string
+	optional bool
+}
+
+// getEnvVarSourceRef returns the secret or config map referred by the env variable, if any
+func getEnvVarSourceRef(env corev1.EnvVar) (envSourceRef, bool) {
+	if env.ValueFrom == nil {
+		return envSourceRef{}, false
+	}
+	if ref := env.ValueFrom.SecretKeyRef; ref != nil {
+		return envSourceRef{kind: "Secret", name: ref.Name, key: ref.Key, optional: ref.Optional != nil && *ref.Optional}, true
+	}
+	if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+		return envSourceRef{kind: "ConfigMap", name: ref.Name, key: ref.Key, optional: ref.Optional != nil && *ref.Optional}, true
+	}
+	return envSourceRef{}, false
+}
+
+// getEnvFromSourceRef returns the secret or config map referred by the envFrom source
+func getEnvFromSourceRef(source corev1.EnvFromSource) (envSourceRef, bool) {
+	if ref := source.SecretRef; ref != nil {
+		return envSourceRef{kind: "Secret", name: ref.Name, optional: ref.Optional != nil && *ref.Optional}, true
+	}
+	if ref := source.ConfigMapRef; ref != nil {
+		return envSourceRef{kind: "ConfigMap", name: ref.Name, optional: ref.Optional != nil && *ref.Optional}, true
+	}
+	return envSourceRef{}, false
+}
+
+// envSourceKindNames are the names of the kinds of the env sources used in the errors
+var envSourceKindNames = map[string]string{"Secret": "secret", "ConfigMap": "config map"}
+
+// checkEnvSource checks if the secret or config map referred by the injected env variable exists in the pod namespace along with the referred key.
+// Secret is requested to be copied from the webhook namespace if it is missing and copying is allowed.
+// Keys of the existing secrets & config maps are memoized, so that the admission requests do not look them up each time.
+func checkEnvSource(ctx context.Context, params *Params, ref envSourceRef, copyFromWebhookNamespace bool) error {
+	if ref.optional || params.Client == nil {
+		return nil
+	}
+	keys, found := params.Cache.getEnvSourceKeys(ref.kind, params.Namespace, ref.name)
+	if !found {
+		var err error
+		if keys, err = getEnvSourceKeys(ctx, params, ref, copyFromWebhookNamespace); err != nil {
+			return err
+		}
+	}
+	if ref.key != "" && !keys[ref.key] {
+		return fmt.Errorf("key %s is not found in %s %s/%s", ref.key, envSourceKindNames[ref.kind], params.Namespace, ref.name)
+	}
+	return nil
+}
+
+// getEnvSourceKeys looks up the keys of the secret or config map in the pod namespace, and memoizes them.
+// Keys of the secret requested to be copied are taken from its source, they are not memoized until the copy is made.
+func getEnvSourceKeys(ctx context.Context, params *Params, ref envSourceRef, copyFromWebhookNamespace bool) (map[string]bool, error) {
+	keys := map[string]bool{}
+	switch ref.kind {
+	case "Secret":
+		secret, err := params.Client.Clientset.CoreV1().Secrets(params.Namespace).Get(ctx, ref.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) && copyFromWebhookNamespace {
+			source, err := requestSecretCopy(ctx, params, ref.name)
+			if err != nil {
+				return nil, err
+			}
+			for key := range source.Data {
+				keys[key] = true
+			}
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for key := range secret.Data {
+			keys[key] = true
+		}
+	case "ConfigMap":
+		configMap, err := params.Client.Clientset.CoreV1().ConfigMaps(params.Namespace).Get(ctx, ref.name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for key := range configMap.Data {
+			keys[key] = true
+		}
+		for key := range configMap.BinaryData {
+			keys[key] = true
+		}
+	}
+	params.Cache.addEnvSourceKeys(ref.kind, params.Namespace, ref.name, keys)
+	return keys, nil
+}
+
+// SecretCopier copies the secrets of the webhook namespace into the pod namespaces out of the admission path
+type SecretCopier interface {
+	// CopySecret returns the source secret of the copy into the namespace, and requests the copy to be made unless it is a dry run.
+	// It fails if the secret is not allowed to be copied into the namespace.
+	CopySecret(ctx context.Context, namespace string, name string, dryRun bool) (*corev1.Secret, error)
+}
+
+// requestSecretCopy requests the copy of the secret from the webhook namespace into the pod namespace,
+// and returns the source secret, so that the env variable can be injected before the copy is made
+func requestSecretCopy(ctx context.Context, params *Params, name string) (*corev1.Secret, error) {
+	logger := log.FromContext(ctx).WithName("requestSecretCopy")
+
+	if params.SecretCopier == nil {
+		return nil, fmt.Errorf("secret %s is not found and copying the secrets is not enabled", name)
+	}
+	source, err := params.SecretCopier.CopySecret(ctx, params.Namespace, name, params.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Requested the copy of the secret from webhook namespace", "secret", name, "namespace", params.Namespace, "dryRun", params.DryRun)
+	return source, nil
+}
+
+// getEnvFromSources returns the envFrom sources of the config, whose referred secrets or config maps exist in the pod namespace
+func getEnvFromSources(ctx context.Context, params *Params) []corev1.EnvFromSource {
+	logger := log.FromContext(ctx).WithName("getEnvFromSources")
+	var sources []corev1.EnvFromSource
+	for _, envFrom := range params.LMConfig.MutationConfig.LMEnvVars.EnvFrom {
+		ref, ok := getEnvFromSourceRef(envFrom.EnvFromSource)
+		if !ok {
+			continue
+		}
+		if err := checkEnvSource(ctx, params, ref, envFrom.CopyFromWebhookNamespace); err != nil {
+			params.envSourcesSkipped = true
+			params.addWarning(fmt.Sprintf("lm-k8s-webhook: skipped injecting env variables from %s %s: %v", ref.kind, ref.name, err))
+			logger.Info("envFrom source can not be satisfied, skipping it", "kind", ref.kind, "name", ref.name, "reason", err.Error())
+			continue
+		}
+		sources = append(sources, envFrom.EnvFromSource)
+	}
+	return sources
+}
+
+// mergeEnvFromSources adds the envFrom sources to the container, which are not already present
+func mergeEnvFromSources(original []corev1.EnvFromSource, sources []corev1.EnvFromSource) []corev1.EnvFromSource {
+	merged := original
+	for _, source := range sources {
+		found := false
+		for _, existing := range original {
+			if envFromSourceName(existing) == envFromSourceName(source) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, source)
+		}
+	}
+	return merged
+}
+
+// envFromSourceName returns the kind qualified name of the envFrom source
+func envFromSourceName(source corev1.EnvFromSource) string {
+	if ref, ok := getEnvFromSourceRef(source); ok {
+		return ref.kind + "/" + ref.name
+	}
+	return ""
+}
+
+// isEnvVarSourceToBeSkipped checks if the secret or config map referred by the injected env variable can not be satisfied
+func isEnvVarSourceToBeSkipped(ctx context.Context, params *Params, env corev1.EnvVar, copyFromWebhookNamespace bool) bool {
+	logger := log.FromContext(ctx).WithName("isEnvVarSourceToBeSkipped")
+	ref, ok := getEnvVarSourceRef(env)
+	if !ok {
+		return false
+	}
+	if err := checkEnvSource(ctx, params, ref, copyFromWebhookNamespace); err != nil {
+		params.envSourcesSkipped = true
+		params.addWarning(fmt.Sprintf("lm-k8s-webhook: skipped injecting env variable %s referring to %s %s: %v", env.Name, ref.kind, ref.name, err))
+		logger.Info("env variable source can not be satisfied, skipping the env variable", "Name", env.Name, "kind", ref.kind, "name", ref.name, "reason", err.Error())
+		return true
+	}
+	return false
+}
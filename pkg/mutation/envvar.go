@@ -3,15 +3,15 @@ package mutation
 import (
 	"context"
 	"fmt"
-	"os"
 	"reflect"
 	"regexp"
 	"sort"
 	"strings"
 
 	"github.com/go-logr/logr"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/clusterinfo"
 	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
-	"go.opentelemetry.io/otel/semconv"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/metrics"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -22,16 +22,145 @@ import (
 )
 
 func mutateEnvVariables(ctx context.Context, params *Params) error {
+	if params.LMConfig.MutationConfigProvided {
+		applyProfileOverrides(params)
+	}
+
+	targetContainers := getTargetContainers(ctx, params.Pod, params.LMConfig.MutationConfig.Containers)
+	targetContainerNames := make([]string, 0, len(targetContainers))
+	for _, container := range targetContainers {
+		targetContainerNames = append(targetContainerNames, container.Name)
+	}
+	log.FromContext(ctx).WithName("mutateEnvVariables").Info("Injecting env variables", "containers", targetContainerNames, "profiles", getPodProfileNames(params.Pod))
+
+	if len(targetContainers) == 0 {
+		return nil
+	}
+	state := newPodEnvState(ctx, params)
+
+	// Each container gets its own env list, as the values are derived from the container env variables
+	for _, container := range targetContainers {
+		if err := mutateContainerEnv(ctx, params, state, container); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// podLookups resolves the namespace object & the workload name of the pod once,
+// they are shared by the when expressions, the templates, the namespace attributes & the SERVICE_NAME of all the containers of the pod
+type podLookups struct {
+	params *Params
+
+	namespaceResolved bool
+	namespace         *corev1.Namespace
+
+	workloadNameResolved bool
+	workloadName         string
+	workloadNameErr      error
+}
+
+// getNamespace returns the namespace object of the pod, nil is returned if it can not be resolved
+func (l *podLookups) getNamespace(ctx context.Context) *corev1.Namespace {
+	if l.namespaceResolved {
+		return l.namespace
+	}
+	l.namespaceResolved = true
+	namespace, err := getPodNamespace(ctx, l.params)
+	if err != nil {
+		log.FromContext(ctx).WithName("podLookups").Error(err, "error in getting the namespace details", "namespace", l.params.Namespace)
+		return nil
+	}
+	l.namespace = namespace
+	return namespace
+}
+
+// getWorkloadName returns the name of the workload resource managing the pod
+func (l *podLookups) getWorkloadName(ctx context.Context) (string, error) {
+	if !l.workloadNameResolved {
+		l.workloadNameResolved = true
+		l.workloadName, l.workloadNameErr = getWorkloadName(ctx, l.params)
+	}
+	return l.workloadName, l.workloadNameErr
+}
+
+// envSourceCheck is the key of the memoized checks of the secrets & config maps referred by the injected env variables
+type envSourceCheck struct {
+	envName                  string
+	ref                      envSourceRef
+	copyFromWebhookNamespace bool
+}
+
+// podEnvState holds the state of the pod, which is resolved once and shared by all the target containers of the pod
+type podEnvState struct {
+	lookups          *podLookups
+	whenEvaluator    *whenEvaluator
+	templateRenderer *envTemplateRenderer
+
+	// Values of service.namespace & deployment.environment derived from the labels or annotations of the pod namespace
+	nsServiceNamespace      string
+	nsDeploymentEnvironment string
+
+	profileEnvVars []corev1.EnvVar
+	envFromSources []corev1.EnvFromSource
+
+	// skippedEnvSources memoizes if the secret or config map referred by the injected env variable can not be satisfied
+	skippedEnvSources map[envSourceCheck]bool
+}
+
+// newPodEnvState resolves the state of the pod shared by its target containers
+func newPodEnvState(ctx context.Context, params *Params) *podEnvState {
+	lookups := &podLookups{params: params}
+	state := &podEnvState{
+		lookups:           lookups,
+		whenEvaluator:     newWhenEvaluator(params, lookups),
+		templateRenderer:  newEnvTemplateRenderer(params, lookups),
+		skippedEnvSources: map[envSourceCheck]bool{},
+	}
+	state.nsServiceNamespace, state.nsDeploymentEnvironment = getNamespaceAttributes(ctx, params, lookups)
+	if params.LMConfig.MutationConfigProvided {
+		state.profileEnvVars = getProfileEnvVars(ctx, params)
+		if len(params.LMConfig.MutationConfig.LMEnvVars.EnvFrom) > 0 {
+			state.envFromSources = getEnvFromSources(ctx, params)
+		}
+	}
+	return state
+}
+
+// isEnvVarSourceToBeSkipped checks if the secret or config map referred by the injected env variable can not be satisfied, the check is done once per pod
+func (s *podEnvState) isEnvVarSourceToBeSkipped(ctx context.Context, params *Params, env corev1.EnvVar, copyFromWebhookNamespace bool) bool {
+	ref, ok := getEnvVarSourceRef(env)
+	if !ok {
+		return false
+	}
+	check := envSourceCheck{envName: env.Name, ref: ref, copyFromWebhookNamespace: copyFromWebhookNamespace}
+	if skipped, found := s.skippedEnvSources[check]; found {
+		return skipped
+	}
+	skipped := isEnvVarSourceToBeSkipped(ctx, params, env, copyFromWebhookNamespace)
+	s.skippedEnvSources[check] = skipped
+	return skipped
+}
+
+// mutateContainerEnv injects the env variables into the container
+func mutateContainerEnv(ctx context.Context, params *Params, state *podEnvState, targetContainer *corev1.Container) error {
 
 	var isServiceNameEnvProcessed bool
 	var isServiceNamespaceEnvProcessed bool
 
-	logger := log.Log.WithValues("mutate-pod", fmt.Sprintf("%s/%s", params.Namespace, params.Pod.GetName()))
+	logger := log.FromContext(ctx).WithValues("mutate-pod", fmt.Sprintf("%s/%s", params.Namespace, params.Pod.GetName()), "container", targetContainer.Name)
+
+	newEnvVars := getLmotelEnvironmentVariables(ctx, params.LMConfig.MutationConfig.DefaultAttributes, params.LMConfig.MutationConfig.SemanticConventions)
+
+	// Env variables managed by the webhook, which are not to be passed through external config
+	managedSkipList := getSkipList(newEnvVars)
+
+	container := *targetContainer
 
-	newEnvVars := getLmotelEnvironmentVariables()
+	// mergeOptions holds the merge strategies of the env variables, for which the strategy is specified explicitly
+	mergeOptions := map[string]envMergeOption{}
 
-	// Get application container
-	container := getApplicationContainer(params.Pod)
+	nsServiceNamespace, nsDeploymentEnvironment := state.nsServiceNamespace, state.nsDeploymentEnvironment
 
 	// If external config is provided then only perform this operation
 	if params.LMConfig.MutationConfigProvided {
@@ -39,17 +168,32 @@ func mutateEnvVariables(ctx context.Context, params *Params) error {
 
 		for _, resourceEnvVar := range params.LMConfig.MutationConfig.LMEnvVars.Resource {
 
+			if !state.whenEvaluator.evaluate(ctx, resourceEnvVar.When) {
+				logger.Info("when expression is not satisfied, skipping the env variable", "Name", resourceEnvVar.Env.Name)
+				continue
+			}
+
+			renderedEnv, err := state.templateRenderer.render(ctx, resourceEnvVar.Env, container)
+			if err != nil {
+				logger.Error(err, "error in evaluating the env value template, skipping the env variable", "Name", resourceEnvVar.Env.Name)
+				continue
+			}
+			resourceEnvVar.Env = renderedEnv
+
+			if state.isEnvVarSourceToBeSkipped(ctx, params, resourceEnvVar.Env, resourceEnvVar.CopyFromWebhookNamespace) {
+				continue
+			}
+
 			// Check if resourceEnvVar is a part of skipList, if present in skip list then skip that env variable
 			// If env variable is not in skip list then add it as a new env variable to the env list
-			if !isResourceEnvVarToBeSkipped(skipList, resourceEnvVar.Env, logger) {
+			if !isResourceEnvVarToBeSkipped(managedSkipList, resourceEnvVar.Env, logger) {
 
 				// If resourceEnvVar is SERVICE_NAMESPACE
 				if resourceEnvVar.Env.Name == ServiceNamespace {
 					// If override is allowed
 					if !resourceEnvVar.OverrideDisabled {
-						if idx := getIndexOfEnv(container.Env, ServiceNamespace); idx > -1 {
+						if svcNamespaceEnv, found := getContainerResourceEnv(container, ServiceNamespace, params.LMConfig.MutationConfig.SemanticConventions); found {
 							svcNamespaceIdx := getIndexOfEnv(newEnvVars, ServiceNamespace)
-							svcNamespaceEnv := corev1.EnvVar{Name: resourceEnvVar.Env.Name, Value: container.Env[idx].Value, ValueFrom: container.Env[idx].ValueFrom}
 							newEnvVars[svcNamespaceIdx] = svcNamespaceEnv
 							isServiceNamespaceEnvProcessed = true
 							logger.Info("resourceEnvVar is SERVICE_NAMESPACE, overriding the default value of SERVICE_NAMESPACE from container", "env value", newEnvVars[svcNamespaceIdx].Value)
@@ -66,8 +210,16 @@ func mutateEnvVariables(ctx context.Context, params *Params) error {
 						continue
 					}
 
+					if nsServiceNamespace != "" {
+						svcNamespaceIdx := getIndexOfEnv(newEnvVars, ServiceNamespace)
+						newEnvVars[svcNamespaceIdx] = corev1.EnvVar{Name: ServiceNamespace, Value: nsServiceNamespace}
+						isServiceNamespaceEnvProcessed = true
+						logger.Info("resourceEnvVar is SERVICE_NAMESPACE, using value from the pod namespace", "env value", nsServiceNamespace)
+						continue
+					}
+
 					if resourceEnvVar.Env.ValueFrom != nil {
-						_, found, err := checkIfPodHasLabel(params.Pod, resourceEnvVar.Env)
+						_, found, err := checkIfPodHasLabel(ctx, params.Pod, resourceEnvVar.Env)
 
 						// Update SERVICE_NAMESPACE env var either if the label is present on pod or value is not specified in metadata.label format
 						if found || (err == errEnvVarValueNotInLabelBasedFieldPathFormat) {
@@ -84,12 +236,11 @@ func mutateEnvVariables(ctx context.Context, params *Params) error {
 				if resourceEnvVar.Env.Name == ServiceName {
 					// If override is allowed
 					if !resourceEnvVar.OverrideDisabled {
-						if idx := getIndexOfEnv(container.Env, ServiceName); idx > -1 {
-							svcNameEnv := corev1.EnvVar{Name: resourceEnvVar.Env.Name, Value: container.Env[idx].Value, ValueFrom: container.Env[idx].ValueFrom}
+						if svcNameEnv, found := getContainerResourceEnv(container, ServiceName, params.LMConfig.MutationConfig.SemanticConventions); found {
 							newEnvVars = append(newEnvVars, svcNameEnv)
 
 							// Add it to the OTELResourceAttributes
-							newEnvVars = addResEnvToOtelResAttribute(svcNameEnv, newEnvVars, resourceEnvVar.ResAttrName)
+							newEnvVars = addResEnvToOtelResAttribute(svcNameEnv, newEnvVars, resourceEnvVar.ResAttrName, params.LMConfig.MutationConfig.SemanticConventions)
 							isServiceNameEnvProcessed = true
 							logger.Info("resourceEnvVar is SERVICE_NAME, using value of the SERVICE_NAME from container", "SERVICE_NAME env:", svcNameEnv)
 							continue
@@ -97,14 +248,14 @@ func mutateEnvVariables(ctx context.Context, params *Params) error {
 					}
 
 					if resourceEnvVar.Env.ValueFrom != nil {
-						podLabelValue, found, err := checkIfPodHasLabel(params.Pod, resourceEnvVar.Env)
+						podLabelValue, found, err := checkIfPodHasLabel(ctx, params.Pod, resourceEnvVar.Env)
 
 						// Update SERVICE_NAME env var either if the label is present on pod or value is not specified in metadata.label format
 						if found || (err == errEnvVarValueNotInLabelBasedFieldPathFormat) {
 							newEnvVars = append(newEnvVars, resourceEnvVar.Env)
 
 							// Add it to the OTELResourceAttributes
-							newEnvVars = addResEnvToOtelResAttribute(resourceEnvVar.Env, newEnvVars, resourceEnvVar.ResAttrName)
+							newEnvVars = addResEnvToOtelResAttribute(resourceEnvVar.Env, newEnvVars, resourceEnvVar.ResAttrName, params.LMConfig.MutationConfig.SemanticConventions)
 							isServiceNameEnvProcessed = true
 							logger.Info("resourceEnvVar is SERVICE_NAME", "SERVICE_NAME env:", resourceEnvVar.Env)
 							continue
@@ -112,12 +263,12 @@ func mutateEnvVariables(ctx context.Context, params *Params) error {
 
 						if !found || (len(strings.Trim(podLabelValue, " "))) == 0 {
 							logger.Info("deriving the SERVICE_NAME value from workload resource")
-							workloadResource, _ := getParentWorkloadNameForPod(params.Pod, params.Client, params.Namespace)
+							workloadResource, _ := state.lookups.getWorkloadName(ctx)
 							svcNameEnv := corev1.EnvVar{Name: resourceEnvVar.Env.Name, Value: workloadResource}
 							newEnvVars = append(newEnvVars, svcNameEnv)
 
 							// Add it to the OTELResourceAttributes
-							newEnvVars = addResEnvToOtelResAttribute(svcNameEnv, newEnvVars, resourceEnvVar.ResAttrName)
+							newEnvVars = addResEnvToOtelResAttribute(svcNameEnv, newEnvVars, resourceEnvVar.ResAttrName, params.LMConfig.MutationConfig.SemanticConventions)
 							isServiceNameEnvProcessed = true
 							logger.Info("resourceEnvVar is SERVICE_NAME, using value of the SERVICE_NAME from workload resource", "SERVICE_NAME env:", svcNameEnv)
 							continue
@@ -125,9 +276,19 @@ func mutateEnvVariables(ctx context.Context, params *Params) error {
 					}
 				}
 
+				// If resourceEnvVar is DEPLOYMENT_ENVIRONMENT, value derived from the pod namespace takes precedence
+				if resourceEnvVar.Env.Name == DeploymentEnvironment && nsDeploymentEnvironment != "" {
+					logger.Info("resourceEnvVar is DEPLOYMENT_ENVIRONMENT, using value from the pod namespace", "env value", nsDeploymentEnvironment)
+					continue
+				}
+
 				// For any other env var
 				var envToBeAdded corev1.EnvVar
-				if !resourceEnvVar.OverrideDisabled {
+				if resourceEnvVar.MergeStrategy != "" {
+					// merge strategy is applied while merging with the container env variables
+					envToBeAdded = resourceEnvVar.Env
+					mergeOptions[envToBeAdded.Name] = envMergeOption{strategy: resourceEnvVar.MergeStrategy, separator: resourceEnvVar.Separator}
+				} else if !resourceEnvVar.OverrideDisabled {
 					// if the env is present in application container already, then use it
 					if idx := getIndexOfEnv(container.Env, resourceEnvVar.Env.Name); idx > -1 {
 						envToBeAdded = container.Env[idx]
@@ -140,21 +301,41 @@ func mutateEnvVariables(ctx context.Context, params *Params) error {
 				newEnvVars = append(newEnvVars, envToBeAdded)
 
 				// Add it to the OTELResourceAttributes
-				newEnvVars = addResEnvToOtelResAttribute(envToBeAdded, newEnvVars, resourceEnvVar.ResAttrName)
+				newEnvVars = addResEnvToOtelResAttribute(envToBeAdded, newEnvVars, resourceEnvVar.ResAttrName, params.LMConfig.MutationConfig.SemanticConventions)
 				logger.Info("Adding new resource env variable", "Name: ", envToBeAdded.Name, "env value", envToBeAdded.Value, "env valueFrom", envToBeAdded.ValueFrom)
 			}
 		}
 
 		for _, operationEnvVar := range params.LMConfig.MutationConfig.LMEnvVars.Operation {
 
+			if !state.whenEvaluator.evaluate(ctx, operationEnvVar.When) {
+				logger.Info("when expression is not satisfied, skipping the env variable", "Name", operationEnvVar.Env.Name)
+				continue
+			}
+
+			renderedEnv, err := state.templateRenderer.render(ctx, operationEnvVar.Env, container)
+			if err != nil {
+				logger.Error(err, "error in evaluating the env value template, skipping the env variable", "Name", operationEnvVar.Env.Name)
+				continue
+			}
+			operationEnvVar.Env = renderedEnv
+
+			if state.isEnvVarSourceToBeSkipped(ctx, params, operationEnvVar.Env, operationEnvVar.CopyFromWebhookNamespace) {
+				continue
+			}
+
 			// Check if operationEnvVar is a part of skipList, if present in skip list then skip that env variable
 
 			// If env variable is not in skip list then add it as a new env variable to the env list
 
-			if !isOperationEnvVarToBeSkipped(skipList, operationEnvVar.Env, logger) {
+			if !isOperationEnvVarToBeSkipped(managedSkipList, operationEnvVar.Env, logger) {
 				// for any other env var
 				var envToBeAdded corev1.EnvVar
-				if !operationEnvVar.OverrideDisabled {
+				if operationEnvVar.MergeStrategy != "" {
+					// merge strategy is applied while merging with the container env variables
+					envToBeAdded = operationEnvVar.Env
+					mergeOptions[envToBeAdded.Name] = envMergeOption{strategy: operationEnvVar.MergeStrategy, separator: operationEnvVar.Separator}
+				} else if !operationEnvVar.OverrideDisabled {
 					// if the env is present in application container already, then use it
 					if idx := getIndexOfEnv(container.Env, operationEnvVar.Env.Name); idx > -1 {
 						envToBeAdded = container.Env[idx]
@@ -170,74 +351,128 @@ func mutateEnvVariables(ctx context.Context, params *Params) error {
 		}
 	}
 
+	// Add the env variables of the profiles selected by the pod.
+	// Env variables of the external config & the container take precedence over the profile env variables.
+	if params.LMConfig.MutationConfigProvided {
+		for _, profileEnvVar := range state.profileEnvVars {
+			if getIndexOfEnv(newEnvVars, profileEnvVar.Name) > -1 || getIndexOfEnv(container.Env, profileEnvVar.Name) > -1 {
+				continue
+			}
+			if isOperationEnvVarToBeSkipped(managedSkipList, profileEnvVar, logger) {
+				continue
+			}
+			newEnvVars = append(newEnvVars, profileEnvVar)
+			logger.Info("Added profile env variable", "Name:", profileEnvVar.Name, "env.value", profileEnvVar.Value, "env.ValueFrom", profileEnvVar.ValueFrom)
+		}
+	}
+
 	if !isServiceNamespaceEnvProcessed {
-		if idx := getIndexOfEnv(container.Env, ServiceNamespace); idx > -1 {
+		if svcNamespaceEnv, found := getContainerResourceEnv(container, ServiceNamespace, params.LMConfig.MutationConfig.SemanticConventions); found {
 			svcNamespaceIdx := getIndexOfEnv(newEnvVars, ServiceNamespace)
-			svcNamespaceEnv := corev1.EnvVar{Name: ServiceNamespace, Value: container.Env[idx].Value, ValueFrom: container.Env[idx].ValueFrom}
 			newEnvVars[svcNamespaceIdx] = svcNamespaceEnv
 			logger.Info("resourceEnvVar is SERVICE_NAMESPACE, using value from container", "env value", svcNamespaceEnv)
+		} else if nsServiceNamespace != "" {
+			svcNamespaceIdx := getIndexOfEnv(newEnvVars, ServiceNamespace)
+			newEnvVars[svcNamespaceIdx] = corev1.EnvVar{Name: ServiceNamespace, Value: nsServiceNamespace}
+			logger.Info("resourceEnvVar is SERVICE_NAMESPACE, using value from the pod namespace", "env value", nsServiceNamespace)
 		}
 	}
 
+	// If service.version is to be derived, add SERVICE_VERSION unless it is specified in the external config
+	if params.LMConfig.MutationConfigProvided && params.LMConfig.MutationConfig.ServiceVersion.IsEnabled() && getIndexOfEnv(newEnvVars, ServiceVersion) < 0 {
+		if svcVersionEnv, found := getServiceVersionEnv(params.Pod, container, params.LMConfig.MutationConfig.ServiceVersion, params.LMConfig.MutationConfig.SemanticConventions); found {
+			newEnvVars = append(newEnvVars, svcVersionEnv)
+			// Add it to the OTELResourceAttributes
+			newEnvVars = addResEnvToOtelResAttribute(svcVersionEnv, newEnvVars, "", params.LMConfig.MutationConfig.SemanticConventions)
+			logger.Info("Adding SERVICE_VERSION env variable", "env value", svcVersionEnv.Value)
+		}
+	}
+
+	// If deployment.environment is derived from the pod namespace, add DEPLOYMENT_ENVIRONMENT unless the container specifies it
+	if nsDeploymentEnvironment != "" {
+		deploymentEnvironmentEnv := corev1.EnvVar{Name: DeploymentEnvironment, Value: nsDeploymentEnvironment}
+		if idx := getIndexOfEnv(container.Env, DeploymentEnvironment); idx > -1 {
+			deploymentEnvironmentEnv = container.Env[idx]
+		}
+		newEnvVars = append(newEnvVars, deploymentEnvironmentEnv)
+		newEnvVars = addResEnvToOtelResAttribute(deploymentEnvironmentEnv, newEnvVars, "", params.LMConfig.MutationConfig.SemanticConventions)
+		logger.Info("Adding DEPLOYMENT_ENVIRONMENT env variable", "env value", deploymentEnvironmentEnv.Value)
+	}
+
 	// If SERVICE_NAME env is not found then add it
 	if !isServiceNameEnvProcessed {
 		// Check if present in the container
 		// If present, then use that value otherwise derive from workload
 
-		if idx := getIndexOfEnv(container.Env, ServiceName); idx > -1 {
-			svcNameEnv := corev1.EnvVar{Name: ServiceName, Value: container.Env[idx].Value, ValueFrom: container.Env[idx].ValueFrom}
+		if svcNameEnv, found := getContainerResourceEnv(container, ServiceName, params.LMConfig.MutationConfig.SemanticConventions); found {
 			newEnvVars = append(newEnvVars, svcNameEnv)
 			// Add it to the OTELResourceAttributes
-			newEnvVars = addResEnvToOtelResAttribute(svcNameEnv, newEnvVars, "")
+			newEnvVars = addResEnvToOtelResAttribute(svcNameEnv, newEnvVars, "", params.LMConfig.MutationConfig.SemanticConventions)
 			logger.Info("resourceEnvVar is SERVICE_NAME, using value from container", "env value", svcNameEnv)
 		} else {
-			workloadResource, _ := getParentWorkloadNameForPod(params.Pod, params.Client, params.Namespace)
+			workloadResource, _ := state.lookups.getWorkloadName(ctx)
 			svcNameEnv := corev1.EnvVar{Name: ServiceName, Value: workloadResource}
 			newEnvVars = append(newEnvVars, svcNameEnv)
 			// Add it to the OTELResourceAttributes
-			newEnvVars = addResEnvToOtelResAttribute(svcNameEnv, newEnvVars, "")
+			newEnvVars = addResEnvToOtelResAttribute(svcNameEnv, newEnvVars, "", params.LMConfig.MutationConfig.SemanticConventions)
 			logger.Info("resourceEnvVar is SERVICE_NAME, derived value from workload", "env value", svcNameEnv)
 		}
 	}
-	return mutateContainerEnvVariables(container, newEnvVars, params, logger)
+	// Keep OTEL_SERVICE_NAME in sync with SERVICE_NAME, as OTEL_SERVICE_NAME takes precedence over service.name of the OTELResourceAttributes in the SDKs
+	if svcNameIdx := getIndexOfEnv(newEnvVars, ServiceName); svcNameIdx > -1 {
+		if params.LMConfig.MutationConfigProvided && params.LMConfig.MutationConfig.EmitOTELServiceName {
+			otelSvcNameEnv := corev1.EnvVar{Name: OTELServiceName, Value: newEnvVars[svcNameIdx].Value, ValueFrom: newEnvVars[svcNameIdx].ValueFrom}
+			newEnvVars = append(newEnvVars, otelSvcNameEnv)
+			logger.Info("Adding OTEL_SERVICE_NAME env variable", "env value", otelSvcNameEnv)
+		} else if idx := getIndexOfEnv(container.Env, OTELServiceName); idx > -1 && container.Env[idx].Value != newEnvVars[svcNameIdx].Value {
+			logger.Info("OTEL_SERVICE_NAME of the container differs from SERVICE_NAME, SDK uses OTEL_SERVICE_NAME as the service name", "OTEL_SERVICE_NAME", container.Env[idx].Value, "SERVICE_NAME", newEnvVars[svcNameIdx].Value)
+		}
+	}
+
+	// Point the OTLP exporter to the collector running on the same node
+	if params.LMConfig.MutationConfigProvided && params.LMConfig.MutationConfig.Collector.Mode == config.CollectorModeNodeLocal {
+		newEnvVars = addNodeLocalCollectorEnvVars(container, newEnvVars, mergeOptions, params.LMConfig.MutationConfig.Collector)
+		logger.Info("Added node-local collector endpoint env variables")
+	}
+
+	// Add the resource attributes mapped from the pod labels & annotations
+	if params.LMConfig.MutationConfigProvided && len(params.LMConfig.MutationConfig.AttributeMappings) > 0 {
+		newEnvVars = addMappedAttributesToOtelResAttribute(ctx, params.Pod, newEnvVars, params.LMConfig.MutationConfig.AttributeMappings)
+	}
+
+	if params.LMConfig.MutationConfigProvided && len(params.LMConfig.MutationConfig.LMEnvVars.EnvFrom) > 0 {
+		targetContainer.EnvFrom = mergeEnvFromSources(container.EnvFrom, state.envFromSources)
+	}
+
+	return mutateContainerEnvVariables(ctx, params, targetContainer, newEnvVars, mergeOptions, logger)
 }
 
-func mutateContainerEnvVariables(container corev1.Container, newEnvVars []corev1.EnvVar, params *Params, logger logr.Logger) error {
-	envVars, err := mergeNewEnv(container.Env, newEnvVars)
+func mutateContainerEnvVariables(ctx context.Context, params *Params, container *corev1.Container, newEnvVars []corev1.EnvVar, mergeOptions map[string]envMergeOption, logger logr.Logger) error {
+	envVars, warnings, err := mergeNewEnv(ctx, container.Env, newEnvVars, mergeOptions)
 	if err != nil {
 		return err
 	}
-	// Move the OTELResourceAttributes to the last index of the newEnvVar list to satisfy environment variable dependency
-	if otelResourceAttributesIndex := getIndexOfEnv(envVars, OTELResourceAttributes); otelResourceAttributesIndex > -1 {
-		// Copy last env var in the list
-		currentLastEnvVar := envVars[len(envVars)-1]
-
-		// Move OTELResourceAttributes env variable to the last
-		envVars[len(envVars)-1] = envVars[otelResourceAttributesIndex]
-
-		// Move previously copied last element to the OTELResourceAttributes's old position
-		envVars[otelResourceAttributesIndex] = currentLastEnvVar
+	for _, warning := range warnings {
+		params.addWarning(warning)
 	}
+	// Order the injected env variables to satisfy the $(VAR) dependencies, like the OTELResourceAttributes referring to the resource env variables,
+	// env variables of the container keep their order
+	envVars = orderEnvByDependency(envVars, container.Env)
 
 	logger.Info("Final list of env variables after merge", "env vars:", envVars)
-	for idx, ctr := range params.Pod.Spec.Containers {
-		if ctr.Name == container.Name {
-			ctr.Env = envVars
-			params.Pod.Spec.Containers[idx] = ctr
-			break
-		}
-	}
+	container.Env = envVars
 	return nil
 }
 
-// getLmotelEnvironmentVariables returns a list of default env variables required by LM-OTEL
-func getLmotelEnvironmentVariables() []corev1.EnvVar {
+// getLmotelEnvironmentVariables returns a list of default env variables required by LM-OTEL, default attributes are customized as per the config.
+// LM_APM_* env variables, which are not referred by any of the resulting attributes, are not injected.
+func getLmotelEnvironmentVariables(ctx context.Context, defaultAttributesConfig config.DefaultAttributes, semanticConventions config.SemanticConventions) []corev1.EnvVar {
 
 	// Creates a list of default env variables required by LM-OTEL
 	lmotelEnvVars := []corev1.EnvVar{
 		{
 			Name:  LMAPMClusterName,
-			Value: os.Getenv(ClusterName),
+			Value: clusterinfo.Name(),
 		},
 
 		{
@@ -267,17 +502,9 @@ func getLmotelEnvironmentVariables() []corev1.EnvVar {
 		},
 	}
 
-	res := map[string]string{}
-
-	res["resource.type"] = "kubernetes-pod"
-	res["ip"] = fmt.Sprintf("$(%s)", LMAPMPodIP)
-	res["host.name"] = fmt.Sprintf("$(%s)", LMAPMPodName)
-	res["k8s.pod.uid"] = fmt.Sprintf("$(%s)", LMAPMPodUID)
-	res["service.namespace"] = fmt.Sprintf("$(%s)", ServiceNamespace)
-	res["k8s.namespace.name"] = fmt.Sprintf("$(%s)", LMAPMPodNamespace)
-	res["k8s.node.name"] = fmt.Sprintf("$(%s)", LMAPMNodeName)
-	res["k8s.cluster.name"] = fmt.Sprintf("$(%s)", LMAPMClusterName)
-
+	// LM_APM_* env variables are injected even if the default attributes referring them are dropped,
+	// as the container, profile or config env variables may refer them
+	res := getDefaultAttributes(ctx, defaultAttributesConfig, semanticConventions)
 	resStr := createResMapStr(res)
 
 	lmotelEnvVars = append(lmotelEnvVars, corev1.EnvVar{Name: OTELResourceAttributes, Value: resStr})
@@ -285,14 +512,52 @@ func getLmotelEnvironmentVariables() []corev1.EnvVar {
 	return lmotelEnvVars
 }
 
-// Merges new environment variables with the existing ones
-func mergeNewEnv(originalEnvVars []corev1.EnvVar, newEnvVars []corev1.EnvVar) ([]corev1.EnvVar, error) {
-	logger := log.Log.WithName("mergeNewEnv")
+// getDefaultAttributes returns the default resource attributes after applying the drop, rename & add customizations of the config
+func getDefaultAttributes(ctx context.Context, defaultAttributesConfig config.DefaultAttributes, semanticConventions config.SemanticConventions) map[string]string {
+	logger := log.FromContext(ctx).WithName("getDefaultAttributes")
+
+	res := map[string]string{}
+	for _, attr := range defaultAttributes {
+		res[attr.Key] = attr.Value
+	}
+	serviceNamespaceKeys, found := config.GetSemconvKeys(ServiceNamespace, semanticConventions)
+	if !found {
+		serviceNamespaceKeys = []string{"service.namespace"}
+	}
+	for _, key := range serviceNamespaceKeys {
+		res[key] = fmt.Sprintf("$(%s)", ServiceNamespace)
+	}
+	for _, key := range defaultAttributesConfig.Drop {
+		if _, ok := res[key]; !ok {
+			logger.Info("default attribute to be dropped is not found", "key", key)
+		}
+		delete(res, key)
+	}
+	for key, newKey := range defaultAttributesConfig.Rename {
+		value, ok := res[key]
+		if !ok {
+			logger.Info("default attribute to be renamed is not found", "key", key)
+			continue
+		}
+		delete(res, key)
+		res[newKey] = value
+	}
+	for _, attr := range defaultAttributesConfig.Add {
+		res[attr.Key] = attr.Value
+	}
+	return res
+}
+
+// Merges new environment variables with the existing ones, conflicting env variables are merged as per their merge option if present,
+// otherwise value of the new env variable is used. Warnings are returned for the env variables, which could not be merged as per their merge option.
+func mergeNewEnv(ctx context.Context, originalEnvVars []corev1.EnvVar, newEnvVars []corev1.EnvVar, mergeOptions map[string]envMergeOption) ([]corev1.EnvVar, []string, error) {
+	logger := log.FromContext(ctx).WithName("mergeNewEnv")
 
 	origEnvVarMap := map[string]corev1.EnvVar{}
 	for _, v := range originalEnvVars {
 		origEnvVarMap[v.Name] = v
 	}
+	var warnings []string
 	mergedEnv := make([]corev1.EnvVar, len(originalEnvVars))
 	logger.Info("originalEnvVars", "originalEnvVars", originalEnvVars)
 	copy(mergedEnv, originalEnvVars)
@@ -312,6 +577,15 @@ func mergeNewEnv(originalEnvVars []corev1.EnvVar, newEnvVars []corev1.EnvVar) ([
 			logger.Info("env var conflict found", "newEnvVar", newEnvVar, "envVar", envVar)
 
 			idx := getIndexOfEnv(mergedEnv, envVar.Name)
+
+			if mergeOption, ok := mergeOptions[newEnvVar.Name]; ok {
+				var warning string
+				mergedEnv[idx], warning = mergeEnvVar(ctx, envVar, newEnvVar, mergeOption)
+				if warning != "" {
+					warnings = append(warnings, warning)
+				}
+				continue
+			}
 			mergedEnv[idx].Value = newEnvVar.Value
 			mergedEnv[idx].ValueFrom = newEnvVar.ValueFrom
 
@@ -342,26 +616,53 @@ func mergeNewEnv(originalEnvVars []corev1.EnvVar, newEnvVars []corev1.EnvVar) ([
 			}
 		}
 	}
-	return mergedEnv, nil
+	return mergedEnv, warnings, nil
 }
 
-// getOTELSemVarKey returns the key as per the OTEL semantic conventions for the given raw key
-func getOTELSemVarKey(rawKey string) (string, bool) {
-	switch rawKey {
-	case ServiceNamespace:
-		return string(semconv.ServiceNamespaceKey), true
+// getOTELSemVarKeys returns the keys as per the semantic conventions of the config for the given raw key, followed by all of its aliases.
+// Aliases are returned even if they are not emitted, as the container may still specify the attribute using the old key.
+func getOTELSemVarKeys(rawKey string, semanticConventions config.SemanticConventions) ([]string, bool) {
+	semanticConventions.EmitAliases = true
+	return config.GetSemconvKeys(rawKey, semanticConventions)
+}
 
-	case ServiceName:
-		return string(semconv.ServiceNameKey), true
+// getWorkloadName returns the name of the workload resource managing the pod.
+// If the time budget of the request is exhausted, the workload lookup is skipped and the pod name is returned.
+func getWorkloadName(ctx context.Context, params *Params) (string, error) {
+	if params.WorkloadName != "" {
+		return params.WorkloadName, nil
+	}
+	if workloadName, found := params.Cache.getWorkloadName(params.Pod, params.Namespace); found {
+		return workloadName, nil
+	}
+	if ctx.Err() != nil {
+		log.FromContext(ctx).WithName("getWorkloadName").Info("time budget is exhausted, skipping the workload lookup & using the pod name", "pod", getPodName(params.Pod))
+		metrics.DegradedMutations.WithLabelValues(metrics.DegradedStepWorkloadLookup).Inc()
+		return getPodName(params.Pod), nil
+	}
+	workloadName, err := getParentWorkloadNameForPod(ctx, params.Pod, params.Client, params.Namespace, params.WorkloadLookup)
+	if err != nil && ctx.Err() != nil {
+		log.FromContext(ctx).WithName("getWorkloadName").Error(err, "time budget is exhausted in the workload lookup, using the pod name", "pod", getPodName(params.Pod))
+		metrics.DegradedMutations.WithLabelValues(metrics.DegradedStepWorkloadLookup).Inc()
+		return getPodName(params.Pod), nil
+	}
+	if err == nil {
+		params.Cache.addWorkloadName(params.Pod, params.Namespace, workloadName)
+	}
+	return workloadName, err
+}
 
-	default:
-		return "", false
+// getPodName returns the name of the pod, generate name is used if the name is not yet assigned
+func getPodName(pod *corev1.Pod) string {
+	if pod.GetName() != "" {
+		return pod.GetName()
 	}
+	return strings.TrimSuffix(pod.GetGenerateName(), "-")
 }
 
 // getParentWorkloadNameForPod returns the parent workload name which is managing the pod
-func getParentWorkloadNameForPod(pod *corev1.Pod, k8sClient *config.K8sClient, namespace string) (string, error) {
-	logger := log.Log.WithName("getParentWorkloadNameForPod")
+func getParentWorkloadNameForPod(ctx context.Context, pod *corev1.Pod, k8sClient *config.K8sClient, namespace string, opts WorkloadLookupOptions) (string, error) {
+	logger := log.FromContext(ctx).WithName("getParentWorkloadNameForPod")
 	// If no owner reference is present, that means Pod is deployed independently
 	if len(pod.GetOwnerReferences()) == 0 {
 		logger.Info("Orphan pod is found")
@@ -373,31 +674,34 @@ func getParentWorkloadNameForPod(pod *corev1.Pod, k8sClient *config.K8sClient, n
 		switch ownerRef.Kind {
 		case WorkloadResourceJob:
 			var owner batchv1.Job
-			return extractResourceWorkloadName(namespacedName, k8sClient, &owner)
+			return extractResourceWorkloadName(ctx, namespacedName, k8sClient, &owner, opts)
 		case WorkloadResourceReplicaSet:
 			var owner appsv1.ReplicaSet
-			return extractResourceWorkloadName(namespacedName, k8sClient, &owner)
+			return extractResourceWorkloadName(ctx, namespacedName, k8sClient, &owner, opts)
 		case WorkloadResourceDaemonSet:
 			var owner appsv1.DaemonSet
-			return extractResourceWorkloadName(namespacedName, k8sClient, &owner)
+			return extractResourceWorkloadName(ctx, namespacedName, k8sClient, &owner, opts)
 		case WorkloadResourceStatefulSet:
 			var owner appsv1.StatefulSet
-			return extractResourceWorkloadName(namespacedName, k8sClient, &owner)
+			return extractResourceWorkloadName(ctx, namespacedName, k8sClient, &owner, opts)
 		}
 	}
 	return "", fmt.Errorf("invalid workload resource: %v", pod.GetOwnerReferences())
 }
 
 // extractResourceWorkloadName extracts the resource workload name of the pod based on the owner references
-func extractResourceWorkloadName(namespacedName types.NamespacedName, k8sClient *config.K8sClient, owner client.Object) (string, error) {
-	logger := log.Log.WithName("extractResourceWorkloadName")
+// Each API call is bounded by the request context & the lookup timeout, and retried on the transient errors.
+func extractResourceWorkloadName(ctx context.Context, namespacedName types.NamespacedName, k8sClient *config.K8sClient, owner client.Object, opts WorkloadLookupOptions) (string, error) {
+	logger := log.FromContext(ctx).WithName("extractResourceWorkloadName")
 	getOpts := metav1.GetOptions{}
 
 	var err error
 
 	switch owner.(type) {
 	case *appsv1.ReplicaSet:
-		owner, err = k8sClient.Clientset.AppsV1().ReplicaSets(namespacedName.Namespace).Get(context.Background(), namespacedName.Name, getOpts)
+		owner, err = retryWorkloadLookup(ctx, opts, func(ctx context.Context) (client.Object, error) {
+			return k8sClient.Clientset.AppsV1().ReplicaSets(namespacedName.Namespace).Get(ctx, namespacedName.Name, getOpts)
+		})
 		if err != nil {
 			logger.Error(err, "error in getting owner resource details")
 			return "", err
@@ -405,7 +709,7 @@ func extractResourceWorkloadName(namespacedName types.NamespacedName, k8sClient
 		for _, parentOwnerRef := range owner.GetOwnerReferences() {
 			if parentOwnerRef.Kind == WorkloadResourceDeployment {
 				var parentOwner appsv1.Deployment
-				return extractResourceWorkloadName(types.NamespacedName{Namespace: owner.GetNamespace(), Name: parentOwnerRef.Name}, k8sClient, &parentOwner)
+				return extractResourceWorkloadName(ctx, types.NamespacedName{Namespace: owner.GetNamespace(), Name: parentOwnerRef.Name}, k8sClient, &parentOwner, opts)
 			}
 		}
 	case *appsv1.Deployment:
@@ -423,16 +727,21 @@ func extractResourceWorkloadName(namespacedName types.NamespacedName, k8sClient
 	return namespacedName.Name, nil
 }
 
-// addResEnvToOtelResAttribute adds resource env variable to the OTELResourceAttributes
-func addResEnvToOtelResAttribute(resourceEnvVar corev1.EnvVar, newEnvVars []corev1.EnvVar, resAttrName string) []corev1.EnvVar {
+// addResEnvToOtelResAttribute adds resource env variable to the OTELResourceAttributes.
+// Key of the attribute is looked up in the semantic conventions mapping table, which may emit the aliases of the key as well.
+func addResEnvToOtelResAttribute(resourceEnvVar corev1.EnvVar, newEnvVars []corev1.EnvVar, resAttrName string, semanticConventions config.SemanticConventions) []corev1.EnvVar {
 	var otelResourceAttributesIndex int
 	var newEnvStr string
 	// Find the location of OTELResourceAttributes in the list
 	otelResourceAttributesIndex = getIndexOfEnv(newEnvVars, OTELResourceAttributes)
 	if otelResourceAttributesIndex > -1 {
-		otelSemVarKey, found := getOTELSemVarKey(resourceEnvVar.Name)
+		otelSemVarKeys, found := config.GetSemconvKeys(resourceEnvVar.Name, semanticConventions)
 		if found {
-			newEnvStr = fmt.Sprintf("%s=$(%s)", otelSemVarKey, resourceEnvVar.Name)
+			attrs := make([]string, 0, len(otelSemVarKeys))
+			for _, otelSemVarKey := range otelSemVarKeys {
+				attrs = append(attrs, fmt.Sprintf("%s=$(%s)", otelSemVarKey, resourceEnvVar.Name))
+			}
+			newEnvStr = strings.Join(attrs, ",")
 		} else {
 			if resAttrName != "" {
 				newEnvStr = fmt.Sprintf("%s=$(%s)", resAttrName, resourceEnvVar.Name)
@@ -447,8 +756,8 @@ func addResEnvToOtelResAttribute(resourceEnvVar corev1.EnvVar, newEnvVars []core
 }
 
 // checkIfPodHasLabel checks if label specified in a env value is present on the pod
-func checkIfPodHasLabel(pod *corev1.Pod, envVar corev1.EnvVar) (string, bool, error) {
-	logger := log.Log.WithName("checkIfPodHasLabel")
+func checkIfPodHasLabel(ctx context.Context, pod *corev1.Pod, envVar corev1.EnvVar) (string, bool, error) {
+	logger := log.FromContext(ctx).WithName("checkIfPodHasLabel")
 	// Parse label name
 	exp, err := regexp.Compile(`\[\'(.*?)\'\]`)
 	if err != nil {
@@ -472,6 +781,114 @@ func checkIfPodHasLabel(pod *corev1.Pod, envVar corev1.EnvVar) (string, bool, er
 
 }
 
+// getPodNamespace returns the namespace object of the pod
+func getPodNamespace(ctx context.Context, params *Params) (*corev1.Namespace, error) {
+	if params.Client == nil {
+		return nil, nil
+	}
+	// Namespace returned by the lister is shared with the informer cache, so it must not be modified
+	if lister := params.Client.NamespaceLister(); lister != nil {
+		return lister.Get(params.Namespace)
+	}
+	return params.Client.Clientset.CoreV1().Namespaces().Get(ctx, params.Namespace, metav1.GetOptions{})
+}
+
+// standardOTELEnvVars maps the resource env variables to the standard OTel env variables holding the same value
+var standardOTELEnvVars = map[string]string{ServiceName: OTELServiceName}
+
+// getContainerResourceEnv returns the resource env variable as specified in the container, in the order of precedence:
+// the env variable itself, the standard OTel env variable like OTEL_SERVICE_NAME, and the attribute of the container OTELResourceAttributes.
+// Attribute is matched by its key as per the semantic conventions of the config, or by any of its aliases.
+func getContainerResourceEnv(container corev1.Container, name string, semanticConventions config.SemanticConventions) (corev1.EnvVar, bool) {
+	if idx := getIndexOfEnv(container.Env, name); idx > -1 {
+		return corev1.EnvVar{Name: name, Value: container.Env[idx].Value, ValueFrom: container.Env[idx].ValueFrom}, true
+	}
+	if otelEnvName, ok := standardOTELEnvVars[name]; ok {
+		if idx := getIndexOfEnv(container.Env, otelEnvName); idx > -1 {
+			return corev1.EnvVar{Name: name, Value: container.Env[idx].Value, ValueFrom: container.Env[idx].ValueFrom}, true
+		}
+	}
+	attrKeys, found := getOTELSemVarKeys(name, semanticConventions)
+	if !found {
+		return corev1.EnvVar{}, false
+	}
+	idx := getIndexOfEnv(container.Env, OTELResourceAttributes)
+	if idx < 0 {
+		return corev1.EnvVar{}, false
+	}
+	attrValues := map[string]string{}
+	for _, attr := range strings.Split(container.Env[idx].Value, ",") {
+		keyValue := strings.SplitN(attr, "=", 2)
+		if len(keyValue) == 2 && strings.TrimSpace(keyValue[1]) != "" {
+			attrValues[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
+		}
+	}
+	// Current key takes precedence over the aliases
+	for _, attrKey := range attrKeys {
+		if value, ok := attrValues[attrKey]; ok {
+			return corev1.EnvVar{Name: name, Value: value}, true
+		}
+	}
+	return corev1.EnvVar{}, false
+}
+
+// getServiceVersionEnv returns the SERVICE_VERSION env variable derived from the first source of the config having a non empty value.
+// If the container specifies the service version, it is used as is.
+func getServiceVersionEnv(pod *corev1.Pod, container corev1.Container, serviceVersion config.ServiceVersion, semanticConventions config.SemanticConventions) (corev1.EnvVar, bool) {
+	if svcVersionEnv, found := getContainerResourceEnv(container, ServiceVersion, semanticConventions); found {
+		return svcVersionEnv, true
+	}
+	for _, source := range serviceVersion.Sources {
+		var value string
+		switch source.Type {
+		case config.ServiceVersionSourceLabel:
+			value = pod.Labels[source.Name]
+		case config.ServiceVersionSourceAnnotation:
+			value = pod.Annotations[source.Name]
+		case config.ServiceVersionSourceImageTag:
+			_, value = parseImage(container.Image)
+		case config.ServiceVersionSourceImageDigest:
+			value = parseImageDigest(container.Image)
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			return corev1.EnvVar{Name: ServiceVersion, Value: value}, true
+		}
+	}
+	return corev1.EnvVar{}, false
+}
+
+// getNamespaceAttributes returns the values of service.namespace & deployment.environment derived from the pod namespace as per the config
+func getNamespaceAttributes(ctx context.Context, params *Params, lookups *podLookups) (string, string) {
+	logger := log.FromContext(ctx).WithName("getNamespaceAttributes")
+
+	if !params.LMConfig.MutationConfigProvided {
+		return "", ""
+	}
+	namespaceAttributes := params.LMConfig.MutationConfig.NamespaceAttributes
+	if namespaceAttributes.ServiceNamespace.IsEmpty() && namespaceAttributes.DeploymentEnvironment.IsEmpty() {
+		return "", ""
+	}
+	namespace := lookups.getNamespace(ctx)
+	if namespace == nil {
+		logger.Info("pod namespace is not found, skipping the namespace attributes", "namespace", params.Namespace)
+		return "", ""
+	}
+	return getNamespaceAttribute(namespace, namespaceAttributes.ServiceNamespace), getNamespaceAttribute(namespace, namespaceAttributes.DeploymentEnvironment)
+}
+
+// getNamespaceAttribute returns the value of the label or annotation of the namespace specified by the source
+func getNamespaceAttribute(namespace *corev1.Namespace, source config.NamespaceAttributeSource) string {
+	if source.Label != "" {
+		if value := strings.TrimSpace(namespace.Labels[source.Label]); value != "" {
+			return value
+		}
+	}
+	if source.Annotation != "" {
+		return strings.TrimSpace(namespace.Annotations[source.Annotation])
+	}
+	return ""
+}
+
 func createResMapStr(res map[string]string) string {
 	resKeys := make([]string, 0, len(res))
 	for key := range res {
@@ -497,10 +914,15 @@ func getIndexOfEnv(envs []corev1.EnvVar, name string) int {
 	return -1
 }
 
-func getApplicationContainer(pod *corev1.Pod) corev1.Container {
-	// TODO: need to apply some logic to return the container to be mutated.
-	// For now first container in the list is returned.
-	return pod.Spec.Containers[0]
+// getSkipList returns the env variables of the skipList, which are injected by the webhook
+func getSkipList(lmotelEnvVars []corev1.EnvVar) []string {
+	var managedSkipList []string
+	for _, name := range skipList {
+		if getIndexOfEnv(lmotelEnvVars, name) > -1 {
+			managedSkipList = append(managedSkipList, name)
+		}
+	}
+	return managedSkipList
 }
 
 func isResourceEnvVarToBeSkipped(skipList []string, envVar corev1.EnvVar, logger logr.Logger) bool {
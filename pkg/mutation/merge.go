@@ -0,0 +1,118 @@
+package mutation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// defaultListSeparator is used by the append & prepend merge strategies, if separator is not specified
+	defaultListSeparator = " "
+
+	// defaultKeyValueSeparator is used by the mergeKeyValue merge strategy, if separator is not specified
+	defaultKeyValueSeparator = ","
+)
+
+// envMergeOption represents the merge strategy of the injected env variable
+type envMergeOption struct {
+	strategy  config.MergeStrategy
+	separator string
+}
+
+// mergeEnvVar merges the injected env variable with the existing env variable of the container as per the merge option.
+// Warning is returned, if the env variables can not be merged as per the merge option & the existing env variable is kept.
+func mergeEnvVar(ctx context.Context, existingEnvVar corev1.EnvVar, newEnvVar corev1.EnvVar, mergeOption envMergeOption) (corev1.EnvVar, string) {
+	logger := log.FromContext(ctx).WithName("mergeEnvVar")
+
+	switch mergeOption.strategy {
+	case config.MergeStrategyKeepExisting:
+		return existingEnvVar, ""
+
+	case config.MergeStrategyAppend, config.MergeStrategyPrepend, config.MergeStrategyMergeKeyValue:
+		// Values referred through valueFrom can not be combined, existing env variable is kept rather than losing its source
+		if existingEnvVar.ValueFrom != nil || newEnvVar.ValueFrom != nil {
+			logger.Info("env variable value is referred through valueFrom, keeping the existing env variable", "Name", newEnvVar.Name, "strategy", mergeOption.strategy)
+			return existingEnvVar, fmt.Sprintf("env variable %s is referred through valueFrom and can not be merged with the %s strategy, existing env variable is kept", newEnvVar.Name, mergeOption.strategy)
+		}
+		mergedEnvVar := existingEnvVar
+		switch mergeOption.strategy {
+		case config.MergeStrategyAppend:
+			mergedEnvVar.Value = joinListValues(existingEnvVar.Value, newEnvVar.Value, separatorOrDefault(mergeOption.separator, defaultListSeparator), false)
+		case config.MergeStrategyPrepend:
+			mergedEnvVar.Value = joinListValues(existingEnvVar.Value, newEnvVar.Value, separatorOrDefault(mergeOption.separator, defaultListSeparator), true)
+		default:
+			mergedEnvVar.Value = mergeKeyValues(existingEnvVar.Value, newEnvVar.Value, separatorOrDefault(mergeOption.separator, defaultKeyValueSeparator))
+		}
+		return mergedEnvVar, ""
+
+	default:
+		return newEnvVar, ""
+	}
+}
+
+// joinListValues appends or prepends the injected value to the existing value with the separator.
+// If the injected value is already a part of the existing value, for example when the already mutated object is mutated again, existing value is returned as is.
+func joinListValues(existingValue string, injectedValue string, separator string, prepend bool) string {
+	if existingValue == "" {
+		return injectedValue
+	}
+	if injectedValue == "" || containsListValue(existingValue, injectedValue, separator) {
+		return existingValue
+	}
+	if prepend {
+		return injectedValue + separator + existingValue
+	}
+	return existingValue + separator + injectedValue
+}
+
+// containsListValue checks if the value is present as a separated element sequence in the list
+func containsListValue(list string, value string, separator string) bool {
+	return list == value ||
+		strings.HasPrefix(list, value+separator) ||
+		strings.HasSuffix(list, separator+value) ||
+		strings.Contains(list, separator+value+separator)
+}
+
+// mergeKeyValues merges the key=value pairs of the new value with the existing one, keys of the new value take precedence
+func mergeKeyValues(existingValue string, newValue string, separator string) string {
+	newKeys := map[string]bool{}
+	var pairs []string
+	for _, pair := range splitKeyValues(newValue, separator) {
+		newKeys[keyOfPair(pair)] = true
+		pairs = append(pairs, pair)
+	}
+	for _, pair := range splitKeyValues(existingValue, separator) {
+		if !newKeys[keyOfPair(pair)] {
+			pairs = append(pairs, pair)
+		}
+	}
+	return strings.Join(pairs, separator)
+}
+
+// splitKeyValues splits the value into key=value pairs ignoring the empty ones
+func splitKeyValues(value string, separator string) []string {
+	var pairs []string
+	for _, pair := range strings.Split(value, separator) {
+		if strings.TrimSpace(pair) != "" {
+			pairs = append(pairs, strings.TrimSpace(pair))
+		}
+	}
+	return pairs
+}
+
+// keyOfPair returns the key of the key=value pair
+func keyOfPair(pair string) string {
+	return strings.TrimSpace(strings.SplitN(pair, "=", 2)[0])
+}
+
+func separatorOrDefault(separator string, defaultSeparator string) string {
+	if separator == "" {
+		return defaultSeparator
+	}
+	return separator
+}
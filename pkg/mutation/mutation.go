@@ -3,8 +3,12 @@ package mutation
 import (
 	"context"
 	"errors"
+	"fmt"
+	"regexp"
+	"time"
 
 	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/metrics"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
@@ -19,10 +23,22 @@ const (
 	LMAPMPodNamespace      = "LM_APM_POD_NAMESPACE"
 	LMAPMPodIP             = "LM_APM_POD_IP"
 	LMAPMPodUID            = "LM_APM_POD_UID"
+	LMAPMHostIP            = "LM_APM_HOST_IP"
 	ClusterName            = "CLUSTER_NAME"
 	ServiceNamespace       = "SERVICE_NAMESPACE"
 	ServiceName            = "SERVICE_NAME"
+	ServiceVersion         = "SERVICE_VERSION"
+	DeploymentEnvironment  = "DEPLOYMENT_ENVIRONMENT"
 	OTELResourceAttributes = "OTEL_RESOURCE_ATTRIBUTES"
+	OTELServiceName        = "OTEL_SERVICE_NAME"
+
+	// OTLP exporter
+
+	OTELExporterOTLPEndpoint        = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	OTELExporterOTLPProtocol        = "OTEL_EXPORTER_OTLP_PROTOCOL"
+	OTELExporterOTLPTracesEndpoint  = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	OTELExporterOTLPMetricsEndpoint = "OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"
+	OTELExporterOTLPLogsEndpoint    = "OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"
 
 	// Workload resource discovery
 
@@ -44,7 +60,32 @@ const (
 // }
 
 // skipList represents the env variables that the user should not pass through external config or manifest, these are managed by webhook itself
-var skipList = []string{LMAPMClusterName, LMAPMNodeName, LMAPMPodName, LMAPMPodNamespace, LMAPMPodIP, LMAPMPodUID, OTELResourceAttributes}
+var skipList = []string{LMAPMClusterName, LMAPMNodeName, LMAPMPodName, LMAPMPodNamespace, LMAPMPodIP, LMAPMPodUID, LMAPMHostIP, OTELResourceAttributes}
+
+// defaultAttributes represents the resource attributes set in OTEL_RESOURCE_ATTRIBUTES by default, which can be customized through the config.
+// Attribute of SERVICE_NAMESPACE is added along with them, using the key as per the semantic conventions of the config.
+var defaultAttributes = []config.Attribute{
+	{Key: "resource.type", Value: "kubernetes-pod"},
+	{Key: "ip", Value: fmt.Sprintf("$(%s)", LMAPMPodIP)},
+	{Key: "host.name", Value: fmt.Sprintf("$(%s)", LMAPMPodName)},
+	{Key: "k8s.pod.uid", Value: fmt.Sprintf("$(%s)", LMAPMPodUID)},
+	{Key: "k8s.namespace.name", Value: fmt.Sprintf("$(%s)", LMAPMPodNamespace)},
+	{Key: "k8s.node.name", Value: fmt.Sprintf("$(%s)", LMAPMNodeName)},
+	{Key: "k8s.cluster.name", Value: fmt.Sprintf("$(%s)", LMAPMClusterName)},
+}
+
+// envVarRefExp matches the $(VAR_NAME) references to the env variables
+var envVarRefExp = regexp.MustCompile(`\$\(([A-Za-z_][A-Za-z0-9_]*)\)`)
+
+// IsManagedEnvVar checks if the env variable is one of the LM_APM_* env variables managed by the webhook
+func IsManagedEnvVar(name string) bool {
+	for _, skipListEnvVar := range skipList {
+		if name == skipListEnvVar && name != OTELResourceAttributes {
+			return true
+		}
+	}
+	return false
+}
 
 // errors
 var (
@@ -69,18 +110,70 @@ type Params struct {
 	Mutations []Mutation
 	Pod       *corev1.Pod
 	Namespace string
+
+	// WorkloadName is set when the pod template of the workload is mutated, it is used as is instead of looking up the pod owners
+	WorkloadName string
+
+	// WorkloadLookup holds the options of looking up the workload resource managing the pod
+	WorkloadLookup WorkloadLookupOptions
+
+	// Cache memoizes the mutation results & the workload names, nothing is memoized if it is nil
+	Cache *MutationCache
+
+	// SecretCopier copies the secrets referred by the injected env variables from the webhook namespace, secrets are not copied if it is nil
+	SecretCopier SecretCopier
+
+	// DryRun runs the mutation without its side effects, like copying the secrets, and without memoizing the result.
+	// It is set for the dry run & observe-only admission requests, and wherever the mutation is evaluated without being applied.
+	DryRun bool
+
+	// Warnings are returned to the client along with the admission response
+	Warnings []string
+
+	// envSourcesSkipped is set when the secrets or config maps referred by the injected env variables can not be satisfied
+	envSourcesSkipped bool
+}
+
+// addWarning adds the warning to be returned to the client, the same warning is returned once, for example when it is raised for multiple containers
+func (p *Params) addWarning(warning string) {
+	for _, existing := range p.Warnings {
+		if existing == warning {
+			return
+		}
+	}
+	p.Warnings = append(p.Warnings, warning)
 }
 
-// RunMutations invokes the allowed mutations defined by Mutations
+// RunMutations invokes the allowed mutations defined by Mutations.
+// If the identical pod is already mutated, the memoized pod spec is used instead.
 func RunMutations(ctx context.Context, params *Params) error {
+	cacheKey, cacheable := params.Cache.resultKey(ctx, params)
+	if cacheable {
+		if result, found := params.Cache.getResult(cacheKey); found {
+			params.Log.Info("Using the memoized mutation result of the identical pod")
+			params.Pod.Spec = result.spec
+			params.Warnings = append(params.Warnings, result.warnings...)
+			return nil
+		}
+	}
+
 	for _, mutation := range params.Mutations {
 		if mutationRequired(mutation, params.Pod) {
+			start := time.Now()
 			err := mutation.Do(ctx, params)
+			metrics.MutationDuration.WithLabelValues(mutation.Name).Observe(time.Since(start).Seconds())
 			if err != nil {
+				metrics.MutationErrors.WithLabelValues(mutation.Name).Inc()
 				return err
 			}
 		}
 	}
+
+	// Result degraded by the exhausted time budget is not memoized, neither is the dry run result which skipped the side effects,
+	// nor the result which skipped the missing env sources, as they may be created any time
+	if cacheable && ctx.Err() == nil && !params.DryRun && !params.envSourcesSkipped {
+		params.Cache.addResult(cacheKey, params.Pod.Spec, params.Warnings)
+	}
 	return nil
 }
 
@@ -2,19 +2,30 @@ package mutation
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/logicmonitor/lm-k8s-webhook/internal/testutil"
 	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	testclient "k8s.io/client-go/kubernetes/fake"
+	typedappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
 	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
@@ -1166,7 +1177,7 @@ func TestGetLmotelEnvironmentVariables(t *testing.T) {
 		},
 	}
 
-	lmotelEnvVars := getLmotelEnvironmentVariables()
+	lmotelEnvVars := getLmotelEnvironmentVariables(context.Background(), config.DefaultAttributes{}, config.SemanticConventions{})
 
 	if !cmp.Equal(lmotelEnvVars, test.wantPayload, cmpOpt) {
 		t.Errorf("getLmotelEnvironmentVariables() expected value is %v, but found %v", test.wantPayload, lmotelEnvVars)
@@ -1393,7 +1404,7 @@ func TestMergeNewEnv(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mergedEnvVars, err := mergeNewEnv(tt.args.originalEnvVars, tt.args.newEnvVars)
+			mergedEnvVars, _, err := mergeNewEnv(context.Background(), tt.args.originalEnvVars, tt.args.newEnvVars, nil)
 
 			if err == nil && tt.wantErr {
 				t.Errorf("mergeNewEnv() returned nil, instead of error")
@@ -1532,7 +1543,7 @@ func TestAddResEnvToOtelResAttribute(t *testing.T) {
 		},
 	}
 
-	newEnvVars := addResEnvToOtelResAttribute(test.args.resourceEnvVar, test.args.newEnvVars, "")
+	newEnvVars := addResEnvToOtelResAttribute(test.args.resourceEnvVar, test.args.newEnvVars, "", config.SemanticConventions{})
 
 	for _, expectedEnvVar := range test.wantPayload.envVars {
 		for _, envVar := range newEnvVars {
@@ -1698,7 +1709,7 @@ func TestGetParentWorkloadNameForPod(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			workloadName, err := getParentWorkloadNameForPod(tt.args.pod, tt.args.k8sClient, tt.args.namespace)
+			workloadName, err := getParentWorkloadNameForPod(context.Background(), tt.args.pod, tt.args.k8sClient, tt.args.namespace, WorkloadLookupOptions{})
 
 			if err == nil && tt.wantErr {
 				t.Errorf("getParentWorkloadNameForPod() returned nil, instead of error")
@@ -1823,7 +1834,7 @@ func TestExtractResourceWorkloadName(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			workloadName, err := extractResourceWorkloadName(tt.args.namespacedName, tt.args.k8sClient, tt.args.owner)
+			workloadName, err := extractResourceWorkloadName(context.Background(), tt.args.namespacedName, tt.args.k8sClient, tt.args.owner, WorkloadLookupOptions{})
 
 			if err == nil && tt.wantErr {
 				t.Errorf("extractResourceWorkloadName() returned nil, instead of error")
@@ -1946,7 +1957,7 @@ func TestCheckIfPodHasLabel(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			labelValue, _, err := checkIfPodHasLabel(tt.args.pod, tt.args.envVar)
+			labelValue, _, err := checkIfPodHasLabel(context.Background(), tt.args.pod, tt.args.envVar)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("checkIfPodHasLabel() error = %v, but expected is error = %v", err, tt.wantErr)
@@ -1966,70 +1977,125 @@ func TestCheckIfPodHasLabel(t *testing.T) {
 	}
 }
 
-func TestGetOTELSemVarKey(t *testing.T) {
+func TestGetOTELSemVarKeys(t *testing.T) {
 
 	tests := []struct {
-		name string
-		args struct {
-			rawKey string
-		}
-		wantPayload struct {
-			otelSemVarKey string
-			found         bool
-		}
+		name                string
+		rawKey              string
+		semanticConventions config.SemanticConventions
+		wantKeys            []string
+		wantFound           bool
 	}{
 		{
-			name: "get OTEL sem var key for SERVICE_NAMESPACE",
-			args: struct{ rawKey string }{
-				"SERVICE_NAMESPACE",
-			},
-			wantPayload: struct {
-				otelSemVarKey string
-				found         bool
-			}{
-				"service.namespace",
-				true,
-			},
+			name:      "get OTEL sem var key for SERVICE_NAMESPACE",
+			rawKey:    "SERVICE_NAMESPACE",
+			wantKeys:  []string{"service.namespace"},
+			wantFound: true,
 		},
 		{
-			name: "get OTEL sem var key for SERVICE_NAME",
-			args: struct{ rawKey string }{
-				"SERVICE_NAME",
-			},
-			wantPayload: struct {
-				otelSemVarKey string
-				found         bool
-			}{
-				"service.name",
-				true,
-			},
+			name:      "get OTEL sem var key for SERVICE_NAME",
+			rawKey:    "SERVICE_NAME",
+			wantKeys:  []string{"service.name"},
+			wantFound: true,
 		},
 		{
-			name: "get OTEL sem var key for UNKNOWN (Not found)",
-			args: struct{ rawKey string }{
-				"UNKNOWN",
-			},
-			wantPayload: struct {
-				otelSemVarKey string
-				found         bool
-			}{
-				"",
-				false,
-			},
+			name:                "get OTEL sem var key along with the aliases, which are not emitted",
+			rawKey:              "DEPLOYMENT_ENVIRONMENT",
+			semanticConventions: config.SemanticConventions{Version: "1.27.0"},
+			wantKeys:            []string{"deployment.environment.name", "deployment.environment"},
+			wantFound:           true,
+		},
+		{
+			name:                "get OTEL sem var key of the mapping of the config",
+			rawKey:              "SERVICE_NAME",
+			semanticConventions: config.SemanticConventions{Mappings: []config.SemconvMapping{{Env: "SERVICE_NAME", Key: "app.name", Aliases: []string{"service.name"}}}},
+			wantKeys:            []string{"app.name", "service.name"},
+			wantFound:           true,
+		},
+		{
+			name:   "get OTEL sem var key for UNKNOWN (Not found)",
+			rawKey: "UNKNOWN",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			otelKey, found := getOTELSemVarKey(tt.args.rawKey)
-			if otelKey != tt.wantPayload.otelSemVarKey || found != tt.wantPayload.found {
-				t.Errorf("getOTELSemVarKey() returns otelSemVarKey = %v & found = %v, but expected is otelSemVarKey = %v & found = %v", otelKey, found, tt.wantPayload.otelSemVarKey, tt.wantPayload.found)
+			otelKeys, found := getOTELSemVarKeys(tt.rawKey, tt.semanticConventions)
+			if !reflect.DeepEqual(otelKeys, tt.wantKeys) || found != tt.wantFound {
+				t.Errorf("getOTELSemVarKeys() returns otelSemVarKeys = %v & found = %v, but expected is otelSemVarKeys = %v & found = %v", otelKeys, found, tt.wantKeys, tt.wantFound)
 				return
 			}
 		})
 	}
 }
 
+func TestGetContainerResourceEnv(t *testing.T) {
+	semconv127 := config.SemanticConventions{Version: "1.27.0"}
+
+	tests := []struct {
+		name                string
+		env                 []corev1.EnvVar
+		envName             string
+		semanticConventions config.SemanticConventions
+		want                corev1.EnvVar
+		wantFound           bool
+	}{
+		{
+			name:      "Env variable of the container",
+			env:       []corev1.EnvVar{{Name: DeploymentEnvironment, Value: "prod"}, {Name: OTELResourceAttributes, Value: "deployment.environment=qa"}},
+			envName:   DeploymentEnvironment,
+			want:      corev1.EnvVar{Name: DeploymentEnvironment, Value: "prod"},
+			wantFound: true,
+		},
+		{
+			name:                "Attribute of the configured semantic conventions version",
+			env:                 []corev1.EnvVar{{Name: OTELResourceAttributes, Value: "deployment.environment.name=prod"}},
+			envName:             DeploymentEnvironment,
+			semanticConventions: semconv127,
+			want:                corev1.EnvVar{Name: DeploymentEnvironment, Value: "prod"},
+			wantFound:           true,
+		},
+		{
+			name:                "Attribute of the alias key",
+			env:                 []corev1.EnvVar{{Name: OTELResourceAttributes, Value: "deployment.environment=qa"}},
+			envName:             DeploymentEnvironment,
+			semanticConventions: semconv127,
+			want:                corev1.EnvVar{Name: DeploymentEnvironment, Value: "qa"},
+			wantFound:           true,
+		},
+		{
+			name:                "Attribute of the current key takes precedence over the alias key",
+			env:                 []corev1.EnvVar{{Name: OTELResourceAttributes, Value: "deployment.environment=qa,deployment.environment.name=prod"}},
+			envName:             DeploymentEnvironment,
+			semanticConventions: semconv127,
+			want:                corev1.EnvVar{Name: DeploymentEnvironment, Value: "prod"},
+			wantFound:           true,
+		},
+		{
+			name:                "Attribute of the mapping of the config",
+			env:                 []corev1.EnvVar{{Name: OTELResourceAttributes, Value: "app.name=checkout"}},
+			envName:             ServiceName,
+			semanticConventions: config.SemanticConventions{Mappings: []config.SemconvMapping{{Env: ServiceName, Key: "app.name"}}},
+			want:                corev1.EnvVar{Name: ServiceName, Value: "checkout"},
+			wantFound:           true,
+		},
+		{
+			name:    "Attribute not specified",
+			env:     []corev1.EnvVar{{Name: OTELResourceAttributes, Value: "service.name=checkout"}},
+			envName: DeploymentEnvironment,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := getContainerResourceEnv(corev1.Container{Name: "my-app", Env: tt.env}, tt.envName, tt.semanticConventions)
+			if !reflect.DeepEqual(got, tt.want) || found != tt.wantFound {
+				t.Errorf("getContainerResourceEnv() = %v, %v, but expected = %v, %v", got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
 func TestRunMutations(t *testing.T) {
 	tests := []struct {
 		name string
@@ -2070,3 +2136,1802 @@ func TestRunMutations(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderEnvTemplate(t *testing.T) {
+	k8sClient, err := config.NewK8sClient(nil, func(r *rest.Config) (kubernetes.Interface, error) {
+		return testclient.NewSimpleClientset(
+			&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default", Labels: map[string]string{"env": "production"}}},
+		), nil
+	})
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+
+	params := &Params{
+		Client:    k8sClient,
+		Log:       logger,
+		Namespace: "default",
+		Pod: &corev1.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: "test-pod", Labels: map[string]string{"app-name": "test-app"}},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "my-app", Image: "registry.local:5000/team/my-app:v1.2.3@sha256:abcd"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		env         corev1.EnvVar
+		wantErr     bool
+		wantPayload string
+	}{
+		{
+			name:        "Render static value",
+			env:         corev1.EnvVar{Name: "COMPANY_NAME", Value: "ABC Corporation"},
+			wantPayload: "ABC Corporation",
+		},
+		{
+			name:        "Render container image tag",
+			env:         corev1.EnvVar{Name: "SERVICE_VERSION", Value: "{{ .Container.ImageTag }}"},
+			wantPayload: "v1.2.3",
+		},
+		{
+			name:        "Render namespace label",
+			env:         corev1.EnvVar{Name: "DEPLOYMENT_ENVIRONMENT", Value: `{{ index .Namespace.Labels "env" }}`},
+			wantPayload: "production",
+		},
+		{
+			name:        "Render missing namespace label with default",
+			env:         corev1.EnvVar{Name: "TEAM", Value: `{{ index .Namespace.Labels "team" | default "unknown" }}`},
+			wantPayload: "unknown",
+		},
+		{
+			name:        "Render pod metadata and workload",
+			env:         corev1.EnvVar{Name: "APP", Value: `{{ index .Pod.Labels "app-name" }}/{{ .Workload.Name }}/{{ .Container.ImageName }}`},
+			wantPayload: "test-app/test-pod/registry.local:5000/team/my-app",
+		},
+		{
+			name:    "Render template with execution error",
+			env:     corev1.EnvVar{Name: "APP", Value: `{{ index .Container.Name 100 }}`},
+			wantErr: true,
+		},
+		{
+			name:    "Render template exceeding the output size",
+			env:     corev1.EnvVar{Name: "APP", Value: `{{ .Pod.Name }}` + strings.Repeat("x", envTemplateMaxOutputSize)},
+			wantErr: true,
+		},
+		{
+			name:    "Render template invoking itself",
+			env:     corev1.EnvVar{Name: "APP", Value: `{{ define "loop" }}{{ template "loop" . }}{{ end }}{{ template "loop" . }}`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := newEnvTemplateRenderer(params, &podLookups{params: params})
+			env, err := renderer.render(context.Background(), tt.env, params.Pod.Spec.Containers[0])
+			if err == nil && tt.wantErr {
+				t.Errorf("render() returned nil, instead of error")
+			}
+			if err != nil && !tt.wantErr {
+				t.Errorf("render() returned an unexpected error: %+v", err)
+			}
+			if !tt.wantErr && env.Value != tt.wantPayload {
+				t.Errorf("render() returned value = %s, but expected value = %s", env.Value, tt.wantPayload)
+			}
+		})
+	}
+}
+
+func TestParseImage(t *testing.T) {
+	tests := []struct {
+		image         string
+		wantImageName string
+		wantImageTag  string
+	}{
+		{image: "nginx", wantImageName: "nginx", wantImageTag: ""},
+		{image: "nginx:1.21", wantImageName: "nginx", wantImageTag: "1.21"},
+		{image: "registry.local:5000/team/app", wantImageName: "registry.local:5000/team/app", wantImageTag: ""},
+		{image: "registry.local:5000/team/app:v2@sha256:abcd", wantImageName: "registry.local:5000/team/app", wantImageTag: "v2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			imageName, imageTag := parseImage(tt.image)
+			if imageName != tt.wantImageName || imageTag != tt.wantImageTag {
+				t.Errorf("parseImage() returned = (%s, %s), but expected = (%s, %s)", imageName, imageTag, tt.wantImageName, tt.wantImageTag)
+			}
+		})
+	}
+}
+
+func TestWhenEvaluate(t *testing.T) {
+	k8sClient, err := config.NewK8sClient(nil, func(r *rest.Config) (kubernetes.Interface, error) {
+		return testclient.NewSimpleClientset(
+			&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default", Labels: map[string]string{"env": "production"}}},
+		), nil
+	})
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+
+	tests := []struct {
+		name        string
+		pod         *corev1.Pod
+		expression  string
+		wantPayload bool
+	}{
+		{
+			name:        "Evaluate empty expression",
+			pod:         &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "test-pod"}},
+			expression:  "",
+			wantPayload: true,
+		},
+		{
+			name:        "Evaluate label expression on matching pod",
+			pod:         &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "test-pod", Labels: map[string]string{"tier": "frontend"}}},
+			expression:  "pod.metadata.labels.tier == 'frontend'",
+			wantPayload: true,
+		},
+		{
+			name:        "Evaluate label expression on non matching pod",
+			pod:         &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "test-pod", Labels: map[string]string{"tier": "backend"}}},
+			expression:  "pod.metadata.labels.tier == 'frontend'",
+			wantPayload: false,
+		},
+		{
+			name:        "Evaluate label expression on pod without label",
+			pod:         &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "test-pod"}},
+			expression:  "pod.metadata.labels.tier == 'frontend'",
+			wantPayload: false,
+		},
+		{
+			name:        "Evaluate namespace and owner expression",
+			pod:         &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "test-pod", OwnerReferences: []v1.OwnerReference{{Name: "hello-replicaSet", Kind: "ReplicaSet"}}}},
+			expression:  "namespaceObject.metadata.labels.env == 'production' && owner.kind == 'ReplicaSet'",
+			wantPayload: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &Params{Client: k8sClient, Log: logger, Namespace: "default", Pod: tt.pod}
+			evaluator := newWhenEvaluator(params, &podLookups{params: params})
+			if result := evaluator.evaluate(context.Background(), tt.expression); result != tt.wantPayload {
+				t.Errorf("evaluate() returned = %v, but expected = %v", result, tt.wantPayload)
+			}
+		})
+	}
+}
+
+func TestMutateEnvVariablesWithWhenExpression(t *testing.T) {
+	k8sClient, err := getFakeK8sClient()
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+
+	lmConfig := config.Config{
+		MutationConfigProvided: true,
+		MutationConfig: config.MutationConfig{LMEnvVars: config.LMEnvVars{Operation: []config.OperationEnv{
+			{Env: corev1.EnvVar{Name: "OTEL_TRACES_SAMPLER_ARG", Value: "0.1"}, When: "pod.metadata.labels.tier == 'frontend'"},
+		}}},
+	}
+
+	for tier, wantInjected := range map[string]bool{"frontend": true, "backend": false} {
+		t.Run(tier, func(t *testing.T) {
+			params := &Params{
+				Client:    k8sClient,
+				LMConfig:  lmConfig,
+				Log:       logger,
+				Namespace: "default",
+				Pod: &corev1.Pod{
+					ObjectMeta: v1.ObjectMeta{Name: "test-pod", Labels: map[string]string{"tier": tier}},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "my-app"}}},
+				},
+			}
+			if err := mutateEnvVariables(context.Background(), params); err != nil {
+				t.Errorf("mutateEnvVariables() returned an unexpected error: %+v", err)
+				return
+			}
+			injected := getIndexOfEnv(params.Pod.Spec.Containers[0].Env, "OTEL_TRACES_SAMPLER_ARG") > -1
+			if injected != wantInjected {
+				t.Errorf("mutateEnvVariables() injected OTEL_TRACES_SAMPLER_ARG = %v, but expected = %v", injected, wantInjected)
+			}
+		})
+	}
+}
+
+func TestMergeNewEnvWithMergeStrategies(t *testing.T) {
+	fieldRef := &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}
+
+	tests := []struct {
+		name         string
+		original     corev1.EnvVar
+		new          corev1.EnvVar
+		mergeOption  envMergeOption
+		wantPayload  corev1.EnvVar
+		wantWarnings int
+	}{
+		{
+			name:        "Replace strategy",
+			original:    corev1.EnvVar{Name: "OTEL_EXPORTER_OTLP_ENDPOINT", Value: "http://localhost:4317"},
+			new:         corev1.EnvVar{Name: "OTEL_EXPORTER_OTLP_ENDPOINT", Value: "http://lmotel-svc:4317"},
+			mergeOption: envMergeOption{strategy: config.MergeStrategyReplace},
+			wantPayload: corev1.EnvVar{Name: "OTEL_EXPORTER_OTLP_ENDPOINT", Value: "http://lmotel-svc:4317"},
+		},
+		{
+			name:        "KeepExisting strategy",
+			original:    corev1.EnvVar{Name: "OTEL_EXPORTER_OTLP_ENDPOINT", Value: "http://localhost:4317"},
+			new:         corev1.EnvVar{Name: "OTEL_EXPORTER_OTLP_ENDPOINT", Value: "http://lmotel-svc:4317"},
+			mergeOption: envMergeOption{strategy: config.MergeStrategyKeepExisting},
+			wantPayload: corev1.EnvVar{Name: "OTEL_EXPORTER_OTLP_ENDPOINT", Value: "http://localhost:4317"},
+		},
+		{
+			name:        "Append strategy with default separator",
+			original:    corev1.EnvVar{Name: "JAVA_TOOL_OPTIONS", Value: "-Xmx512m"},
+			new:         corev1.EnvVar{Name: "JAVA_TOOL_OPTIONS", Value: "-javaagent:/otel/opentelemetry-javaagent.jar"},
+			mergeOption: envMergeOption{strategy: config.MergeStrategyAppend},
+			wantPayload: corev1.EnvVar{Name: "JAVA_TOOL_OPTIONS", Value: "-Xmx512m -javaagent:/otel/opentelemetry-javaagent.jar"},
+		},
+		{
+			name:        "Append strategy when value is already present",
+			original:    corev1.EnvVar{Name: "JAVA_TOOL_OPTIONS", Value: "-javaagent:/otel/opentelemetry-javaagent.jar -Xmx512m"},
+			new:         corev1.EnvVar{Name: "JAVA_TOOL_OPTIONS", Value: "-javaagent:/otel/opentelemetry-javaagent.jar"},
+			mergeOption: envMergeOption{strategy: config.MergeStrategyAppend},
+			wantPayload: corev1.EnvVar{Name: "JAVA_TOOL_OPTIONS", Value: "-javaagent:/otel/opentelemetry-javaagent.jar -Xmx512m"},
+		},
+		{
+			name:        "Prepend strategy with custom separator",
+			original:    corev1.EnvVar{Name: "PYTHONPATH", Value: "/app/lib"},
+			new:         corev1.EnvVar{Name: "PYTHONPATH", Value: "/otel-auto-instrumentation"},
+			mergeOption: envMergeOption{strategy: config.MergeStrategyPrepend, separator: ":"},
+			wantPayload: corev1.EnvVar{Name: "PYTHONPATH", Value: "/otel-auto-instrumentation:/app/lib"},
+		},
+		{
+			name:        "Prepend strategy with empty existing value",
+			original:    corev1.EnvVar{Name: "NODE_OPTIONS", Value: ""},
+			new:         corev1.EnvVar{Name: "NODE_OPTIONS", Value: "--require /otel/autoinstrumentation.js"},
+			mergeOption: envMergeOption{strategy: config.MergeStrategyPrepend},
+			wantPayload: corev1.EnvVar{Name: "NODE_OPTIONS", Value: "--require /otel/autoinstrumentation.js"},
+		},
+		{
+			name:        "MergeKeyValue strategy",
+			original:    corev1.EnvVar{Name: "OTEL_PROPAGATORS_CONFIG", Value: "a=1,b=2"},
+			new:         corev1.EnvVar{Name: "OTEL_PROPAGATORS_CONFIG", Value: "b=3,c=4"},
+			mergeOption: envMergeOption{strategy: config.MergeStrategyMergeKeyValue},
+			wantPayload: corev1.EnvVar{Name: "OTEL_PROPAGATORS_CONFIG", Value: "b=3,c=4,a=1"},
+		},
+		{
+			name:        "MergeKeyValue strategy with custom separator",
+			original:    corev1.EnvVar{Name: "LABELS", Value: "a=1;b=2"},
+			new:         corev1.EnvVar{Name: "LABELS", Value: "a=5"},
+			mergeOption: envMergeOption{strategy: config.MergeStrategyMergeKeyValue, separator: ";"},
+			wantPayload: corev1.EnvVar{Name: "LABELS", Value: "a=5;b=2"},
+		},
+		{
+			name:         "Append strategy with valueFrom keeps the existing env variable",
+			original:     corev1.EnvVar{Name: "JAVA_TOOL_OPTIONS", ValueFrom: fieldRef},
+			new:          corev1.EnvVar{Name: "JAVA_TOOL_OPTIONS", Value: "-javaagent:/otel/opentelemetry-javaagent.jar"},
+			mergeOption:  envMergeOption{strategy: config.MergeStrategyAppend},
+			wantPayload:  corev1.EnvVar{Name: "JAVA_TOOL_OPTIONS", ValueFrom: fieldRef},
+			wantWarnings: 1,
+		},
+		{
+			name:         "Replace strategy with valueFrom replaces the existing env variable",
+			original:     corev1.EnvVar{Name: "APP_NAME", ValueFrom: fieldRef},
+			new:          corev1.EnvVar{Name: "APP_NAME", Value: "demo"},
+			mergeOption:  envMergeOption{strategy: config.MergeStrategyReplace},
+			wantPayload:  corev1.EnvVar{Name: "APP_NAME", Value: "demo"},
+			wantWarnings: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mergedEnvVars, warnings, err := mergeNewEnv(context.Background(), []corev1.EnvVar{tt.original}, []corev1.EnvVar{tt.new}, map[string]envMergeOption{tt.new.Name: tt.mergeOption})
+			if err != nil {
+				t.Errorf("mergeNewEnv() returned an unexpected error: %+v", err)
+				return
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("mergeNewEnv() returned %d warnings, but expected = %d", len(warnings), tt.wantWarnings)
+			}
+			if len(mergedEnvVars) != 1 {
+				t.Errorf("mergeNewEnv() returned %d number of env variables, but expected env number of env variables = %d", len(mergedEnvVars), 1)
+				return
+			}
+			if !cmp.Equal(mergedEnvVars[0], tt.wantPayload) {
+				t.Errorf("mergeNewEnv() returned env variable = %v, but expected = %v", mergedEnvVars[0], tt.wantPayload)
+			}
+		})
+	}
+}
+
+// fakeSecretCopier returns the source secret of the allowed copies and records the requested copies
+type fakeSecretCopier struct {
+	allowed   bool
+	requested []string
+}
+
+func (f *fakeSecretCopier) CopySecret(ctx context.Context, namespace string, name string, dryRun bool) (*corev1.Secret, error) {
+	if !f.allowed {
+		return nil, fmt.Errorf("secret %s is not allowed to be copied into namespace %s", name, namespace)
+	}
+	if !dryRun {
+		f.requested = append(f.requested, namespace+"/"+name)
+	}
+	return &corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "lm-webhook"}, Data: map[string][]byte{"token": []byte("abc")}}, nil
+}
+
+func TestMutateEnvVariablesWithEnvSources(t *testing.T) {
+	secretKeyRef := func(name string) corev1.EnvVar {
+		return corev1.EnvVar{Name: "LM_BEARER_TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: "token"}}}
+	}
+
+	tests := []struct {
+		name              string
+		lmEnvVars         config.LMEnvVars
+		secretCopier      *fakeSecretCopier
+		dryRun            bool
+		wantEnv           bool
+		wantEnvFrom       int
+		wantWarnings      int
+		wantCopyRequested bool
+	}{
+		{
+			name:      "Inject secretKeyRef present in pod namespace",
+			lmEnvVars: config.LMEnvVars{Operation: []config.OperationEnv{{Env: secretKeyRef("lm-creds")}}},
+			wantEnv:   true,
+		},
+		{
+			name:         "Skip secretKeyRef missing in pod namespace",
+			lmEnvVars:    config.LMEnvVars{Operation: []config.OperationEnv{{Env: secretKeyRef("lm-source-creds")}}},
+			wantEnv:      false,
+			wantWarnings: 1,
+		},
+		{
+			name:              "Request the copy of the secret from webhook namespace",
+			lmEnvVars:         config.LMEnvVars{Operation: []config.OperationEnv{{Env: secretKeyRef("lm-source-creds"), CopyFromWebhookNamespace: true}}},
+			secretCopier:      &fakeSecretCopier{allowed: true},
+			wantEnv:           true,
+			wantCopyRequested: true,
+		},
+		{
+			name:              "Do not request the copy of the secret for dry run",
+			lmEnvVars:         config.LMEnvVars{Operation: []config.OperationEnv{{Env: secretKeyRef("lm-source-creds"), CopyFromWebhookNamespace: true}}},
+			secretCopier:      &fakeSecretCopier{allowed: true},
+			dryRun:            true,
+			wantEnv:           true,
+			wantCopyRequested: false,
+		},
+		{
+			name:         "Skip secretKeyRef not allowed to be copied",
+			lmEnvVars:    config.LMEnvVars{Operation: []config.OperationEnv{{Env: secretKeyRef("lm-source-creds"), CopyFromWebhookNamespace: true}}},
+			secretCopier: &fakeSecretCopier{allowed: false},
+			wantEnv:      false,
+			wantWarnings: 1,
+		},
+		{
+			name:         "Skip secretKeyRef if copying is not enabled",
+			lmEnvVars:    config.LMEnvVars{Operation: []config.OperationEnv{{Env: secretKeyRef("lm-source-creds"), CopyFromWebhookNamespace: true}}},
+			wantEnv:      false,
+			wantWarnings: 1,
+		},
+		{
+			name: "Inject envFrom config map and skip missing secret",
+			lmEnvVars: config.LMEnvVars{EnvFrom: []config.EnvFromSource{
+				{EnvFromSource: corev1.EnvFromSource{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "lm-otel-config"}}}},
+				{EnvFromSource: corev1.EnvFromSource{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}}}},
+			}},
+			wantEnvFrom:  1,
+			wantWarnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k8sClient, err := config.NewK8sClient(nil, func(r *rest.Config) (kubernetes.Interface, error) {
+				return testclient.NewSimpleClientset(
+					&corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: "lm-creds", Namespace: "default"}, Data: map[string][]byte{"token": []byte("abc")}},
+					&corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: "lm-source-creds", Namespace: "lm-webhook"}, Data: map[string][]byte{"token": []byte("abc")}},
+					&corev1.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "lm-otel-config", Namespace: "default"}, Data: map[string]string{"OTEL_TRACES_SAMPLER": "always_on"}},
+				), nil
+			})
+			if err != nil {
+				t.Errorf("Error occured in getting fake k8s client: %v", err)
+				return
+			}
+			params := &Params{
+				Client:    k8sClient,
+				LMConfig:  config.Config{MutationConfigProvided: true, MutationConfig: config.MutationConfig{LMEnvVars: tt.lmEnvVars}},
+				Log:       logger,
+				Namespace: "default",
+				DryRun:    tt.dryRun,
+				Pod: &corev1.Pod{
+					ObjectMeta: v1.ObjectMeta{Name: "test-pod"},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "my-app"}}},
+				},
+			}
+			if tt.secretCopier != nil {
+				params.SecretCopier = tt.secretCopier
+			}
+			if err := mutateEnvVariables(context.Background(), params); err != nil {
+				t.Errorf("mutateEnvVariables() returned an unexpected error: %+v", err)
+				return
+			}
+
+			container := params.Pod.Spec.Containers[0]
+			if injected := getIndexOfEnv(container.Env, "LM_BEARER_TOKEN") > -1; injected != tt.wantEnv {
+				t.Errorf("mutateEnvVariables() injected LM_BEARER_TOKEN = %v, but expected = %v", injected, tt.wantEnv)
+			}
+			if len(container.EnvFrom) != tt.wantEnvFrom {
+				t.Errorf("mutateEnvVariables() injected %d envFrom sources, but expected = %d", len(container.EnvFrom), tt.wantEnvFrom)
+			}
+			if len(params.Warnings) != tt.wantWarnings {
+				t.Errorf("mutateEnvVariables() returned %d warnings, but expected = %d", len(params.Warnings), tt.wantWarnings)
+			}
+			if requested := tt.secretCopier != nil && len(tt.secretCopier.requested) > 0; requested != tt.wantCopyRequested {
+				t.Errorf("mutateEnvVariables() requested the secret copy = %v, but expected = %v", requested, tt.wantCopyRequested)
+			}
+			// Secrets are never copied in the admission path
+			if _, err := k8sClient.Clientset.CoreV1().Secrets("default").Get(context.Background(), "lm-source-creds", v1.GetOptions{}); err == nil {
+				t.Errorf("mutateEnvVariables() copied the secret in the admission path")
+			}
+		})
+	}
+}
+
+func TestMutateEnvVariablesWithNamespaceAttributes(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: v1.ObjectMeta{
+		Name:        "payments",
+		Labels:      map[string]string{"team.example.com/service-namespace": "checkout"},
+		Annotations: map[string]string{"example.com/environment": "production"},
+	}}
+	namespaceAttributes := config.NamespaceAttributes{
+		ServiceNamespace:      config.NamespaceAttributeSource{Label: "team.example.com/service-namespace"},
+		DeploymentEnvironment: config.NamespaceAttributeSource{Label: "example.com/environment", Annotation: "example.com/environment"},
+	}
+	podLabelServiceNamespace := corev1.EnvVar{Name: ServiceNamespace, ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels['app-namespace']"}}}
+
+	tests := []struct {
+		name                      string
+		objects                   []runtime.Object
+		resourceEnv               []config.ResourceEnv
+		useInformer               bool
+		wantServiceNamespace      corev1.EnvVar
+		wantDeploymentEnvironment string
+	}{
+		{
+			name:                      "Values from namespace label and annotation",
+			objects:                   []runtime.Object{namespace},
+			wantServiceNamespace:      corev1.EnvVar{Name: ServiceNamespace, Value: "checkout"},
+			wantDeploymentEnvironment: "production",
+		},
+		{
+			name:                      "Values from namespace using informer",
+			objects:                   []runtime.Object{namespace},
+			useInformer:               true,
+			wantServiceNamespace:      corev1.EnvVar{Name: ServiceNamespace, Value: "checkout"},
+			wantDeploymentEnvironment: "production",
+		},
+		{
+			name:                      "Namespace label takes precedence over pod label",
+			objects:                   []runtime.Object{namespace},
+			resourceEnv:               []config.ResourceEnv{{Env: podLabelServiceNamespace}},
+			wantServiceNamespace:      corev1.EnvVar{Name: ServiceNamespace, Value: "checkout"},
+			wantDeploymentEnvironment: "production",
+		},
+		{
+			name:                 "Pod label is the fallback if namespace is not labeled",
+			objects:              []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "payments"}}},
+			resourceEnv:          []config.ResourceEnv{{Env: podLabelServiceNamespace}},
+			wantServiceNamespace: podLabelServiceNamespace,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k8sClient, err := config.NewK8sClient(nil, func(r *rest.Config) (kubernetes.Interface, error) {
+				return testclient.NewSimpleClientset(tt.objects...), nil
+			})
+			if err != nil {
+				t.Errorf("Error occured in getting fake k8s client: %v", err)
+				return
+			}
+			if tt.useInformer {
+				stopCh := make(chan struct{})
+				defer close(stopCh)
+				if err := k8sClient.StartNamespaceInformer(stopCh); err != nil {
+					t.Errorf("StartNamespaceInformer() returned an unexpected error: %+v", err)
+					return
+				}
+			}
+			params := &Params{
+				Client: k8sClient,
+				LMConfig: config.Config{
+					MutationConfigProvided: true,
+					MutationConfig: config.MutationConfig{
+						LMEnvVars:           config.LMEnvVars{Resource: tt.resourceEnv},
+						NamespaceAttributes: namespaceAttributes,
+					},
+				},
+				Log:       logger,
+				Namespace: "payments",
+				Pod: &corev1.Pod{
+					ObjectMeta: v1.ObjectMeta{Name: "test-pod", Labels: map[string]string{"app-namespace": "billing"}},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "my-app"}}},
+				},
+			}
+			if err := mutateEnvVariables(context.Background(), params); err != nil {
+				t.Errorf("mutateEnvVariables() returned an unexpected error: %+v", err)
+				return
+			}
+			envVars := params.Pod.Spec.Containers[0].Env
+
+			idx := getIndexOfEnv(envVars, ServiceNamespace)
+			if idx < 0 || !reflect.DeepEqual(envVars[idx], tt.wantServiceNamespace) {
+				t.Errorf("mutateEnvVariables() SERVICE_NAMESPACE = %+v, but expected = %+v", envVars, tt.wantServiceNamespace)
+			}
+
+			var deploymentEnvironment string
+			if idx := getIndexOfEnv(envVars, DeploymentEnvironment); idx > -1 {
+				deploymentEnvironment = envVars[idx].Value
+			}
+			if deploymentEnvironment != tt.wantDeploymentEnvironment {
+				t.Errorf("mutateEnvVariables() DEPLOYMENT_ENVIRONMENT = %s, but expected = %s", deploymentEnvironment, tt.wantDeploymentEnvironment)
+			}
+			otelResAttrs := envVars[getIndexOfEnv(envVars, OTELResourceAttributes)].Value
+			if hasAttr := strings.Contains(otelResAttrs, "deployment.environment=$(DEPLOYMENT_ENVIRONMENT)"); hasAttr != (tt.wantDeploymentEnvironment != "") {
+				t.Errorf("mutateEnvVariables() OTEL_RESOURCE_ATTRIBUTES = %s, deployment.environment expected = %v", otelResAttrs, tt.wantDeploymentEnvironment != "")
+			}
+		})
+	}
+}
+
+func TestMutateEnvVariablesWithServiceVersion(t *testing.T) {
+	k8sClient, err := getFakeK8sClient()
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+	allSources := []config.ServiceVersionSource{
+		{Type: config.ServiceVersionSourceLabel, Name: "app.kubernetes.io/version"},
+		{Type: config.ServiceVersionSourceAnnotation, Name: "example.com/version"},
+		{Type: config.ServiceVersionSourceImageTag},
+		{Type: config.ServiceVersionSourceImageDigest},
+	}
+
+	tests := []struct {
+		name               string
+		serviceVersion     config.ServiceVersion
+		profiles           map[string]config.Profile
+		labels             map[string]string
+		annotations        map[string]string
+		container          corev1.Container
+		wantServiceVersion string
+	}{
+		{
+			name:               "Version from pod label",
+			serviceVersion:     config.ServiceVersion{Sources: allSources},
+			labels:             map[string]string{"app.kubernetes.io/version": "1.4.0"},
+			annotations:        map[string]string{"example.com/version": "1.3.0"},
+			container:          corev1.Container{Name: "my-app", Image: "registry.local/team/app:v1.2"},
+			wantServiceVersion: "1.4.0",
+		},
+		{
+			name:               "Version from pod annotation",
+			serviceVersion:     config.ServiceVersion{Sources: allSources},
+			annotations:        map[string]string{"example.com/version": "1.3.0"},
+			container:          corev1.Container{Name: "my-app", Image: "registry.local/team/app:v1.2"},
+			wantServiceVersion: "1.3.0",
+		},
+		{
+			name:               "Version from image tag",
+			serviceVersion:     config.ServiceVersion{Sources: allSources},
+			container:          corev1.Container{Name: "my-app", Image: "registry.local:5000/team/app:v1.2"},
+			wantServiceVersion: "v1.2",
+		},
+		{
+			name:               "Version from image digest",
+			serviceVersion:     config.ServiceVersion{Sources: allSources},
+			container:          corev1.Container{Name: "my-app", Image: "registry.local/team/app@sha256:0d5a3c"},
+			wantServiceVersion: "sha256:0d5a3c",
+		},
+		{
+			name:               "Version from container env",
+			serviceVersion:     config.ServiceVersion{Sources: allSources},
+			container:          corev1.Container{Name: "my-app", Image: "registry.local/team/app:v1.2", Env: []corev1.EnvVar{{Name: ServiceVersion, Value: "2.0.0"}}},
+			wantServiceVersion: "2.0.0",
+		},
+		{
+			name:           "Version derivation disabled",
+			serviceVersion: config.ServiceVersion{Disabled: true, Sources: allSources},
+			container:      corev1.Container{Name: "my-app", Image: "registry.local/team/app:v1.2"},
+		},
+		{
+			name:           "Version derivation disabled by the profile",
+			serviceVersion: config.ServiceVersion{Sources: allSources},
+			profiles:       map[string]config.Profile{"no-version": {ServiceVersion: &config.ServiceVersion{Disabled: true}}},
+			annotations:    map[string]string{ProfileAnnotation: "no-version"},
+			container:      corev1.Container{Name: "my-app", Image: "registry.local/team/app:v1.2"},
+		},
+		{
+			name:           "No source has a value",
+			serviceVersion: config.ServiceVersion{Sources: allSources},
+			container:      corev1.Container{Name: "my-app", Image: "registry.local/team/app"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &Params{
+				Client: k8sClient,
+				LMConfig: config.Config{
+					MutationConfigProvided: true,
+					MutationConfig:         config.MutationConfig{ServiceVersion: tt.serviceVersion, Profiles: tt.profiles},
+				},
+				Log:       logger,
+				Namespace: "default",
+				Pod: &corev1.Pod{
+					ObjectMeta: v1.ObjectMeta{Name: "test-pod", Labels: tt.labels, Annotations: tt.annotations},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{tt.container}},
+				},
+			}
+			if err := mutateEnvVariables(context.Background(), params); err != nil {
+				t.Errorf("mutateEnvVariables() returned an unexpected error: %+v", err)
+				return
+			}
+			envVars := params.Pod.Spec.Containers[0].Env
+
+			var serviceVersion string
+			if idx := getIndexOfEnv(envVars, ServiceVersion); idx > -1 {
+				serviceVersion = envVars[idx].Value
+			}
+			if serviceVersion != tt.wantServiceVersion {
+				t.Errorf("mutateEnvVariables() SERVICE_VERSION = %s, but expected = %s", serviceVersion, tt.wantServiceVersion)
+			}
+			otelResAttrs := envVars[getIndexOfEnv(envVars, OTELResourceAttributes)].Value
+			if hasAttr := strings.Contains(otelResAttrs, "service.version=$(SERVICE_VERSION)"); hasAttr != (tt.wantServiceVersion != "") {
+				t.Errorf("mutateEnvVariables() OTEL_RESOURCE_ATTRIBUTES = %s, service.version expected = %v", otelResAttrs, tt.wantServiceVersion != "")
+			}
+		})
+	}
+}
+
+func TestAddMappedAttributesToOtelResAttribute(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{
+		Labels: map[string]string{
+			"team/owner":                "payments",
+			"team/cost-center":          "cc-42",
+			"team/secret":               "hidden",
+			"app.kubernetes.io/name":    "checkout",
+			"app.kubernetes.io/version": "1.4.0",
+			"pod-template-hash":         "6d4cf56db6",
+		},
+		Annotations: map[string]string{
+			"resource.opentelemetry.io/team.slack":   "#payments, #oncall",
+			"resource.opentelemetry.io/service.name": "overridden",
+			"kubectl.kubernetes.io/last-applied":     "{}",
+		},
+	}}
+	baseAttrs := "host.name=$(LM_APM_POD_NAME),service.name=$(SERVICE_NAME)"
+
+	tests := []struct {
+		name     string
+		mappings []config.AttributeMapping
+		want     string
+	}{
+		{
+			name: "Map labels matching prefixes with deny",
+			mappings: []config.AttributeMapping{{
+				Source:          config.AttributeMappingSourceLabel,
+				Allow:           []string{"^team/", "^app\\.kubernetes\\.io/"},
+				Deny:            []string{"^team/secret$"},
+				AttributePrefix: "k8s.pod.label.",
+			}},
+			want: baseAttrs + ",k8s.pod.label.app.kubernetes.io/name=checkout,k8s.pod.label.app.kubernetes.io/version=1.4.0,k8s.pod.label.team/cost-center=cc-42,k8s.pod.label.team/owner=payments",
+		},
+		{
+			name: "Map annotations with key rewriting, existing attributes are not overridden",
+			mappings: []config.AttributeMapping{{
+				Source:  config.AttributeMappingSourceAnnotation,
+				Allow:   []string{"^resource\\.opentelemetry\\.io/"},
+				Rewrite: &config.KeyRewrite{Match: "^resource\\.opentelemetry\\.io/(.*)$", Replacement: "$1"},
+			}},
+			want: baseAttrs + ",team.slack=#payments%2C%20#oncall",
+		},
+		{
+			name: "Cap the number of attributes",
+			mappings: []config.AttributeMapping{{
+				Source:          config.AttributeMappingSourceLabel,
+				Allow:           []string{"^team/"},
+				AttributePrefix: "k8s.pod.label.",
+				MaxAttributes:   2,
+			}},
+			want: baseAttrs + ",k8s.pod.label.team/cost-center=cc-42,k8s.pod.label.team/owner=payments",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newEnvVars := []corev1.EnvVar{{Name: OTELResourceAttributes, Value: baseAttrs}}
+			got := addMappedAttributesToOtelResAttribute(context.Background(), pod, newEnvVars, tt.mappings)
+			if got[0].Value != tt.want {
+				t.Errorf("addMappedAttributesToOtelResAttribute() = %s, but expected = %s", got[0].Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDefaultAttributesUsesSemconvKey(t *testing.T) {
+	semanticConventions := config.SemanticConventions{
+		EmitAliases: true,
+		Mappings:    []config.SemconvMapping{{Env: ServiceNamespace, Key: "service.ns", Aliases: []string{"service.namespace"}}},
+	}
+
+	res := getDefaultAttributes(context.Background(), config.DefaultAttributes{}, semanticConventions)
+
+	for _, key := range []string{"service.ns", "service.namespace"} {
+		if res[key] != "$(SERVICE_NAMESPACE)" {
+			t.Errorf("getDefaultAttributes() = %v, but expected %s = $(SERVICE_NAMESPACE)", res, key)
+		}
+	}
+}
+
+func TestGetLmotelEnvironmentVariablesWithDefaultAttributes(t *testing.T) {
+	defaultAttributesConfig := config.DefaultAttributes{
+		Rename: map[string]string{"host.name": "k8s.pod.name"},
+		Drop:   []string{"resource.type", "ip", "k8s.pod.uid"},
+		Add:    []config.Attribute{{Key: "k8s.pod.ip", Value: "$(LM_APM_POD_IP)"}, {Key: "cloud.platform", Value: "gcp_kubernetes_engine"}},
+	}
+
+	lmotelEnvVars := getLmotelEnvironmentVariables(context.Background(), defaultAttributesConfig, config.SemanticConventions{})
+
+	wantAttrs := "cloud.platform=gcp_kubernetes_engine,k8s.cluster.name=$(LM_APM_CLUSTER_NAME),k8s.namespace.name=$(LM_APM_POD_NAMESPACE),k8s.node.name=$(LM_APM_NODE_NAME),k8s.pod.ip=$(LM_APM_POD_IP),k8s.pod.name=$(LM_APM_POD_NAME),service.namespace=$(SERVICE_NAMESPACE)"
+	if idx := getIndexOfEnv(lmotelEnvVars, OTELResourceAttributes); idx < 0 || lmotelEnvVars[idx].Value != wantAttrs {
+		t.Errorf("getLmotelEnvironmentVariables() OTEL_RESOURCE_ATTRIBUTES = %+v, but expected = %s", lmotelEnvVars, wantAttrs)
+	}
+
+	// LM_APM_POD_UID is not referred by any attribute anymore, but it is still injected and protected by the skip list,
+	// as the container, profile or config env variables may refer it
+	for _, name := range []string{LMAPMPodUID, LMAPMPodIP, LMAPMPodName, ServiceNamespace} {
+		if getIndexOfEnv(lmotelEnvVars, name) < 0 {
+			t.Errorf("getLmotelEnvironmentVariables() = %+v, but expected %s to be injected", lmotelEnvVars, name)
+		}
+	}
+	managedSkipList := getSkipList(lmotelEnvVars)
+	if !isResourceEnvVarToBeSkipped(managedSkipList, corev1.EnvVar{Name: LMAPMPodUID}, logger) {
+		t.Errorf("getSkipList() = %v, %s is expected to be skipped", managedSkipList, LMAPMPodUID)
+	}
+}
+
+func TestMutateEnvVariablesWithNodeLocalCollector(t *testing.T) {
+	k8sClient, err := getFakeK8sClient()
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+	centralEndpoint := config.OperationEnv{Env: corev1.EnvVar{Name: OTELExporterOTLPEndpoint, Value: "http://lmotel-svc:4317"}}
+
+	tests := []struct {
+		name          string
+		collector     config.Collector
+		containerEnv  []corev1.EnvVar
+		wantEndpoints map[string]string
+		wantHostIP    bool
+	}{
+		{
+			name:      "Central service mode",
+			collector: config.Collector{Mode: config.CollectorModeService},
+			wantEndpoints: map[string]string{
+				OTELExporterOTLPEndpoint:       "http://lmotel-svc:4317",
+				OTELExporterOTLPTracesEndpoint: "",
+			},
+		},
+		{
+			name:      "Node-local mode with grpc",
+			collector: config.Collector{Mode: config.CollectorModeNodeLocal},
+			wantEndpoints: map[string]string{
+				OTELExporterOTLPEndpoint:       "http://$(LM_APM_HOST_IP):4317",
+				OTELExporterOTLPTracesEndpoint: "http://$(LM_APM_HOST_IP):4317",
+				OTELExporterOTLPProtocol:       "grpc",
+			},
+			wantHostIP: true,
+		},
+		{
+			name:      "Node-local mode with http/protobuf and custom port",
+			collector: config.Collector{Mode: config.CollectorModeNodeLocal, Protocol: config.OTLPProtocolHTTPProtobuf, HTTPPort: 14318},
+			wantEndpoints: map[string]string{
+				OTELExporterOTLPEndpoint:        "http://$(LM_APM_HOST_IP):14318",
+				OTELExporterOTLPTracesEndpoint:  "http://$(LM_APM_HOST_IP):14318/v1/traces",
+				OTELExporterOTLPMetricsEndpoint: "http://$(LM_APM_HOST_IP):14318/v1/metrics",
+				OTELExporterOTLPProtocol:        "http/protobuf",
+			},
+			wantHostIP: true,
+		},
+		{
+			name:         "Node-local mode keeps the container endpoint group",
+			collector:    config.Collector{Mode: config.CollectorModeNodeLocal},
+			containerEnv: []corev1.EnvVar{{Name: OTELExporterOTLPEndpoint, Value: "http://sidecar:4317"}},
+			wantEndpoints: map[string]string{
+				OTELExporterOTLPEndpoint:        "http://sidecar:4317",
+				OTELExporterOTLPTracesEndpoint:  "",
+				OTELExporterOTLPMetricsEndpoint: "",
+				OTELExporterOTLPProtocol:        "",
+			},
+		},
+		{
+			name:         "Node-local mode keeps the container signal endpoint group",
+			collector:    config.Collector{Mode: config.CollectorModeNodeLocal},
+			containerEnv: []corev1.EnvVar{{Name: OTELExporterOTLPTracesEndpoint, Value: "http://sidecar:4318/v1/traces"}, {Name: OTELExporterOTLPProtocol, Value: "http/protobuf"}},
+			wantEndpoints: map[string]string{
+				OTELExporterOTLPEndpoint:        "http://lmotel-svc:4317",
+				OTELExporterOTLPTracesEndpoint:  "http://sidecar:4318/v1/traces",
+				OTELExporterOTLPMetricsEndpoint: "",
+				OTELExporterOTLPProtocol:        "http/protobuf",
+			},
+		},
+		{
+			name:         "Node-local mode overrides the container endpoint if overriding is disabled",
+			collector:    config.Collector{Mode: config.CollectorModeNodeLocal, OverrideDisabled: true},
+			containerEnv: []corev1.EnvVar{{Name: OTELExporterOTLPEndpoint, Value: "http://sidecar:4317"}},
+			wantEndpoints: map[string]string{
+				OTELExporterOTLPEndpoint: "http://$(LM_APM_HOST_IP):4317",
+			},
+			wantHostIP: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &Params{
+				Client: k8sClient,
+				LMConfig: config.Config{
+					MutationConfigProvided: true,
+					MutationConfig: config.MutationConfig{
+						LMEnvVars: config.LMEnvVars{Operation: []config.OperationEnv{centralEndpoint}},
+						Collector: tt.collector,
+					},
+				},
+				Log:       logger,
+				Namespace: "default",
+				Pod: &corev1.Pod{
+					ObjectMeta: v1.ObjectMeta{Name: "test-pod"},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "my-app", Env: tt.containerEnv}}},
+				},
+			}
+			if err := mutateEnvVariables(context.Background(), params); err != nil {
+				t.Errorf("mutateEnvVariables() returned an unexpected error: %+v", err)
+				return
+			}
+			envVars := params.Pod.Spec.Containers[0].Env
+
+			for name, want := range tt.wantEndpoints {
+				var got string
+				if idx := getIndexOfEnv(envVars, name); idx > -1 {
+					got = envVars[idx].Value
+				}
+				if got != want {
+					t.Errorf("mutateEnvVariables() %s = %s, but expected = %s", name, got, want)
+				}
+			}
+
+			hostIPIdx := getIndexOfEnv(envVars, LMAPMHostIP)
+			if !tt.wantHostIP {
+				if hostIPIdx > -1 {
+					t.Errorf("mutateEnvVariables() injected %s, but it is not expected", LMAPMHostIP)
+				}
+				return
+			}
+			if hostIPIdx < 0 || envVars[hostIPIdx].ValueFrom.FieldRef.FieldPath != "status.hostIP" {
+				t.Errorf("mutateEnvVariables() %s is expected to refer status.hostIP, env variables = %+v", LMAPMHostIP, envVars)
+				return
+			}
+			for idx, env := range envVars[:hostIPIdx] {
+				if strings.Contains(env.Value, "$("+LMAPMHostIP+")") {
+					t.Errorf("mutateEnvVariables() %s at index %d refers %s, which is defined later at index %d", env.Name, idx, LMAPMHostIP, hostIPIdx)
+				}
+			}
+		})
+	}
+}
+
+func TestMutateEnvVariablesWithProfiles(t *testing.T) {
+	k8sClient, err := getFakeK8sClient()
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+	profiles := map[string]config.Profile{
+		"java-default": {Env: []corev1.EnvVar{
+			{Name: "OTEL_TRACES_SAMPLER", Value: "parentbased_always_on"},
+			{Name: "OTEL_PROPAGATORS", Value: "tracecontext,baggage"},
+			{Name: "OTEL_METRICS_EXPORTER", Value: "otlp"},
+		}},
+		"low-overhead": {
+			Env: []corev1.EnvVar{
+				{Name: "OTEL_TRACES_SAMPLER", Value: "parentbased_traceidratio"},
+				{Name: "OTEL_TRACES_SAMPLER_ARG", Value: "0.05"},
+				{Name: "LM_APM_POD_NAME", Value: "not-allowed"},
+			},
+			Collector: &config.Collector{Mode: config.CollectorModeNodeLocal},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		annotation   string
+		operationEnv []config.OperationEnv
+		containerEnv []corev1.EnvVar
+		wantEnv      map[string]string
+		wantWarnings int
+	}{
+		{
+			name:       "Single profile",
+			annotation: "java-default",
+			wantEnv:    map[string]string{"OTEL_TRACES_SAMPLER": "parentbased_always_on", "OTEL_PROPAGATORS": "tracecontext,baggage", OTELExporterOTLPEndpoint: ""},
+		},
+		{
+			name:       "Later profile wins and applies its collector override",
+			annotation: "java-default, low-overhead",
+			wantEnv: map[string]string{
+				"OTEL_TRACES_SAMPLER":     "parentbased_traceidratio",
+				"OTEL_TRACES_SAMPLER_ARG": "0.05",
+				"OTEL_METRICS_EXPORTER":   "otlp",
+				OTELExporterOTLPEndpoint:  "http://$(LM_APM_HOST_IP):4317",
+			},
+		},
+		{
+			name:         "Config and container env take precedence over profile",
+			annotation:   "low-overhead",
+			operationEnv: []config.OperationEnv{{Env: corev1.EnvVar{Name: "OTEL_TRACES_SAMPLER", Value: "always_on"}}},
+			containerEnv: []corev1.EnvVar{{Name: "OTEL_TRACES_SAMPLER_ARG", Value: "0.5"}},
+			wantEnv:      map[string]string{"OTEL_TRACES_SAMPLER": "always_on", "OTEL_TRACES_SAMPLER_ARG": "0.5"},
+		},
+		{
+			name:         "Unknown profile",
+			annotation:   "debug",
+			wantEnv:      map[string]string{"OTEL_TRACES_SAMPLER": ""},
+			wantWarnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &Params{
+				Client: k8sClient,
+				LMConfig: config.Config{
+					MutationConfigProvided: true,
+					MutationConfig: config.MutationConfig{
+						LMEnvVars: config.LMEnvVars{Operation: tt.operationEnv},
+						Profiles:  profiles,
+					},
+				},
+				Log:       logger,
+				Namespace: "default",
+				Pod: &corev1.Pod{
+					ObjectMeta: v1.ObjectMeta{Name: "test-pod", Annotations: map[string]string{ProfileAnnotation: tt.annotation}},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "my-app", Env: tt.containerEnv}}},
+				},
+			}
+			if err := mutateEnvVariables(context.Background(), params); err != nil {
+				t.Errorf("mutateEnvVariables() returned an unexpected error: %+v", err)
+				return
+			}
+			envVars := params.Pod.Spec.Containers[0].Env
+
+			for name, want := range tt.wantEnv {
+				var got string
+				if idx := getIndexOfEnv(envVars, name); idx > -1 {
+					got = envVars[idx].Value
+				}
+				if got != want {
+					t.Errorf("mutateEnvVariables() %s = %s, but expected = %s", name, got, want)
+				}
+			}
+			if idx := getIndexOfEnv(envVars, LMAPMPodName); idx < 0 || envVars[idx].Value == "not-allowed" {
+				t.Errorf("mutateEnvVariables() %s is expected to be managed by the webhook, env variables = %+v", LMAPMPodName, envVars)
+			}
+			if len(params.Warnings) != tt.wantWarnings {
+				t.Errorf("mutateEnvVariables() warnings = %v, but expected count = %d", params.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestMutateEnvVariablesWithStandardOTELEnvVars(t *testing.T) {
+	k8sClient, err := getFakeK8sClient()
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+
+	tests := []struct {
+		name                string
+		emitOTELServiceName bool
+		env                 []corev1.EnvVar
+		wantServiceName     string
+		wantOTELServiceName string
+	}{
+		{
+			name:            "Service name from SERVICE_NAME",
+			env:             []corev1.EnvVar{{Name: ServiceName, Value: "checkout"}, {Name: OTELServiceName, Value: "payment"}},
+			wantServiceName: "checkout",
+			// OTEL_SERVICE_NAME of the container is left as is
+			wantOTELServiceName: "payment",
+		},
+		{
+			name:                "Service name from OTEL_SERVICE_NAME",
+			env:                 []corev1.EnvVar{{Name: OTELServiceName, Value: "payment"}},
+			wantServiceName:     "payment",
+			wantOTELServiceName: "payment",
+		},
+		{
+			name:            "Service name from OTEL_RESOURCE_ATTRIBUTES",
+			env:             []corev1.EnvVar{{Name: OTELResourceAttributes, Value: "team=core,service.name=cart"}},
+			wantServiceName: "cart",
+		},
+		{
+			name:            "Service name from workload",
+			wantServiceName: "test-pod",
+		},
+		{
+			name:                "Emit OTEL_SERVICE_NAME",
+			emitOTELServiceName: true,
+			env:                 []corev1.EnvVar{{Name: OTELResourceAttributes, Value: "service.name=cart"}},
+			wantServiceName:     "cart",
+			wantOTELServiceName: "cart",
+		},
+		{
+			name:                "Emitted OTEL_SERVICE_NAME overrides the container one",
+			emitOTELServiceName: true,
+			env:                 []corev1.EnvVar{{Name: ServiceName, Value: "checkout"}, {Name: OTELServiceName, Value: "payment"}},
+			wantServiceName:     "checkout",
+			wantOTELServiceName: "checkout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &Params{
+				Client: k8sClient,
+				LMConfig: config.Config{
+					MutationConfigProvided: true,
+					MutationConfig:         config.MutationConfig{EmitOTELServiceName: tt.emitOTELServiceName},
+				},
+				Log:       logger,
+				Namespace: "default",
+				Pod: &corev1.Pod{
+					ObjectMeta: v1.ObjectMeta{Name: "test-pod"},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "my-app", Env: tt.env}}},
+				},
+			}
+			if err := mutateEnvVariables(context.Background(), params); err != nil {
+				t.Errorf("mutateEnvVariables() returned an unexpected error: %+v", err)
+				return
+			}
+			envVars := params.Pod.Spec.Containers[0].Env
+
+			var serviceName, otelServiceName string
+			if idx := getIndexOfEnv(envVars, ServiceName); idx > -1 {
+				serviceName = envVars[idx].Value
+			}
+			if idx := getIndexOfEnv(envVars, OTELServiceName); idx > -1 {
+				otelServiceName = envVars[idx].Value
+			}
+			if serviceName != tt.wantServiceName {
+				t.Errorf("mutateEnvVariables() SERVICE_NAME = %s, but expected = %s", serviceName, tt.wantServiceName)
+			}
+			if otelServiceName != tt.wantOTELServiceName {
+				t.Errorf("mutateEnvVariables() OTEL_SERVICE_NAME = %s, but expected = %s", otelServiceName, tt.wantOTELServiceName)
+			}
+		})
+	}
+}
+
+func TestGetTargetContainers(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "migrate"}, {Name: "wait-for-db"}},
+			Containers:     []corev1.Container{{Name: "app"}, {Name: "batch-sidecar"}, {Name: "istio-proxy"}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		containers config.Containers
+		want       []string
+	}{
+		{
+			name: "First container by default",
+			want: []string{"app"},
+		},
+		{
+			name:       "All containers",
+			containers: config.Containers{Mode: config.ContainerTargetModeAll},
+			want:       []string{"app", "batch-sidecar", "istio-proxy"},
+		},
+		{
+			name:       "All containers & init containers",
+			containers: config.Containers{Mode: config.ContainerTargetModeAll, InitContainers: true},
+			want:       []string{"migrate", "wait-for-db", "app", "batch-sidecar", "istio-proxy"},
+		},
+		{
+			name:       "Named containers & init containers",
+			containers: config.Containers{Mode: config.ContainerTargetModeNamed, Names: []string{"migrate", "app", "batch-sidecar"}, InitContainers: true},
+			want:       []string{"migrate", "app", "batch-sidecar"},
+		},
+		{
+			name:       "Named init container is not mutated if init containers are not targeted",
+			containers: config.Containers{Mode: config.ContainerTargetModeNamed, Names: []string{"migrate", "app"}},
+			want:       []string{"app"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, container := range getTargetContainers(context.Background(), pod, tt.containers) {
+				got = append(got, container.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getTargetContainers() = %v, but expected = %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderEnvByDependency(t *testing.T) {
+	tests := []struct {
+		name             string
+		envVars          []corev1.EnvVar
+		containerEnvVars []corev1.EnvVar
+		want             []string
+	}{
+		{
+			name: "Env variables without references are kept in order",
+			envVars: []corev1.EnvVar{
+				{Name: "A", Value: "a"}, {Name: "B", Value: "b"}, {Name: "C", Value: "c"},
+			},
+			want: []string{"A", "B", "C"},
+		},
+		{
+			name: "Referring env variable is moved after the referred ones",
+			envVars: []corev1.EnvVar{
+				{Name: OTELResourceAttributes, Value: "service.name=$(SERVICE_NAME),k8s.node.name=$(LM_APM_NODE_NAME)"},
+				{Name: "JAVA_OPTS", Value: "-Xmx512m"},
+				{Name: ServiceName, Value: "checkout"},
+				{Name: LMAPMNodeName, ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}},
+			},
+			want: []string{"JAVA_OPTS", ServiceName, LMAPMNodeName, OTELResourceAttributes},
+		},
+		{
+			name: "Chained references",
+			envVars: []corev1.EnvVar{
+				{Name: OTELExporterOTLPTracesEndpoint, Value: "$(OTEL_EXPORTER_OTLP_ENDPOINT)/v1/traces"},
+				{Name: OTELExporterOTLPEndpoint, Value: "http://$(LM_APM_HOST_IP):4318"},
+				{Name: LMAPMHostIP, ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.hostIP"}}},
+			},
+			want: []string{LMAPMHostIP, OTELExporterOTLPEndpoint, OTELExporterOTLPTracesEndpoint},
+		},
+		{
+			name: "References to undefined & cyclic env variables are left in order",
+			envVars: []corev1.EnvVar{
+				{Name: "A", Value: "$(B)"}, {Name: "B", Value: "$(A)"}, {Name: "C", Value: "$(UNDEFINED)"},
+			},
+			want: []string{"C", "A", "B"},
+		},
+		{
+			name: "Env variables of the container keep their order",
+			envVars: []corev1.EnvVar{
+				{Name: "APP_URL", Value: "http://$(APP_HOST):8080"},
+				{Name: "APP_HOST", Value: "localhost"},
+				{Name: OTELResourceAttributes, Value: "service.name=$(SERVICE_NAME)"},
+				{Name: "JAVA_OPTS", Value: "-Dapp.url=$(APP_URL)"},
+				{Name: ServiceName, Value: "checkout"},
+			},
+			containerEnvVars: []corev1.EnvVar{
+				{Name: "APP_URL", Value: "http://$(APP_HOST):8080"},
+				{Name: "APP_HOST", Value: "localhost"},
+				{Name: OTELResourceAttributes, Value: "team=payments"},
+				{Name: "JAVA_OPTS", Value: "-Dapp.url=$(APP_URL)"},
+			},
+			want: []string{"APP_URL", "APP_HOST", ServiceName, OTELResourceAttributes, "JAVA_OPTS"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, env := range orderEnvByDependency(tt.envVars, tt.containerEnvVars) {
+				got = append(got, env.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("orderEnvByDependency() = %v, but expected = %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMutateEnvVariablesWithMultipleContainers(t *testing.T) {
+	k8sClient, err := getFakeK8sClient()
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+
+	params := &Params{
+		Client: k8sClient,
+		LMConfig: config.Config{
+			MutationConfigProvided: true,
+			MutationConfig: config.MutationConfig{
+				Containers: config.Containers{Mode: config.ContainerTargetModeAll, InitContainers: true},
+			},
+		},
+		Log:       logger,
+		Namespace: "default",
+		Pod: &corev1.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: "test-pod"},
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "migrate", Env: []corev1.EnvVar{{Name: ServiceName, Value: "migrate"}}}},
+				Containers: []corev1.Container{
+					{Name: "app", Env: []corev1.EnvVar{{Name: OTELResourceAttributes, Value: "service.name=cart"}}},
+					{Name: "batch-sidecar"},
+				},
+			},
+		},
+	}
+	if err := mutateEnvVariables(context.Background(), params); err != nil {
+		t.Errorf("mutateEnvVariables() returned an unexpected error: %+v", err)
+		return
+	}
+
+	wantServiceNames := map[string]string{"migrate": "migrate", "app": "cart", "batch-sidecar": "test-pod"}
+	containers := append(append([]corev1.Container{}, params.Pod.Spec.InitContainers...), params.Pod.Spec.Containers...)
+	for _, container := range containers {
+		var serviceName string
+		if idx := getIndexOfEnv(container.Env, ServiceName); idx > -1 {
+			serviceName = container.Env[idx].Value
+		}
+		if serviceName != wantServiceNames[container.Name] {
+			t.Errorf("mutateEnvVariables() SERVICE_NAME of the container %s = %s, but expected = %s", container.Name, serviceName, wantServiceNames[container.Name])
+		}
+		otelResAttrsIdx := getIndexOfEnv(container.Env, OTELResourceAttributes)
+		if otelResAttrsIdx != len(container.Env)-1 {
+			t.Errorf("mutateEnvVariables() OTEL_RESOURCE_ATTRIBUTES of the container %s is expected to be defined after the env variables it refers, env variables = %+v", container.Name, container.Env)
+		}
+	}
+}
+
+func TestMutateEnvVariablesResolvesPodStateOnce(t *testing.T) {
+	k8sClient, err := getFakeK8sClient()
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+	clientset := k8sClient.Clientset.(*testclient.Clientset)
+
+	params := &Params{
+		Client: k8sClient,
+		LMConfig: config.Config{
+			MutationConfigProvided: true,
+			MutationConfig: config.MutationConfig{
+				Containers:          config.Containers{Mode: config.ContainerTargetModeAll},
+				NamespaceAttributes: config.NamespaceAttributes{ServiceNamespace: config.NamespaceAttributeSource{Label: "team"}},
+				LMEnvVars: config.LMEnvVars{Operation: []config.OperationEnv{
+					{Env: corev1.EnvVar{Name: "APP_NAMESPACE", Value: "{{ .Namespace.Name }}"}, When: "pod.metadata.name == 'test-pod'"},
+					{Env: corev1.EnvVar{Name: "LM_API_KEY", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "lm-creds"}, Key: "key"}}}},
+				}},
+			},
+		},
+		Log:       logger,
+		Namespace: "default",
+		Pod: &corev1.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: "test-pod", Annotations: map[string]string{ProfileAnnotation: "missing"}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: "sidecar"}, {Name: "proxy"}}},
+		},
+	}
+	if err := mutateEnvVariables(context.Background(), params); err != nil {
+		t.Errorf("mutateEnvVariables() returned an unexpected error: %+v", err)
+		return
+	}
+
+	for _, container := range params.Pod.Spec.Containers {
+		if idx := getIndexOfEnv(container.Env, "APP_NAMESPACE"); idx < 0 || container.Env[idx].Value != "default" {
+			t.Errorf("mutateEnvVariables() APP_NAMESPACE of the container %s is not injected, env variables = %+v", container.Name, container.Env)
+		}
+	}
+
+	// Namespace & secret are looked up once for all the containers, and their warnings are returned once
+	gets := map[string]int{}
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "get" {
+			gets[action.GetResource().Resource]++
+		}
+	}
+	if gets["namespaces"] != 1 || gets["secrets"] != 1 {
+		t.Errorf("mutateEnvVariables() looked up namespaces %d times & secrets %d times, but expected = 1", gets["namespaces"], gets["secrets"])
+	}
+	if len(params.Warnings) != 2 {
+		t.Errorf("mutateEnvVariables() returned warnings = %v, but expected the missing profile & secret warnings once", params.Warnings)
+	}
+}
+
+func TestGetWorkloadName(t *testing.T) {
+	k8sClient, err := getFakeK8sClient()
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ownedPod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{
+		GenerateName:    "checkout-5d8f7c9b6-",
+		OwnerReferences: []v1.OwnerReference{{Kind: WorkloadResourceReplicaSet, Name: "checkout-5d8f7c9b6"}},
+	}}
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		workloadName string
+		pod          *corev1.Pod
+		want         string
+	}{
+		{
+			name:         "Workload name of the params",
+			ctx:          canceledCtx,
+			workloadName: "checkout",
+			pod:          ownedPod,
+			want:         "checkout",
+		},
+		{
+			name: "Orphan pod",
+			ctx:  context.Background(),
+			pod:  &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "debug"}},
+			want: "debug",
+		},
+		{
+			name: "Workload lookup is skipped once the time budget is exhausted",
+			ctx:  canceledCtx,
+			pod:  ownedPod,
+			want: "checkout-5d8f7c9b6",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &Params{Client: k8sClient, Log: logger, Namespace: "default", Pod: tt.pod, WorkloadName: tt.workloadName}
+			got, err := getWorkloadName(tt.ctx, params)
+			if err != nil {
+				t.Errorf("getWorkloadName() returned an unexpected error: %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("getWorkloadName() = %s, but expected = %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// latencyClientset is the fake clientset which delays the get calls of the replica sets
+// and honors the context while doing so, as the real clientset does.
+type latencyClientset struct {
+	*testclient.Clientset
+	latencies []time.Duration
+	calls     int32
+}
+
+func (c *latencyClientset) AppsV1() typedappsv1.AppsV1Interface {
+	return &latencyAppsV1{AppsV1Interface: c.Clientset.AppsV1(), clientset: c}
+}
+
+type latencyAppsV1 struct {
+	typedappsv1.AppsV1Interface
+	clientset *latencyClientset
+}
+
+func (a *latencyAppsV1) ReplicaSets(namespace string) typedappsv1.ReplicaSetInterface {
+	return &latencyReplicaSets{ReplicaSetInterface: a.AppsV1Interface.ReplicaSets(namespace), clientset: a.clientset}
+}
+
+type latencyReplicaSets struct {
+	typedappsv1.ReplicaSetInterface
+	clientset *latencyClientset
+}
+
+func (r *latencyReplicaSets) Get(ctx context.Context, name string, opts v1.GetOptions) (*appsv1.ReplicaSet, error) {
+	call := int(atomic.AddInt32(&r.clientset.calls, 1) - 1)
+	if call < len(r.clientset.latencies) {
+		select {
+		case <-time.After(r.clientset.latencies[call]):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return r.ReplicaSetInterface.Get(ctx, name, opts)
+}
+
+func TestGetParentWorkloadNameForPodWithLatency(t *testing.T) {
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: v1.ObjectMeta{
+		Name:            "checkout-5d8f7c9b6",
+		Namespace:       "default",
+		OwnerReferences: []v1.OwnerReference{{Kind: WorkloadResourceDeployment, Name: "checkout"}},
+	}}
+	pod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{
+		GenerateName:    "checkout-5d8f7c9b6-",
+		OwnerReferences: []v1.OwnerReference{{Kind: WorkloadResourceReplicaSet, Name: "checkout-5d8f7c9b6"}},
+	}}
+	replicaSetsResource := schema.GroupResource{Group: "apps", Resource: "replicasets"}
+
+	tests := []struct {
+		name      string
+		opts      WorkloadLookupOptions
+		ctxBudget time.Duration
+		// latencies & errors are injected into the subsequent get calls of the replica set.
+		latencies []time.Duration
+		errs      []error
+		want      string
+		wantErr   bool
+		wantCalls int
+	}{
+		{
+			name:      "Lookup within the timeout",
+			opts:      WorkloadLookupOptions{Timeout: time.Second, Retries: 2},
+			latencies: []time.Duration{10 * time.Millisecond},
+			want:      "checkout",
+			wantCalls: 1,
+		},
+		{
+			name:      "Retry the lookup timed out",
+			opts:      WorkloadLookupOptions{Timeout: 20 * time.Millisecond, Retries: 2},
+			latencies: []time.Duration{60 * time.Millisecond},
+			want:      "checkout",
+			wantCalls: 2,
+		},
+		{
+			name:      "Retry the transient errors",
+			opts:      WorkloadLookupOptions{Timeout: time.Second, Retries: 2},
+			errs:      []error{apierrors.NewServiceUnavailable("etcd leader changed"), apierrors.NewTooManyRequests("throttled", 0)},
+			want:      "checkout",
+			wantCalls: 3,
+		},
+		{
+			name:      "Do not retry the permanent errors",
+			opts:      WorkloadLookupOptions{Timeout: time.Second, Retries: 2},
+			errs:      []error{apierrors.NewNotFound(replicaSetsResource, "checkout-5d8f7c9b6")},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:      "Give up once the retries are exhausted",
+			opts:      WorkloadLookupOptions{Timeout: 20 * time.Millisecond, Retries: 1},
+			latencies: []time.Duration{60 * time.Millisecond, 60 * time.Millisecond},
+			wantErr:   true,
+			wantCalls: 2,
+		},
+		{
+			name:      "Request context bounds the lookup",
+			opts:      WorkloadLookupOptions{Retries: 5},
+			ctxBudget: 50 * time.Millisecond,
+			latencies: []time.Duration{2 * time.Second},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := &latencyClientset{Clientset: testclient.NewSimpleClientset(replicaSet), latencies: tt.latencies}
+			var reactorCalls int32
+			clientset.PrependReactor("get", "replicasets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				call := int(atomic.AddInt32(&reactorCalls, 1) - 1)
+				if call < len(tt.errs) {
+					return true, nil, tt.errs[call]
+				}
+				return false, nil, nil
+			})
+			k8sClient, err := config.NewK8sClient(nil, func(r *rest.Config) (kubernetes.Interface, error) { return clientset, nil })
+			if err != nil {
+				t.Errorf("Error occured in getting fake k8s client: %v", err)
+				return
+			}
+
+			ctx := context.Background()
+			if tt.ctxBudget > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.ctxBudget)
+				defer cancel()
+			}
+
+			start := time.Now()
+			got, err := getParentWorkloadNameForPod(ctx, pod, k8sClient, "default", tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getParentWorkloadNameForPod() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("getParentWorkloadNameForPod() = %s, but expected = %s", got, tt.want)
+			}
+			if calls := int(atomic.LoadInt32(&clientset.calls)); calls != tt.wantCalls {
+				t.Errorf("getParentWorkloadNameForPod() called the API %d times, but expected = %d", calls, tt.wantCalls)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("getParentWorkloadNameForPod() took %v, but it is expected to be bounded by the deadlines", elapsed)
+			}
+		})
+	}
+}
+
+func TestRunMutationsWithCache(t *testing.T) {
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: v1.ObjectMeta{
+		Name:            "checkout-5d8f7c9b6",
+		Namespace:       "default",
+		OwnerReferences: []v1.OwnerReference{{Kind: WorkloadResourceDeployment, Name: "checkout"}},
+	}}
+	newPod := func(labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: v1.ObjectMeta{
+				GenerateName:    "checkout-5d8f7c9b6-",
+				Labels:          labels,
+				OwnerReferences: []v1.OwnerReference{{Kind: WorkloadResourceReplicaSet, Name: "checkout-5d8f7c9b6"}},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "checkout", Image: "checkout:v1"}}},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		cache *MutationCache
+		pods  []*corev1.Pod
+		// wantCalls is the number of the replica set lookups
+		wantCalls int
+	}{
+		{
+			name:      "Mutations are run for each pod without cache",
+			pods:      []*corev1.Pod{newPod(map[string]string{"app": "checkout"}), newPod(map[string]string{"app": "checkout"})},
+			wantCalls: 2,
+		},
+		{
+			name:      "Mutation result of the identical pod is memoized",
+			cache:     NewMutationCache(10, time.Minute),
+			pods:      []*corev1.Pod{newPod(map[string]string{"app": "checkout"}), newPod(map[string]string{"app": "checkout"})},
+			wantCalls: 1,
+		},
+		{
+			name:      "Workload name of the pod owner is memoized",
+			cache:     NewMutationCache(10, time.Minute),
+			pods:      []*corev1.Pod{newPod(map[string]string{"app": "checkout"}), newPod(map[string]string{"app": "checkout", "canary": "true"})},
+			wantCalls: 1,
+		},
+		{
+			name:      "Expired entries are not used",
+			cache:     NewMutationCache(10, time.Nanosecond),
+			pods:      []*corev1.Pod{newPod(map[string]string{"app": "checkout"}), newPod(map[string]string{"app": "checkout"})},
+			wantCalls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := testclient.NewSimpleClientset(replicaSet, &corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default", ResourceVersion: "1"}})
+			var calls int32
+			clientset.PrependReactor("get", "replicasets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				atomic.AddInt32(&calls, 1)
+				return false, nil, nil
+			})
+			k8sClient, err := config.NewK8sClient(nil, func(r *rest.Config) (kubernetes.Interface, error) { return clientset, nil })
+			if err != nil {
+				t.Errorf("Error occured in getting fake k8s client: %v", err)
+				return
+			}
+			testutil.StartNamespaceInformer(t, k8sClient)
+
+			var mutatedSpecs []corev1.PodSpec
+			for _, pod := range tt.pods {
+				params := &Params{
+					Client:    k8sClient,
+					Pod:       pod,
+					LMConfig:  config.Config{},
+					Mutations: Mutations,
+					Namespace: "default",
+					Log:       logger,
+					Cache:     tt.cache,
+				}
+				if err := RunMutations(context.Background(), params); err != nil {
+					t.Errorf("RunMutations() returned an unexpected error: %+v", err)
+					return
+				}
+				mutatedSpecs = append(mutatedSpecs, pod.Spec)
+			}
+
+			if calls := int(atomic.LoadInt32(&calls)); calls != tt.wantCalls {
+				t.Errorf("RunMutations() looked up the replica set %d times, but expected = %d", calls, tt.wantCalls)
+			}
+			for _, spec := range mutatedSpecs[1:] {
+				if !reflect.DeepEqual(spec, mutatedSpecs[0]) {
+					t.Errorf("RunMutations() = %v, but expected = %v", spec, mutatedSpecs[0])
+				}
+			}
+		})
+	}
+}
+
+func TestMutationCacheIsolatesResults(t *testing.T) {
+	cache := NewMutationCache(10, time.Minute)
+	cache.addResult("key", corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Env: []corev1.EnvVar{{Name: "A", Value: "1"}}}}}, nil)
+
+	result, found := cache.getResult("key")
+	if !found {
+		t.Errorf("getResult() did not find the memoized result")
+		return
+	}
+	result.spec.Containers[0].Env[0].Value = "changed"
+
+	result, _ = cache.getResult("key")
+	if got := result.spec.Containers[0].Env[0].Value; got != "1" {
+		t.Errorf("getResult() = %s, but expected = %s", got, "1")
+	}
+}
+
+func TestRunMutationsDoesNotMemoizeDryRun(t *testing.T) {
+	k8sClient, err := testutil.NewFakeK8sClient(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+	testutil.StartNamespaceInformer(t, k8sClient)
+	cache := NewMutationCache(10, time.Minute)
+	params := &Params{
+		Client: k8sClient,
+		Pod: &corev1.Pod{
+			ObjectMeta: v1.ObjectMeta{GenerateName: "checkout-", OwnerReferences: []v1.OwnerReference{{Kind: WorkloadResourceJob, Name: "checkout"}}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "checkout", Image: "checkout:v1"}}},
+		},
+		LMConfig:     config.Config{},
+		Mutations:    Mutations,
+		Namespace:    "default",
+		WorkloadName: "checkout",
+		Log:          logger,
+		Cache:        cache,
+		DryRun:       true,
+	}
+	key, _ := cache.resultKey(context.Background(), params)
+
+	if err := RunMutations(context.Background(), params); err != nil {
+		t.Errorf("RunMutations() returned an unexpected error: %+v", err)
+		return
+	}
+	if _, found := cache.results.Get(key); found {
+		t.Errorf("RunMutations() memoized the result of the dry run, which skipped the side effects")
+	}
+}
+
+func TestMutationCacheResultKey(t *testing.T) {
+	newPod := func(name string, image string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: name, GenerateName: "checkout-", UID: types.UID(name), OwnerReferences: []v1.OwnerReference{{Kind: WorkloadResourceJob, Name: "checkout"}}},
+			Spec:       corev1.PodSpec{NodeName: name, Containers: []corev1.Container{{Name: "checkout", Image: image}}},
+		}
+	}
+	resultKey := func(namespace *corev1.Namespace, pod *corev1.Pod, withLister bool) (string, bool) {
+		clientset := testclient.NewSimpleClientset(namespace)
+		k8sClient, err := config.NewK8sClient(nil, func(r *rest.Config) (kubernetes.Interface, error) { return clientset, nil })
+		if err != nil {
+			t.Errorf("Error occured in getting fake k8s client: %v", err)
+			return "", false
+		}
+		if withLister {
+			testutil.StartNamespaceInformer(t, k8sClient)
+			clientset.ClearActions()
+		}
+		params := &Params{Client: k8sClient, Pod: pod, Mutations: Mutations, Namespace: "default", WorkloadName: "checkout", Log: logger}
+		key, ok := NewMutationCache(10, time.Minute).resultKey(context.Background(), params)
+		if actions := clientset.Actions(); len(actions) > 0 {
+			t.Errorf("resultKey() called the API = %v, but expected the namespace to be looked up from the informer cache only", actions)
+		}
+		return key, ok
+	}
+	namespace := &corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default", ResourceVersion: "1"}}
+
+	key, ok := resultKey(namespace, newPod("checkout-x7k2p", "checkout:v1"), true)
+	if !ok {
+		t.Errorf("resultKey() did not return the key of the pod with owner")
+		return
+	}
+	if sameKey, _ := resultKey(namespace, newPod("checkout-m4q9z", "checkout:v1"), true); sameKey != key {
+		t.Errorf("resultKey() of the other replica = %s, but expected = %s", sameKey, key)
+	}
+	if otherKey, _ := resultKey(namespace, newPod("checkout-x7k2p", "checkout:v2"), true); otherKey == key {
+		t.Errorf("resultKey() = %s, but expected the other key once the container is changed", otherKey)
+	}
+	if updatedKey, _ := resultKey(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default", ResourceVersion: "2"}}, newPod("checkout-x7k2p", "checkout:v1"), true); updatedKey == key {
+		t.Errorf("resultKey() = %s, but expected the other key once the namespace is updated", updatedKey)
+	}
+	if _, ok := resultKey(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "other"}}, newPod("checkout-x7k2p", "checkout:v1"), true); ok {
+		t.Errorf("resultKey() returned the key, but expected none when the namespace is not found")
+	}
+	if _, ok := resultKey(namespace, newPod("checkout-x7k2p", "checkout:v1"), false); ok {
+		t.Errorf("resultKey() returned the key, but expected none when the namespace informer cache is not synced")
+	}
+}
+
+func TestRunMutationsDoesNotMemoizeSkippedEnvSources(t *testing.T) {
+	k8sClient, err := testutil.NewFakeK8sClient(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+	testutil.StartNamespaceInformer(t, k8sClient)
+	cache := NewMutationCache(10, time.Minute)
+	lmConfig := config.Config{MutationConfigProvided: true}
+	lmConfig.MutationConfig.LMEnvVars.Operation = []config.OperationEnv{{
+		Env: corev1.EnvVar{Name: "LM_API_TOKEN", ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "lm-creds"}, Key: "token"},
+		}},
+	}}
+	params := &Params{
+		Client: k8sClient,
+		Pod: &corev1.Pod{
+			ObjectMeta: v1.ObjectMeta{GenerateName: "checkout-", OwnerReferences: []v1.OwnerReference{{Kind: WorkloadResourceJob, Name: "checkout"}}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "checkout", Image: "checkout:v1"}}},
+		},
+		LMConfig:     lmConfig,
+		Mutations:    Mutations,
+		Namespace:    "default",
+		WorkloadName: "checkout",
+		Log:          logger,
+		Cache:        cache,
+	}
+	key, _ := cache.resultKey(context.Background(), params)
+
+	if err := RunMutations(context.Background(), params); err != nil {
+		t.Errorf("RunMutations() returned an unexpected error: %+v", err)
+		return
+	}
+	if len(params.Warnings) == 0 {
+		t.Errorf("RunMutations() did not warn about the missing secret")
+	}
+	if _, found := cache.results.Get(key); found {
+		t.Errorf("RunMutations() memoized the result which skipped the missing secret")
+	}
+}
+
+func TestCheckEnvSourceIsMemoized(t *testing.T) {
+	clientset := testclient.NewSimpleClientset(&corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: "lm-creds", Namespace: "default"}, Data: map[string][]byte{"token": []byte("t0ken")}})
+	k8sClient, err := config.NewK8sClient(nil, func(r *rest.Config) (kubernetes.Interface, error) { return clientset, nil })
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+
+	tests := []struct {
+		name     string
+		cache    *MutationCache
+		wantGets int
+	}{
+		{name: "Secret is looked up for each check without cache", wantGets: 3},
+		{name: "Keys of the secret are memoized", cache: NewMutationCache(10, time.Minute), wantGets: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset.ClearActions()
+			params := &Params{Client: k8sClient, Namespace: "default", Log: logger, Cache: tt.cache}
+			for _, ref := range []envSourceRef{{kind: "Secret", name: "lm-creds", key: "token"}, {kind: "Secret", name: "lm-creds", key: "token"}} {
+				if err := checkEnvSource(context.Background(), params, ref, false); err != nil {
+					t.Errorf("checkEnvSource() returned an unexpected error: %v", err)
+				}
+			}
+			if err := checkEnvSource(context.Background(), params, envSourceRef{kind: "Secret", name: "lm-creds", key: "password"}, false); err == nil {
+				t.Errorf("checkEnvSource() returned nil for the missing key, instead of error")
+			}
+			if gets := len(clientset.Actions()); gets != tt.wantGets {
+				t.Errorf("checkEnvSource() looked up the secret %d times, but expected = %d", gets, tt.wantGets)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package mutation
+
+import (
+	"context"
+	"strconv"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ObserveOnlyAnnotation set on the namespace overrides the global observe-only mode for the namespace, "true" or "false".
+// In observe-only mode, mutation is computed & recorded, but not applied.
+const ObserveOnlyAnnotation = "lm-k8s-webhook/observe-only"
+
+// IsObserveOnly checks if the mutation is to be only observed in the namespace of the params,
+// the global mode is used if the namespace is not annotated or can not be looked up
+func IsObserveOnly(ctx context.Context, params *Params, observeOnly bool) bool {
+	logger := log.FromContext(ctx).WithName("IsObserveOnly")
+	namespace, err := getPodNamespace(ctx, params)
+	if err != nil {
+		logger.Error(err, "Error in getting the namespace, using the global observe-only mode", "namespace", params.Namespace, "observeOnly", observeOnly)
+		return observeOnly
+	}
+	if namespace == nil {
+		return observeOnly
+	}
+	value, found := namespace.GetAnnotations()[ObserveOnlyAnnotation]
+	if !found {
+		return observeOnly
+	}
+	namespaceObserveOnly, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Error(err, "Invalid observe-only annotation on the namespace, using the global observe-only mode", "namespace", params.Namespace, "observeOnly", observeOnly)
+		return observeOnly
+	}
+	return namespaceObserveOnly
+}
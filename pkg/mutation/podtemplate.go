@@ -0,0 +1,16 @@
+package mutation
+
+import (
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TemplateMutatedAnnotation is set on the pod template mutated by the workload handler, it holds the hash of the config the template is mutated with.
+// Pods created from the template are not mutated again while the config is not reloaded, so that the merged env variables & the audits are not repeated.
+const TemplateMutatedAnnotation = "lm-k8s-webhook/template-mutated"
+
+// IsTemplateMutated checks if the pod is created from the pod template mutated with the current config
+func IsTemplateMutated(pod *corev1.Pod) bool {
+	hash, found := pod.GetAnnotations()[TemplateMutatedAnnotation]
+	return found && hash == config.GetConfigInfo().Hash
+}
@@ -0,0 +1,64 @@
+package mutation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ProfileAnnotation selects the profiles of the config for the pod, multiple profiles can be specified comma separated
+const ProfileAnnotation = "lm-k8s-webhook/profile"
+
+// getPodProfileNames returns the names of the profiles selected by the pod annotation
+func getPodProfileNames(pod *corev1.Pod) []string {
+	var names []string
+	for _, name := range strings.Split(pod.GetAnnotations()[ProfileAnnotation], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// applyProfileOverrides applies the collector & service version overrides of the profiles selected by the pod, later profile wins.
+// Params are built per admission request, so the overrides do not affect the loaded config.
+func applyProfileOverrides(params *Params) {
+	for _, name := range getPodProfileNames(params.Pod) {
+		profile, ok := params.LMConfig.MutationConfig.Profiles[name]
+		if !ok {
+			continue
+		}
+		if profile.Collector != nil {
+			params.LMConfig.MutationConfig.Collector = *profile.Collector
+		}
+		if profile.ServiceVersion != nil {
+			params.LMConfig.MutationConfig.ServiceVersion = *profile.ServiceVersion
+		}
+	}
+}
+
+// getProfileEnvVars returns the env variables of the profiles selected by the pod, env variable of the later profile wins
+func getProfileEnvVars(ctx context.Context, params *Params) []corev1.EnvVar {
+	logger := log.FromContext(ctx).WithName("getProfileEnvVars")
+
+	var envVars []corev1.EnvVar
+	for _, name := range getPodProfileNames(params.Pod) {
+		profile, ok := params.LMConfig.MutationConfig.Profiles[name]
+		if !ok {
+			params.addWarning(fmt.Sprintf("lm-k8s-webhook: profile %s selected by the %s annotation is not found", name, ProfileAnnotation))
+			logger.Info("profile selected by the pod is not found, skipping it", "profile", name)
+			continue
+		}
+		for _, env := range profile.Env {
+			if idx := getIndexOfEnv(envVars, env.Name); idx > -1 {
+				envVars[idx] = env
+				continue
+			}
+			envVars = append(envVars, env)
+		}
+	}
+	return envVars
+}
@@ -0,0 +1,172 @@
+package mutation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// envTemplateExecutionTimeout is the max time allowed for evaluating an env value template
+	envTemplateExecutionTimeout = 100 * time.Millisecond
+
+	// envTemplateMaxOutputSize is the max size of the evaluated env value in bytes
+	envTemplateMaxOutputSize = 4096
+)
+
+var (
+	errEnvTemplateTimeout       = errors.New("env value template evaluation timed out")
+	errEnvTemplateOutputTooLong = errors.New("evaluated env value template exceeds the max allowed size")
+)
+
+// envTemplateObject represents the metadata of the object exposed to the env value templates
+type envTemplateObject struct {
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// envTemplateWorkload represents the workload resource managing the pod
+type envTemplateWorkload struct {
+	Name string
+}
+
+// envTemplateContainer represents the container into which env variables are injected
+type envTemplateContainer struct {
+	Name      string
+	Image     string
+	ImageName string
+	ImageTag  string
+}
+
+// envTemplateData is the data against which the env value templates are evaluated
+type envTemplateData struct {
+	Pod       envTemplateObject
+	Namespace envTemplateObject
+	Workload  envTemplateWorkload
+	Container envTemplateContainer
+}
+
+// envTemplateRenderer evaluates the env value templates, the template data of the pod is built once on first use and shared by the containers of the pod
+type envTemplateRenderer struct {
+	params  *Params
+	lookups *podLookups
+	podData *envTemplateData
+}
+
+// newEnvTemplateRenderer returns the env value template renderer for the pod
+func newEnvTemplateRenderer(params *Params, lookups *podLookups) *envTemplateRenderer {
+	return &envTemplateRenderer{params: params, lookups: lookups}
+}
+
+// render returns the env variable of the container with its value evaluated, if the value is a go-template
+func (r *envTemplateRenderer) render(ctx context.Context, env corev1.EnvVar, container corev1.Container) (corev1.EnvVar, error) {
+	if !config.IsEnvTemplate(env.Value) {
+		return env, nil
+	}
+	tmpl, err := config.GetEnvTemplate(env.Value)
+	if err != nil {
+		return env, err
+	}
+	if r.podData == nil {
+		r.podData = r.buildPodData(ctx)
+	}
+	data := *r.podData
+	imageName, imageTag := parseImage(container.Image)
+	data.Container = envTemplateContainer{
+		Name:      container.Name,
+		Image:     container.Image,
+		ImageName: imageName,
+		ImageTag:  imageTag,
+	}
+
+	// Execution is stopped by the failed write, once the output or the time limit is exceeded
+	out := &limitedBuffer{limit: envTemplateMaxOutputSize, deadline: time.Now().Add(envTemplateExecutionTimeout)}
+	if err := tmpl.Execute(out, &data); err != nil {
+		return env, err
+	}
+	if out.timedOut() {
+		return env, errEnvTemplateTimeout
+	}
+	rendered := env
+	rendered.Value = out.String()
+	return rendered, nil
+}
+
+// buildPodData builds the template data from the pod, its namespace & workload resource
+func (r *envTemplateRenderer) buildPodData(ctx context.Context) *envTemplateData {
+	logger := log.FromContext(ctx).WithName("envTemplateRenderer")
+	pod := r.params.Pod
+
+	data := &envTemplateData{
+		Pod: envTemplateObject{
+			Name:        pod.GetName(),
+			Namespace:   r.params.Namespace,
+			Labels:      pod.GetLabels(),
+			Annotations: pod.GetAnnotations(),
+		},
+		Namespace: envTemplateObject{Name: r.params.Namespace},
+	}
+
+	if namespace := r.lookups.getNamespace(ctx); namespace != nil {
+		data.Namespace.Labels = namespace.GetLabels()
+		data.Namespace.Annotations = namespace.GetAnnotations()
+	}
+
+	workloadName, err := r.lookups.getWorkloadName(ctx)
+	if err != nil {
+		logger.Error(err, "error in getting the workload resource of pod")
+	}
+	data.Workload.Name = workloadName
+	return data
+}
+
+// parseImage splits the container image reference into the image name & tag, digest is dropped from the image name
+func parseImage(image string) (string, string) {
+	if idx := strings.Index(image, "@"); idx > -1 {
+		image = image[:idx]
+	}
+	// Tag separator is the last colon after the last slash, otherwise colon belongs to the registry port
+	lastSlash := strings.LastIndex(image, "/")
+	if idx := strings.LastIndex(image, ":"); idx > lastSlash {
+		return image[:idx], image[idx+1:]
+	}
+	return image, ""
+}
+
+// parseImageDigest returns the digest of the container image reference, if the image is referred by digest
+func parseImageDigest(image string) string {
+	if idx := strings.Index(image, "@"); idx > -1 {
+		return image[idx+1:]
+	}
+	return ""
+}
+
+// limitedBuffer is a buffer which fails the write once the size limit is exceeded or the deadline is passed
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int
+	deadline time.Time
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, errEnvTemplateOutputTooLong
+	}
+	if b.timedOut() {
+		return 0, errEnvTemplateTimeout
+	}
+	return b.Buffer.Write(p)
+}
+
+// timedOut checks if the deadline of the buffer is passed
+func (b *limitedBuffer) timedOut() bool {
+	return !b.deadline.IsZero() && time.Now().After(b.deadline)
+}
@@ -0,0 +1,93 @@
+package mutation
+
+import (
+	"context"
+	"time"
+
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/metrics"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// whenEvaluator evaluates the when expressions of the env variables, the activation is built once on first use and shared by the containers of the pod
+type whenEvaluator struct {
+	params     *Params
+	lookups    *podLookups
+	activation map[string]interface{}
+}
+
+// newWhenEvaluator returns the when expression evaluator for the pod
+func newWhenEvaluator(params *Params, lookups *podLookups) *whenEvaluator {
+	return &whenEvaluator{params: params, lookups: lookups}
+}
+
+// evaluate checks if the when expression evaluates to true, empty expression is always true.
+// Expression which can not be evaluated, for example due to the missing label, is considered as false.
+func (e *whenEvaluator) evaluate(ctx context.Context, expression string) bool {
+	if expression == "" {
+		return true
+	}
+	logger := log.FromContext(ctx).WithName("whenEvaluator")
+
+	program, err := config.GetWhenProgram(expression)
+	if err != nil {
+		logger.Error(err, "error in compiling the when expression", "expression", expression)
+		metrics.WhenEvaluations.WithLabelValues("error").Inc()
+		return false
+	}
+	if e.activation == nil {
+		e.activation = e.buildActivation(ctx)
+	}
+
+	start := time.Now()
+	out, details, err := program.ContextEval(ctx, e.activation)
+	metrics.WhenEvaluationDuration.Observe(time.Since(start).Seconds())
+	if details != nil && details.ActualCost() != nil {
+		metrics.WhenEvaluationCost.Observe(float64(*details.ActualCost()))
+	}
+	if err != nil {
+		logger.Info("when expression can not be evaluated, considering it as false", "expression", expression, "reason", err.Error())
+		metrics.WhenEvaluations.WithLabelValues("error").Inc()
+		return false
+	}
+
+	result, ok := out.Value().(bool)
+	if !ok || !result {
+		metrics.WhenEvaluations.WithLabelValues("false").Inc()
+		return false
+	}
+	metrics.WhenEvaluations.WithLabelValues("true").Inc()
+	return true
+}
+
+// buildActivation builds the variables of the when expressions from the pod, its namespace & owner
+func (e *whenEvaluator) buildActivation(ctx context.Context) map[string]interface{} {
+	logger := log.FromContext(ctx).WithName("whenEvaluator")
+	activation := map[string]interface{}{
+		"pod":             map[string]interface{}{},
+		"namespaceObject": map[string]interface{}{},
+		"owner":           map[string]interface{}{},
+	}
+
+	pod, err := runtime.DefaultUnstructuredConverter.ToUnstructured(e.params.Pod)
+	if err != nil {
+		logger.Error(err, "error in converting the pod")
+	} else {
+		activation["pod"] = pod
+	}
+
+	if namespace := e.lookups.getNamespace(ctx); namespace != nil {
+		if namespaceObject, err := runtime.DefaultUnstructuredConverter.ToUnstructured(namespace); err == nil {
+			activation["namespaceObject"] = namespaceObject
+		}
+	}
+
+	if ownerRef := metav1.GetControllerOf(e.params.Pod); ownerRef != nil {
+		activation["owner"] = map[string]interface{}{"apiVersion": ownerRef.APIVersion, "kind": ownerRef.Kind, "name": ownerRef.Name, "uid": string(ownerRef.UID)}
+	} else if ownerRefs := e.params.Pod.GetOwnerReferences(); len(ownerRefs) > 0 {
+		activation["owner"] = map[string]interface{}{"apiVersion": ownerRefs[0].APIVersion, "kind": ownerRefs[0].Kind, "name": ownerRefs[0].Name, "uid": string(ownerRefs[0].UID)}
+	}
+	return activation
+}
@@ -0,0 +1,71 @@
+package mutation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// workloadLookupRetryDelay is the base delay between the retries of the workload lookup, it is doubled on each retry & jittered
+const workloadLookupRetryDelay = 50 * time.Millisecond
+
+// WorkloadLookupOptions holds the options of looking up the workload resource managing the pod
+type WorkloadLookupOptions struct {
+	// Timeout is the deadline of each attempt of the lookup, the request context bounds the lookup if it is 0
+	Timeout time.Duration
+
+	// Retries is the number of the retries of an attempt failed with a transient error
+	Retries int
+}
+
+// retryWorkloadLookup calls the lookup with the deadline of each attempt, attempts failed with a transient error are retried with jitter
+func retryWorkloadLookup(ctx context.Context, opts WorkloadLookupOptions, lookup func(context.Context) (client.Object, error)) (client.Object, error) {
+	logger := log.FromContext(ctx).WithName("retryWorkloadLookup")
+
+	delay := workloadLookupRetryDelay
+	for attempt := 0; ; attempt++ {
+		object, err := callWithTimeout(ctx, opts.Timeout, lookup)
+		if err == nil || !isTransientError(err) || attempt >= opts.Retries || ctx.Err() != nil {
+			return object, err
+		}
+		logger.Info("transient error in the workload lookup, retrying", "attempt", attempt+1, "error", err.Error())
+
+		select {
+		case <-time.After(wait.Jitter(delay, 1.0)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// callWithTimeout calls the lookup with the deadline, the lookup is bounded by the deadline as the k8s clients honor the context.
+// Error of the lookup failed due to the deadline is reported as the context error, so that it is retried as a transient error.
+func callWithTimeout(ctx context.Context, timeout time.Duration, lookup func(context.Context) (client.Object, error)) (client.Object, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	object, err := lookup(ctx)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return object, err
+}
+
+// isTransientError checks if the API call failed with the error, which may not occur on retry
+func isTransientError(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) ||
+		apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsInternalError(err)
+}
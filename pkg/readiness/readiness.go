@@ -0,0 +1,220 @@
+package readiness
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/certs"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/mutation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+const (
+	// DefaultSelfTestNamespace is the namespace of the self-test pod, if the namespace of the webhook is not known
+	DefaultSelfTestNamespace = "default"
+
+	selfTestPodName = "lm-k8s-webhook-self-test"
+)
+
+// ConfigCheck returns the checker reporting if the external config is loaded.
+// It fails only if the config file is present, but the config was never loaded. Failed reload of the config does not fail the check,
+// as the previously loaded config is still in use, it is reported by the config_load_failed metric instead.
+func ConfigCheck(configFilePath string) healthz.Checker {
+	return func(_ *http.Request) error {
+		if config.GetConfig().MutationConfigProvided {
+			return nil
+		}
+		if err := config.GetLoadError(); err != nil {
+			return fmt.Errorf("external config is not loaded: %w", err)
+		}
+		if _, err := os.Stat(filepath.Clean(configFilePath)); err == nil {
+			return errors.New("external config is present, but not loaded")
+		}
+		return nil
+	}
+}
+
+// CertCheck returns the checker reporting if the serving certificate & key are loadable, the certificate is not expired,
+// and the last reload of the certificate by the watcher did not fail, the watcher is not checked if it is nil.
+// Certificate expiring within the expiry threshold does not fail the check, as the not ready replicas would not serve it any sooner,
+// it is logged once per certificate instead, and reported by the serving_cert_expiry_seconds metric.
+func CertCheck(certFile string, keyFile string, expiryThreshold time.Duration, watcher *certs.Watcher, logger logr.Logger) healthz.Checker {
+	var lock sync.Mutex
+	var warnedNotAfter time.Time
+	return func(_ *http.Request) error {
+		if watcher != nil {
+			if err := watcher.ReloadError(); err != nil {
+				return fmt.Errorf("last reload of the serving certificate failed: %w", err)
+			}
+		}
+		keyPair, err := tls.LoadX509KeyPair(filepath.Clean(certFile), filepath.Clean(keyFile))
+		if err != nil {
+			return fmt.Errorf("serving certificate is not loaded: %w", err)
+		}
+		cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("serving certificate is not parsed: %w", err)
+		}
+		timeLeft := time.Until(cert.NotAfter)
+		if timeLeft <= 0 {
+			return fmt.Errorf("serving certificate expired at %s", cert.NotAfter.Format(time.RFC3339))
+		}
+		if timeLeft < expiryThreshold {
+			lock.Lock()
+			defer lock.Unlock()
+			if !warnedNotAfter.Equal(cert.NotAfter) {
+				warnedNotAfter = cert.NotAfter
+				logger.Info("Serving certificate is expiring soon", "notAfter", cert.NotAfter.Format(time.RFC3339), "threshold", expiryThreshold.String())
+			}
+		}
+		return nil
+	}
+}
+
+// InformerCheck returns the checker reporting if the informer caches of the k8s client are synced
+func InformerCheck(k8sClient *config.K8sClient) healthz.Checker {
+	return func(_ *http.Request) error {
+		if !k8sClient.NamespaceInformerSynced() {
+			return errors.New("namespace informer cache is not synced")
+		}
+		return nil
+	}
+}
+
+// SelfTest periodically looks up its namespace through the API server & the informer cache, and runs the canned pod through the mutations,
+// so that the webhook is not reported ready if it can not look up the namespaces or mutate the pods with the current config
+type SelfTest struct {
+	Client    *config.K8sClient
+	Log       logr.Logger
+	Namespace string
+
+	// Interval is the interval between the self-test runs, each run is bounded by it as well
+	Interval time.Duration
+
+	// MaxAge is the max age of the last successful run for the webhook to be reported ready
+	MaxAge time.Duration
+
+	lock        sync.RWMutex
+	lastSuccess time.Time
+	lastErr     error
+}
+
+// NewSelfTest returns the self-test running every interval, last successful run is considered recent for three intervals
+func NewSelfTest(k8sClient *config.K8sClient, logger logr.Logger, namespace string, interval time.Duration) *SelfTest {
+	if namespace == "" {
+		namespace = DefaultSelfTestNamespace
+	}
+	return &SelfTest{Client: k8sClient, Log: logger, Namespace: namespace, Interval: interval, MaxAge: 3 * interval}
+}
+
+// Start runs the self-test every interval until the context is done
+func (s *SelfTest) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		s.Run(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements the LeaderElectionRunnable, self-test runs on every replica
+func (s *SelfTest) NeedLeaderElection() bool {
+	return false
+}
+
+// Run looks up the namespace & runs the canned pod through the mutations once and records the result
+func (s *SelfTest) Run(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, s.Interval)
+	defer cancel()
+
+	err := s.lookupNamespace(ctx)
+	if err == nil {
+		err = s.mutate(ctx)
+	}
+	if err == nil && ctx.Err() != nil {
+		err = fmt.Errorf("self-test is not completed within %s: %w", s.Interval, ctx.Err())
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastErr = err
+	if err != nil {
+		s.Log.Error(err, "Self-test failed")
+		return
+	}
+	s.lastSuccess = time.Now()
+}
+
+// lookupNamespace gets the namespace of the self-test from the API server, and from the informer cache once it is synced
+func (s *SelfTest) lookupNamespace(ctx context.Context) error {
+	if _, err := s.Client.Clientset.CoreV1().Namespaces().Get(ctx, s.Namespace, metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("namespace %s is not looked up from the API server: %w", s.Namespace, err)
+	}
+	if lister := s.Client.NamespaceLister(); lister != nil {
+		if _, err := lister.Get(s.Namespace); err != nil {
+			return fmt.Errorf("namespace %s is not looked up from the informer cache: %w", s.Namespace, err)
+		}
+	}
+	return nil
+}
+
+// mutate runs the canned pod through the mutations
+func (s *SelfTest) mutate(ctx context.Context) error {
+	params := &mutation.Params{
+		Client:    s.Client,
+		Log:       s.Log,
+		LMConfig:  config.GetConfig(),
+		Mutations: mutation.Mutations,
+		Pod:       cannedPod(s.Namespace),
+		Namespace: s.Namespace,
+		// Self-test is a dry run
+		DryRun: true,
+	}
+	return mutation.RunMutations(ctx, params)
+}
+
+// Check reports if the last successful self-test run is recent
+func (s *SelfTest) Check(_ *http.Request) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.lastSuccess.IsZero() {
+		if s.lastErr != nil {
+			return fmt.Errorf("self-test has not succeeded yet: %w", s.lastErr)
+		}
+		return errors.New("self-test has not run yet")
+	}
+	if age := time.Since(s.lastSuccess); age > s.MaxAge {
+		return fmt.Errorf("last successful self-test was %s ago: %v", age.Round(time.Second), s.lastErr)
+	}
+	return nil
+}
+
+// cannedPod returns the orphan pod used by the self-test, so that the workload lookup does not depend on the other resources
+func cannedPod(namespace string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      selfTestPodName,
+			Namespace: namespace,
+			Labels:    map[string]string{"app": selfTestPodName},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app", Image: "busybox"}},
+		},
+	}
+}
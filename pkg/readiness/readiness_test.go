@@ -0,0 +1,180 @@
+package readiness
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/logicmonitor/lm-k8s-webhook/internal/testutil"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/certs"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var logger = logf.Log.WithName("unit-tests")
+
+func TestConfigCheck(t *testing.T) {
+	tests := []struct {
+		name           string
+		configFilePath string
+		wantErr        bool
+	}{
+		// Config is global, so the cases depend on the config loaded by the previous ones
+		{
+			name:           "Invalid config is never loaded",
+			configFilePath: "./testdata/config_with_invalid_containers.yaml",
+			wantErr:        true,
+		},
+		{
+			name:           "Config file is not provided",
+			configFilePath: "./testdata/missing_config.yaml",
+			wantErr:        false,
+		},
+		{
+			name:           "Valid config is loaded",
+			configFilePath: "./testdata/config.yaml",
+			wantErr:        false,
+		},
+		{
+			name:           "Failed reload keeps the loaded config",
+			configFilePath: "./testdata/config_with_invalid_containers.yaml",
+			wantErr:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_ = config.LoadConfig(tt.configFilePath)
+			err := ConfigCheck(tt.configFilePath)(nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ConfigCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCertCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		notAfter     time.Time
+		noCert       bool
+		reloadFailed bool
+		wantErr      bool
+	}{
+		{
+			name:     "Valid certificate",
+			notAfter: time.Now().Add(30 * 24 * time.Hour),
+			wantErr:  false,
+		},
+		{
+			name:     "Certificate expiring within the threshold",
+			notAfter: time.Now().Add(time.Hour),
+			wantErr:  false,
+		},
+		{
+			name:     "Expired certificate",
+			notAfter: time.Now().Add(-time.Minute),
+			wantErr:  true,
+		},
+		{
+			name:    "Missing certificate",
+			noCert:  true,
+			wantErr: true,
+		},
+		{
+			name:         "Last reload of the watcher failed",
+			notAfter:     time.Now().Add(30 * 24 * time.Hour),
+			reloadFailed: true,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+			if !tt.noCert {
+				certPEM, keyPEM := testutil.NewCert(t, tt.notAfter)
+				certFile, keyFile = testutil.WriteCert(t, dir, certPEM, keyPEM)
+			}
+			watcher := &certs.Watcher{CertFile: certFile, KeyFile: keyFile, Log: logger}
+			if tt.reloadFailed {
+				watcher.CertFile = filepath.Join(dir, "missing.crt")
+			}
+			_ = watcher.Reload()
+			err := CertCheck(certFile, keyFile, 24*time.Hour, watcher, logger)(nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CertCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInformerCheck(t *testing.T) {
+	k8sClient, err := testutil.NewFakeK8sClient(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+
+	if err := InformerCheck(k8sClient)(nil); err == nil {
+		t.Errorf("InformerCheck() returned nil before the informer is started, instead of error")
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := k8sClient.StartNamespaceInformer(stopCh); err != nil {
+		t.Errorf("Error occured in starting the namespace informer: %v", err)
+		return
+	}
+	if err := InformerCheck(k8sClient)(nil); err != nil {
+		t.Errorf("InformerCheck() returned an unexpected error after the informer is synced: %v", err)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	k8sClient, err := testutil.NewFakeK8sClient(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+	selfTest := NewSelfTest(k8sClient, logger, "", time.Second)
+
+	if err := selfTest.Check(nil); err == nil {
+		t.Errorf("SelfTest.Check() returned nil before the self-test is run, instead of error")
+	}
+
+	selfTest.Run(context.Background())
+	if err := selfTest.Check(nil); err != nil {
+		t.Errorf("SelfTest.Check() returned an unexpected error after the successful self-test: %v", err)
+	}
+
+	// Successful run is not recent anymore
+	selfTest.MaxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if err := selfTest.Check(nil); err == nil {
+		t.Errorf("SelfTest.Check() returned nil after the last successful self-test became stale, instead of error")
+	}
+}
+
+func TestSelfTestLooksUpNamespace(t *testing.T) {
+	k8sClient, err := testutil.NewFakeK8sClient(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+	if err != nil {
+		t.Errorf("Error occured in getting fake k8s client: %v", err)
+		return
+	}
+	testutil.StartNamespaceInformer(t, k8sClient)
+
+	selfTest := NewSelfTest(k8sClient, logger, "lm-k8s-webhook", time.Second)
+	selfTest.Run(context.Background())
+	if err := selfTest.Check(nil); err == nil {
+		t.Errorf("SelfTest.Check() returned nil when the namespace can not be looked up, instead of error")
+	}
+
+	selfTest = NewSelfTest(k8sClient, logger, "default", time.Second)
+	selfTest.Run(context.Background())
+	if err := selfTest.Check(nil); err != nil {
+		t.Errorf("SelfTest.Check() returned an unexpected error after the successful self-test: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package reloader
 
 import (
 	"context"
+	"sync"
 
 	"github.com/fsnotify/fsnotify"
 	lmk8swebhookconfig "github.com/logicmonitor/lm-k8s-webhook/pkg/config"
@@ -11,6 +12,30 @@ import (
 
 var logger = log.Log.WithName("reloader")
 
+var (
+	listenersLock   = new(sync.RWMutex)
+	reloadListeners []ReloadListener
+)
+
+// ReloadListener is notified with the previous and the reloaded config after the config is reloaded successfully
+type ReloadListener func(ctx context.Context, oldConfig, newConfig lmk8swebhookconfig.Config)
+
+// AddReloadListener registers the listener to be notified on every successful config reload
+func AddReloadListener(listener ReloadListener) {
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
+	reloadListeners = append(reloadListeners, listener)
+}
+
+// notifyReloadListeners notifies the registered listeners about the config reload
+func notifyReloadListeners(ctx context.Context, oldConfig, newConfig lmk8swebhookconfig.Config) {
+	listenersLock.RLock()
+	defer listenersLock.RUnlock()
+	for _, listener := range reloadListeners {
+		listener(ctx, oldConfig, newConfig)
+	}
+}
+
 // SetupConfigReloader starts watching for update event on the config file
 func SetupConfigReloader(ctx context.Context, lmconfigFilePath string) error {
 	reload := make(chan bool, 1)
@@ -40,9 +65,12 @@ func reloadConfig(ctx context.Context, reloadCh <-chan bool, reloadDone chan<- b
 		select {
 		case <-reloadCh:
 			logger.Info("Reloading the config")
+			oldConfig := lmk8swebhookconfig.GetConfig()
 			err := lmk8swebhookconfig.LoadConfig(lmconfigFilePath)
 			if err != nil {
 				logger.Error(err, "Error while loading the config file", "lmconfigFilePath", lmconfigFilePath)
+			} else {
+				notifyReloadListeners(ctx, oldConfig, lmk8swebhookconfig.GetConfig())
 			}
 			reloadDone <- true
 		case <-ctx.Done():
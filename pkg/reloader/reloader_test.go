@@ -214,3 +214,32 @@ func TestReloadConfigWithContextCancelled(t *testing.T) {
 		}
 	}
 }
+
+func TestReloadConfigNotifiesListeners(t *testing.T) {
+	reloadCh := make(chan bool, 1)
+	reloadDoneCh := make(chan bool, 1)
+	notified := make(chan config.Config, 1)
+
+	AddReloadListener(func(ctx context.Context, oldConfig, newConfig config.Config) {
+		notified <- newConfig
+	})
+	defer func() {
+		reloadListeners = nil
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloadCh <- true
+	go reloadConfig(ctx, reloadCh, reloadDoneCh, "testdata/config.yaml")
+	<-reloadDoneCh
+
+	select {
+	case newConfig := <-notified:
+		if !newConfig.MutationConfigProvided {
+			t.Errorf("reload listener received config with MutationConfigProvided = %v, but expected = %v", newConfig.MutationConfigProvided, true)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("reload listener is not notified after config reload")
+	}
+}
@@ -0,0 +1,314 @@
+package rollout
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/mutation"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// RestartedAtAnnotation is set on the pod template of the workload to trigger its rollout
+	RestartedAtAnnotation = "lm-k8s-webhook/restartedAt"
+
+	defaultBatchSize = 1
+)
+
+// workload represents the workload resource, whose pod template is evaluated for the rollout
+type workload struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Selector  *metav1.LabelSelector
+	Template  corev1.PodTemplateSpec
+}
+
+// Controller restarts the running workloads whose pods would get different env variables under the reloaded config.
+// It runs on the elected leader only, so that the workloads are restarted once, not by every replica of the webhook.
+type Controller struct {
+	Client *config.K8sClient
+	Log    logr.Logger
+
+	// rolloutLock makes sure that only one rollout is in progress at a time
+	rolloutLock sync.Mutex
+
+	// running is set while the controller is started on the leader, reloads are ignored otherwise
+	running int32
+
+	// pending is the config reload waiting for the rollout, reloads received meanwhile are merged into it
+	pendingLock sync.Mutex
+	pending     *configReload
+	reloaded    chan struct{}
+}
+
+// configReload holds the configs before & after the reload
+type configReload struct {
+	oldConfig config.Config
+	newConfig config.Config
+}
+
+// NewController returns the rollout controller
+func NewController(k8sClient *config.K8sClient, logger logr.Logger) *Controller {
+	return &Controller{Client: k8sClient, Log: logger, reloaded: make(chan struct{}, 1)}
+}
+
+// OnConfigReload queues the rollout of the affected workloads, if the rollout is enabled in the reloaded config and the controller runs on the leader
+func (c *Controller) OnConfigReload(_ context.Context, oldConfig, newConfig config.Config) {
+	if !newConfig.MutationConfig.Rollout.Enabled || atomic.LoadInt32(&c.running) == 0 {
+		return
+	}
+	c.pendingLock.Lock()
+	if c.pending == nil {
+		c.pending = &configReload{oldConfig: oldConfig, newConfig: newConfig}
+	} else {
+		c.pending.newConfig = newConfig
+	}
+	c.pendingLock.Unlock()
+
+	select {
+	case c.reloaded <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the rollouts of the queued config reloads until the context is done
+func (c *Controller) Start(ctx context.Context) error {
+	atomic.StoreInt32(&c.running, 1)
+	defer atomic.StoreInt32(&c.running, 0)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.reloaded:
+			c.pendingLock.Lock()
+			reload := c.pending
+			c.pending = nil
+			c.pendingLock.Unlock()
+			if reload == nil {
+				continue
+			}
+			if err := c.Rollout(ctx, reload.oldConfig, reload.newConfig); err != nil {
+				c.Log.Error(err, "rollout of the workloads failed")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection implements the LeaderElectionRunnable, workloads are restarted by the leader only
+func (c *Controller) NeedLeaderElection() bool {
+	return true
+}
+
+// Rollout restarts the workloads, whose pod templates get different env variables under the newConfig than the oldConfig, in batches
+func (c *Controller) Rollout(ctx context.Context, oldConfig, newConfig config.Config) error {
+	c.rolloutLock.Lock()
+	defer c.rolloutLock.Unlock()
+
+	rolloutConfig := newConfig.MutationConfig.Rollout
+
+	workloads, err := c.listWorkloads(ctx)
+	if err != nil {
+		return err
+	}
+
+	var affected []workload
+	for _, w := range workloads {
+		changed, err := c.isEnvChanged(ctx, w, oldConfig, newConfig)
+		if err != nil {
+			c.Log.Error(err, "error in evaluating the env variables of workload", "kind", w.Kind, "workload", fmt.Sprintf("%s/%s", w.Namespace, w.Name))
+			continue
+		}
+		if !changed {
+			continue
+		}
+		injected, err := c.isInjected(ctx, w)
+		if err != nil {
+			c.Log.Error(err, "error in listing the pods of workload", "kind", w.Kind, "workload", fmt.Sprintf("%s/%s", w.Namespace, w.Name))
+			continue
+		}
+		if injected {
+			affected = append(affected, w)
+		}
+	}
+
+	c.Log.Info("Workloads affected by the config change", "count", len(affected))
+
+	batchSize := rolloutConfig.BatchSize
+	if batchSize < 1 {
+		batchSize = defaultBatchSize
+	}
+
+	for start := 0; start < len(affected); start += batchSize {
+		if start > 0 && rolloutConfig.BatchInterval.Duration > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(rolloutConfig.BatchInterval.Duration):
+			}
+		}
+		end := start + batchSize
+		if end > len(affected) {
+			end = len(affected)
+		}
+		for _, w := range affected[start:end] {
+			logger := c.Log.WithValues("kind", w.Kind, "workload", fmt.Sprintf("%s/%s", w.Namespace, w.Name))
+			if rolloutConfig.RespectPodDisruptionBudgets {
+				blocked, err := c.isBlockedByPodDisruptionBudget(ctx, w)
+				if err != nil {
+					logger.Error(err, "error in checking the pod disruption budgets, skipping the restart")
+					continue
+				}
+				if blocked {
+					logger.Info("PodDisruptionBudget does not allow disruption, skipping the restart")
+					continue
+				}
+			}
+			if err := c.restart(ctx, w); err != nil {
+				logger.Error(err, "error in restarting the workload")
+				continue
+			}
+			logger.Info("Restarted the workload")
+		}
+	}
+	return nil
+}
+
+// listWorkloads lists the deployments, statefulsets and daemonsets of all the namespaces
+func (c *Controller) listWorkloads(ctx context.Context) ([]workload, error) {
+	var workloads []workload
+	listOpts := metav1.ListOptions{}
+
+	deployments, err := c.Client.Clientset.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, listOpts)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deployments.Items {
+		workloads = append(workloads, workload{Kind: mutation.WorkloadResourceDeployment, Namespace: d.Namespace, Name: d.Name, Selector: d.Spec.Selector, Template: d.Spec.Template})
+	}
+
+	statefulSets, err := c.Client.Clientset.AppsV1().StatefulSets(metav1.NamespaceAll).List(ctx, listOpts)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range statefulSets.Items {
+		workloads = append(workloads, workload{Kind: mutation.WorkloadResourceStatefulSet, Namespace: s.Namespace, Name: s.Name, Selector: s.Spec.Selector, Template: s.Spec.Template})
+	}
+
+	daemonSets, err := c.Client.Clientset.AppsV1().DaemonSets(metav1.NamespaceAll).List(ctx, listOpts)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range daemonSets.Items {
+		workloads = append(workloads, workload{Kind: mutation.WorkloadResourceDaemonSet, Namespace: d.Namespace, Name: d.Name, Selector: d.Spec.Selector, Template: d.Spec.Template})
+	}
+	return workloads, nil
+}
+
+// isEnvChanged checks if the pod template of the workload gets different env variables under the newConfig than the oldConfig
+func (c *Controller) isEnvChanged(ctx context.Context, w workload, oldConfig, newConfig config.Config) (bool, error) {
+	oldPod, err := c.mutatedPod(ctx, w, oldConfig)
+	if err != nil {
+		return false, err
+	}
+	newPod, err := c.mutatedPod(ctx, w, newConfig)
+	if err != nil {
+		return false, err
+	}
+	return !equality.Semantic.DeepEqual(oldPod.Spec.Containers, newPod.Spec.Containers) ||
+		!equality.Semantic.DeepEqual(oldPod.Spec.InitContainers, newPod.Spec.InitContainers), nil
+}
+
+// mutatedPod runs the mutations on the pod built from the pod template of the workload using the given config
+func (c *Controller) mutatedPod(ctx context.Context, w workload, lmConfig config.Config) (*corev1.Pod, error) {
+	pod := &corev1.Pod{ObjectMeta: *w.Template.ObjectMeta.DeepCopy(), Spec: *w.Template.Spec.DeepCopy()}
+	pod.Name = w.Name
+	pod.Namespace = w.Namespace
+
+	params := &mutation.Params{
+		Client:    c.Client,
+		Log:       c.Log,
+		LMConfig:  lmConfig,
+		Mutations: mutation.Mutations,
+		Pod:       pod,
+		Namespace: w.Namespace,
+		// Env variables are only evaluated, so it is a dry run
+		DryRun: true,
+	}
+	if err := mutation.RunMutations(ctx, params); err != nil {
+		return nil, err
+	}
+	return pod, nil
+}
+
+// isInjected checks if the running pods of the workload are mutated by the webhook
+func (c *Controller) isInjected(ctx context.Context, w workload) (bool, error) {
+	selector, err := metav1.LabelSelectorAsSelector(w.Selector)
+	if err != nil {
+		return false, err
+	}
+	pods, err := c.Client.Clientset.CoreV1().Pods(w.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return false, err
+	}
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			for _, env := range container.Env {
+				if mutation.IsManagedEnvVar(env.Name) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// isBlockedByPodDisruptionBudget checks if any PodDisruptionBudget covering the pods of the workload does not allow disruption
+func (c *Controller) isBlockedByPodDisruptionBudget(ctx context.Context, w workload) (bool, error) {
+	pdbs, err := c.Client.Clientset.PolicyV1().PodDisruptionBudgets(w.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for _, pdb := range pdbs.Items {
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			return false, err
+		}
+		// Empty selector matches all the pods of the namespace, while the missing one matches none
+		if !selector.Matches(labels.Set(w.Template.Labels)) {
+			continue
+		}
+		if pdb.Status.DisruptionsAllowed < 1 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// restart triggers the rollout of the workload by annotating its pod template
+func (c *Controller) restart(ctx context.Context, w workload) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, RestartedAtAnnotation, time.Now().Format(time.RFC3339)))
+	patchOpts := metav1.PatchOptions{}
+
+	var err error
+	switch w.Kind {
+	case mutation.WorkloadResourceDeployment:
+		_, err = c.Client.Clientset.AppsV1().Deployments(w.Namespace).Patch(ctx, w.Name, types.StrategicMergePatchType, patch, patchOpts)
+	case mutation.WorkloadResourceStatefulSet:
+		_, err = c.Client.Clientset.AppsV1().StatefulSets(w.Namespace).Patch(ctx, w.Name, types.StrategicMergePatchType, patch, patchOpts)
+	case mutation.WorkloadResourceDaemonSet:
+		_, err = c.Client.Clientset.AppsV1().DaemonSets(w.Namespace).Patch(ctx, w.Name, types.StrategicMergePatchType, patch, patchOpts)
+	default:
+		err = fmt.Errorf("unsupported workload kind: %s", w.Kind)
+	}
+	return err
+}
@@ -0,0 +1,189 @@
+package rollout
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/logicmonitor/lm-k8s-webhook/internal/testutil"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/mutation"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var logger = logf.Log.WithName("unit-tests")
+
+func newDeployment(name string) *appsv1.Deployment {
+	labels := map[string]string{"app": name}
+	return &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &v1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{Labels: labels},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			},
+		},
+	}
+}
+
+func newPod(name string, app string, injected bool) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": app}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	if injected {
+		pod.Spec.Containers[0].Env = []corev1.EnvVar{{Name: mutation.LMAPMPodName}}
+	}
+	return pod
+}
+
+func newConfig(endpoint string, rollout config.Rollout) config.Config {
+	return config.Config{
+		MutationConfigProvided: true,
+		MutationConfig: config.MutationConfig{
+			LMEnvVars: config.LMEnvVars{Operation: []config.OperationEnv{
+				{Env: corev1.EnvVar{Name: "OTLP_ENDPOINT", Value: endpoint}, OverrideDisabled: true},
+			}},
+			Rollout: rollout,
+		},
+	}
+}
+
+func TestRollout(t *testing.T) {
+	tests := []struct {
+		name        string
+		objects     []runtime.Object
+		oldConfig   config.Config
+		newConfig   config.Config
+		wantRestart map[string]bool
+	}{
+		{
+			name:        "Restart injected workload when env changes",
+			objects:     []runtime.Object{newDeployment("hello"), newPod("hello-1", "hello", true)},
+			oldConfig:   newConfig("lmotel-svc:4317", config.Rollout{Enabled: true}),
+			newConfig:   newConfig("lmotel-svc:4318", config.Rollout{Enabled: true}),
+			wantRestart: map[string]bool{"hello": true},
+		},
+		{
+			name:        "Skip workload when env does not change",
+			objects:     []runtime.Object{newDeployment("hello"), newPod("hello-1", "hello", true)},
+			oldConfig:   newConfig("lmotel-svc:4317", config.Rollout{Enabled: true}),
+			newConfig:   newConfig("lmotel-svc:4317", config.Rollout{Enabled: true}),
+			wantRestart: map[string]bool{"hello": false},
+		},
+		{
+			name:        "Skip workload whose pods are not injected",
+			objects:     []runtime.Object{newDeployment("hello"), newPod("hello-1", "hello", false)},
+			oldConfig:   newConfig("lmotel-svc:4317", config.Rollout{Enabled: true}),
+			newConfig:   newConfig("lmotel-svc:4318", config.Rollout{Enabled: true}),
+			wantRestart: map[string]bool{"hello": false},
+		},
+		{
+			name: "Skip workload blocked by PodDisruptionBudget",
+			objects: []runtime.Object{
+				newDeployment("hello"), newPod("hello-1", "hello", true),
+				newDeployment("world"), newPod("world-1", "world", true),
+				&policyv1.PodDisruptionBudget{
+					ObjectMeta: v1.ObjectMeta{Name: "hello-pdb", Namespace: "default"},
+					Spec:       policyv1.PodDisruptionBudgetSpec{Selector: &v1.LabelSelector{MatchLabels: map[string]string{"app": "hello"}}},
+					Status:     policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: 0},
+				},
+			},
+			oldConfig:   newConfig("lmotel-svc:4317", config.Rollout{Enabled: true}),
+			newConfig:   newConfig("lmotel-svc:4318", config.Rollout{Enabled: true, BatchSize: 2, RespectPodDisruptionBudgets: true}),
+			wantRestart: map[string]bool{"hello": false, "world": true},
+		},
+		{
+			name: "Skip workloads blocked by PodDisruptionBudget with empty selector",
+			objects: []runtime.Object{
+				newDeployment("hello"), newPod("hello-1", "hello", true),
+				&policyv1.PodDisruptionBudget{
+					ObjectMeta: v1.ObjectMeta{Name: "all-pdb", Namespace: "default"},
+					Spec:       policyv1.PodDisruptionBudgetSpec{Selector: &v1.LabelSelector{}},
+					Status:     policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: 0},
+				},
+			},
+			oldConfig:   newConfig("lmotel-svc:4317", config.Rollout{Enabled: true}),
+			newConfig:   newConfig("lmotel-svc:4318", config.Rollout{Enabled: true, RespectPodDisruptionBudgets: true}),
+			wantRestart: map[string]bool{"hello": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k8sClient, err := testutil.NewFakeK8sClient(tt.objects...)
+			if err != nil {
+				t.Errorf("Error occurred in getting fake k8s client: %v", err)
+				return
+			}
+			controller := NewController(k8sClient, logger)
+
+			if err := controller.Rollout(context.Background(), tt.oldConfig, tt.newConfig); err != nil {
+				t.Errorf("Rollout() returned an unexpected error: %+v", err)
+				return
+			}
+
+			for name, wantRestart := range tt.wantRestart {
+				deployment, err := k8sClient.Clientset.AppsV1().Deployments("default").Get(context.Background(), name, v1.GetOptions{})
+				if err != nil {
+					t.Errorf("Error occurred in getting deployment %s: %v", name, err)
+					return
+				}
+				_, restarted := deployment.Spec.Template.Annotations[RestartedAtAnnotation]
+				if restarted != wantRestart {
+					t.Errorf("Rollout() restarted deployment %s = %v, but expected = %v", name, restarted, wantRestart)
+				}
+			}
+		})
+	}
+}
+
+func TestOnConfigReloadRunsOnLeaderOnly(t *testing.T) {
+	k8sClient, err := testutil.NewFakeK8sClient(newDeployment("hello"), newPod("hello-1", "hello", true))
+	if err != nil {
+		t.Errorf("Error occurred in getting fake k8s client: %v", err)
+		return
+	}
+	controller := NewController(k8sClient, logger)
+	oldConfig := newConfig("lmotel-svc:4317", config.Rollout{Enabled: true})
+	newConfig := newConfig("lmotel-svc:4318", config.Rollout{Enabled: true})
+
+	isRestarted := func() bool {
+		deployment, err := k8sClient.Clientset.AppsV1().Deployments("default").Get(context.Background(), "hello", v1.GetOptions{})
+		if err != nil {
+			t.Errorf("Error occurred in getting deployment hello: %v", err)
+			return false
+		}
+		_, restarted := deployment.Spec.Template.Annotations[RestartedAtAnnotation]
+		return restarted
+	}
+
+	// Reload is ignored until the controller is started on the leader
+	controller.OnConfigReload(context.Background(), oldConfig, newConfig)
+	if controller.pending != nil {
+		t.Errorf("OnConfigReload() queued the rollout = true, but expected = false")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = controller.Start(ctx) }()
+	for atomic.LoadInt32(&controller.running) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	controller.OnConfigReload(context.Background(), oldConfig, newConfig)
+	deadline := time.Now().Add(5 * time.Second)
+	for !isRestarted() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !isRestarted() {
+		t.Errorf("OnConfigReload() restarted deployment hello = false, but expected = true")
+	}
+}
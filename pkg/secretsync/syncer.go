@@ -0,0 +1,223 @@
+package secretsync
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/logicmonitor/lm-k8s-webhook/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// ManagedByLabel is set on the secrets copied from the webhook namespace, only the labeled secrets are updated or deleted by the syncer
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+
+	// ManagedByLabelValue is the value of the ManagedByLabel of the copied secrets
+	ManagedByLabelValue = "lm-k8s-webhook"
+
+	// CopiedFromAnnotation holds the namespace/name of the source secret of the copy
+	CopiedFromAnnotation = "lm-k8s-webhook/copied-from"
+
+	// requestQueueSize is the number of the pending sync requests, requests are dropped once it is full, as the periodic sync covers them
+	requestQueueSize = 128
+)
+
+// Syncer keeps the copies of the secrets of the webhook namespace in the allowed namespaces in sync with their source.
+// Secrets are copied out of the admission path: admission only requests the copy, which is made by the syncer.
+// Copies are created, updated as the source rotates & deleted once the source is deleted, secrets not labeled as copies are never touched.
+type Syncer struct {
+	Client           *config.K8sClient
+	Log              logr.Logger
+	WebhookNamespace string
+
+	// Namespaces & Names are the namespaces into which the secrets can be copied & the names of the secrets which can be copied
+	Namespaces []string
+	Names      []string
+
+	// Interval is the interval of syncing all the allowed copies
+	Interval time.Duration
+
+	requests chan types.NamespacedName
+}
+
+// NewSyncer returns the syncer copying the named secrets of the webhook namespace into the namespaces
+func NewSyncer(k8sClient *config.K8sClient, logger logr.Logger, webhookNamespace string, namespaces []string, names []string, interval time.Duration) *Syncer {
+	return &Syncer{
+		Client:           k8sClient,
+		Log:              logger,
+		WebhookNamespace: webhookNamespace,
+		Namespaces:       namespaces,
+		Names:            names,
+		Interval:         interval,
+		requests:         make(chan types.NamespacedName, requestQueueSize),
+	}
+}
+
+// IsAllowed checks if the secret can be copied into the namespace
+func (s *Syncer) IsAllowed(namespace string, name string) bool {
+	return s != nil && namespace != s.WebhookNamespace && contains(s.Namespaces, namespace) && contains(s.Names, name)
+}
+
+// CopySecret returns the source secret of the copy into the namespace, and requests the copy to be made unless it is a dry run
+func (s *Syncer) CopySecret(ctx context.Context, namespace string, name string, dryRun bool) (*corev1.Secret, error) {
+	if !s.IsAllowed(namespace, name) {
+		return nil, fmt.Errorf("secret %s is not allowed to be copied into namespace %s", name, namespace)
+	}
+	source, err := s.Client.Clientset.CoreV1().Secrets(s.WebhookNamespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		s.Request(namespace, name)
+	}
+	return source, nil
+}
+
+// Request requests the copy of the secret into the namespace to be synced
+func (s *Syncer) Request(namespace string, name string) {
+	select {
+	case s.requests <- types.NamespacedName{Namespace: namespace, Name: name}:
+	default:
+		s.Log.V(1).Info("Sync request queue is full, copy is synced by the periodic sync", "namespace", namespace, "secret", name)
+	}
+}
+
+// Start syncs all the allowed copies every interval and the requested copies as they are requested, until the context is done.
+// Syncs are idempotent, so the syncer runs on every replica to serve the requests of its admissions.
+func (s *Syncer) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	s.SyncAll(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case req := <-s.requests:
+			if err := s.Sync(ctx, req.Namespace, req.Name); err != nil {
+				s.Log.Error(err, "Error in syncing the secret copy", "namespace", req.Namespace, "secret", req.Name)
+			}
+		case <-ticker.C:
+			s.SyncAll(ctx)
+		}
+	}
+}
+
+// NeedLeaderElection implements the LeaderElectionRunnable, copies are synced on every replica
+func (s *Syncer) NeedLeaderElection() bool {
+	return false
+}
+
+// SyncAll syncs the copies of all the allowed secrets in all the allowed namespaces
+func (s *Syncer) SyncAll(ctx context.Context) {
+	for _, namespace := range s.Namespaces {
+		for _, name := range s.Names {
+			if err := s.Sync(ctx, namespace, name); err != nil {
+				s.Log.Error(err, "Error in syncing the secret copy", "namespace", namespace, "secret", name)
+			}
+		}
+	}
+}
+
+// Sync syncs the copy of the secret in the namespace with its source in the webhook namespace.
+// Copy is deleted if the source is deleted, and the existing secret is left as is if it is not a copy.
+func (s *Syncer) Sync(ctx context.Context, namespace string, name string) error {
+	if !s.IsAllowed(namespace, name) {
+		return fmt.Errorf("secret %s is not allowed to be copied into namespace %s", name, namespace)
+	}
+	secrets := s.Client.Clientset.CoreV1().Secrets(namespace)
+
+	source, err := s.Client.Clientset.CoreV1().Secrets(s.WebhookNamespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return s.deleteCopy(ctx, namespace, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	existing, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := secrets.Create(ctx, s.newCopy(source, namespace), metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+		s.Log.Info("Copied secret from webhook namespace", "secret", name, "webhookNamespace", s.WebhookNamespace, "namespace", namespace)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !isCopy(existing) {
+		s.Log.V(1).Info("Secret is not a copy of the webhook namespace secret, leaving it as is", "namespace", namespace, "secret", name)
+		return nil
+	}
+	if existing.Type != source.Type {
+		// Type of the secret is immutable, so the copy is recreated
+		if err := secrets.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		_, err := secrets.Create(ctx, s.newCopy(source, namespace), metav1.CreateOptions{})
+		return err
+	}
+	if reflect.DeepEqual(existing.Data, source.Data) {
+		return nil
+	}
+	existing.Data = source.Data
+	if _, err := secrets.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	s.Log.Info("Updated the secret copy with the rotated source", "secret", name, "namespace", namespace)
+	return nil
+}
+
+// deleteCopy deletes the copy of the secret, whose source is deleted
+func (s *Syncer) deleteCopy(ctx context.Context, namespace string, name string) error {
+	secrets := s.Client.Clientset.CoreV1().Secrets(namespace)
+	existing, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !isCopy(existing) {
+		return nil
+	}
+	if err := secrets.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	s.Log.Info("Deleted the secret copy, as its source is deleted", "secret", name, "namespace", namespace)
+	return nil
+}
+
+// newCopy returns the labeled copy of the source secret in the namespace
+func (s *Syncer) newCopy(source *corev1.Secret, namespace string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        source.Name,
+			Namespace:   namespace,
+			Labels:      map[string]string{ManagedByLabel: ManagedByLabelValue},
+			Annotations: map[string]string{CopiedFromAnnotation: fmt.Sprintf("%s/%s", source.Namespace, source.Name)},
+		},
+		Type: source.Type,
+		Data: source.Data,
+	}
+}
+
+// isCopy checks if the secret is the copy made by the syncer
+func isCopy(secret *corev1.Secret) bool {
+	return secret.Labels[ManagedByLabel] == ManagedByLabelValue && secret.Annotations[CopiedFromAnnotation] != ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
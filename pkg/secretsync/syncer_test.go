@@ -0,0 +1,165 @@
+package secretsync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/logicmonitor/lm-k8s-webhook/internal/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var logger = logf.Log.WithName("unit-tests")
+
+func newSecret(namespace string, value string, copied bool) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "lm-creds", Namespace: namespace},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{"token": []byte(value)},
+	}
+	if copied {
+		secret.Labels = map[string]string{ManagedByLabel: ManagedByLabelValue}
+		secret.Annotations = map[string]string{CopiedFromAnnotation: "lm-webhook/lm-creds"}
+	}
+	return secret
+}
+
+func TestSync(t *testing.T) {
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		namespace string
+		wantErr   bool
+		wantValue string
+		wantFound bool
+		wantCopy  bool
+	}{
+		{
+			name:      "Create the missing copy",
+			objects:   []runtime.Object{newSecret("lm-webhook", "v1", false)},
+			namespace: "payments",
+			wantValue: "v1",
+			wantFound: true,
+			wantCopy:  true,
+		},
+		{
+			name:      "Update the copy with the rotated source",
+			objects:   []runtime.Object{newSecret("lm-webhook", "v2", false), newSecret("payments", "v1", true)},
+			namespace: "payments",
+			wantValue: "v2",
+			wantFound: true,
+			wantCopy:  true,
+		},
+		{
+			name:      "Leave the secret which is not a copy",
+			objects:   []runtime.Object{newSecret("lm-webhook", "v2", false), newSecret("payments", "own", false)},
+			namespace: "payments",
+			wantValue: "own",
+			wantFound: true,
+			wantCopy:  false,
+		},
+		{
+			name:      "Delete the copy of the deleted source",
+			objects:   []runtime.Object{newSecret("payments", "v1", true)},
+			namespace: "payments",
+			wantFound: false,
+		},
+		{
+			name:      "Keep the secret which is not a copy when the source is deleted",
+			objects:   []runtime.Object{newSecret("payments", "own", false)},
+			namespace: "payments",
+			wantValue: "own",
+			wantFound: true,
+		},
+		{
+			name:      "Do not copy into the namespace which is not allowed",
+			objects:   []runtime.Object{newSecret("lm-webhook", "v1", false)},
+			namespace: "default",
+			wantErr:   true,
+			wantFound: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k8sClient, err := testutil.NewFakeK8sClient(tt.objects...)
+			if err != nil {
+				t.Errorf("Error occurred in getting fake k8s client: %v", err)
+				return
+			}
+			syncer := NewSyncer(k8sClient, logger, "lm-webhook", []string{"payments"}, []string{"lm-creds"}, time.Minute)
+
+			err = syncer.Sync(context.Background(), tt.namespace, "lm-creds")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Sync() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			secret, err := k8sClient.Clientset.CoreV1().Secrets(tt.namespace).Get(context.Background(), "lm-creds", v1.GetOptions{})
+			if found := err == nil; found != tt.wantFound {
+				t.Errorf("Sync() left the secret found = %v, but expected = %v", found, tt.wantFound)
+				return
+			}
+			if err != nil {
+				if !apierrors.IsNotFound(err) {
+					t.Errorf("Error occurred in getting the secret: %v", err)
+				}
+				return
+			}
+			if value := string(secret.Data["token"]); value != tt.wantValue {
+				t.Errorf("Sync() left the secret value = %s, but expected = %s", value, tt.wantValue)
+			}
+			if copied := isCopy(secret); copied != tt.wantCopy {
+				t.Errorf("Sync() left the secret labeled as copy = %v, but expected = %v", copied, tt.wantCopy)
+			}
+		})
+	}
+}
+
+func TestCopySecret(t *testing.T) {
+	k8sClient, err := testutil.NewFakeK8sClient(newSecret("lm-webhook", "v1", false))
+	if err != nil {
+		t.Errorf("Error occurred in getting fake k8s client: %v", err)
+		return
+	}
+
+	tests := []struct {
+		name          string
+		namespace     string
+		secretName    string
+		dryRun        bool
+		wantErr       bool
+		wantRequested bool
+	}{
+		{name: "Request the allowed copy", namespace: "payments", secretName: "lm-creds", wantRequested: true},
+		{name: "Do not request the copy for dry run", namespace: "payments", secretName: "lm-creds", dryRun: true},
+		{name: "Reject the namespace which is not allowed", namespace: "default", secretName: "lm-creds", wantErr: true},
+		{name: "Reject the secret which is not allowed", namespace: "payments", secretName: "db-password", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			syncer := NewSyncer(k8sClient, logger, "lm-webhook", []string{"payments"}, []string{"lm-creds"}, time.Minute)
+
+			source, err := syncer.CopySecret(context.Background(), tt.namespace, tt.secretName, tt.dryRun)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CopySecret() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && string(source.Data["token"]) != "v1" {
+				t.Errorf("CopySecret() returned source = %v, but expected the webhook namespace secret", source)
+			}
+			if requested := len(syncer.requests) > 0; requested != tt.wantRequested {
+				t.Errorf("CopySecret() requested the copy = %v, but expected = %v", requested, tt.wantRequested)
+			}
+			// Copy is made by the syncer, not by the caller
+			if _, err := k8sClient.Clientset.CoreV1().Secrets(tt.namespace).Get(context.Background(), tt.secretName, v1.GetOptions{}); err == nil {
+				t.Errorf("CopySecret() copied the secret, but expected only the request")
+			}
+		})
+	}
+}